@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/disk"
+)
+
+// parsePartitionAlignment parses the --partition-alignment option, e.g.
+// "4MiB". An empty string means the default alignment and returns 0.
+func parsePartitionAlignment(s string) (uint64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	alignment, err := datasizes.Parse(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid partition alignment %q: %w", s, err)
+	}
+	if alignment < disk.DefaultSectorSize || alignment&(alignment-1) != 0 {
+		return 0, fmt.Errorf("invalid partition alignment %q, must be a power of two multiple of the sector size (%d bytes)", s, disk.DefaultSectorSize)
+	}
+	return alignment, nil
+}
+
+func alignUp(size, alignment uint64) uint64 {
+	if size%alignment == 0 {
+		return size
+	}
+	return (size/alignment + 1) * alignment
+}
+
+// alignPartitions moves the partitions so that every partition starts
+// at a multiple of alignment and grows the partition table if needed.
+// The partition sizes are not changed. The partition table always
+// aligns to 1 MiB so smaller alignments are a no-op.
+func alignPartitions(pt *disk.PartitionTable, alignment uint64) {
+	if alignment == 0 || len(pt.Partitions) == 0 {
+		return
+	}
+
+	// the partitions are not necessarily ordered by their offset, e.g.
+	// the root partition is always placed last
+	parts := make([]*disk.Partition, 0, len(pt.Partitions))
+	for idx := range pt.Partitions {
+		parts = append(parts, &pt.Partitions[idx])
+	}
+	sort.SliceStable(parts, func(i, j int) bool {
+		return parts[i].Start < parts[j].Start
+	})
+
+	var shift uint64
+	for _, part := range parts {
+		start := alignUp(part.Start+shift, alignment)
+		shift = start - part.Start
+		part.Start = start
+	}
+
+	// the GPT header is also at the end of the partition table
+	footer := pt.ExtraPadding
+	if pt.Type == disk.PT_GPT {
+		footer += pt.HeaderSize()
+	}
+	last := parts[len(parts)-1]
+	pt.Size = max(pt.Size, alignUp(last.Start+last.Size+footer, alignment))
+}
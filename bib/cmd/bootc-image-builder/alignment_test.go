@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePartitionAlignment(t *testing.T) {
+	for _, tc := range []struct {
+		arg    string
+		exp    uint64
+		expErr string
+	}{
+		{"", 0, ""},
+		{"512", 512, ""},
+		{"4 KiB", 4 * 1024, ""},
+		{"4MiB", 4 * 1024 * 1024, ""},
+		{"3MiB", 0, `invalid partition alignment "3MiB", must be a power of two multiple of the sector size (512 bytes)`},
+		{"256", 0, `invalid partition alignment "256", must be a power of two multiple of the sector size (512 bytes)`},
+		{"lots", 0, `invalid partition alignment "lots": the size string doesn't contain any number: lots`},
+	} {
+		t.Run(tc.arg, func(t *testing.T) {
+			alignment, err := parsePartitionAlignment(tc.arg)
+			if tc.expErr != "" {
+				assert.EqualError(t, err, tc.expErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.exp, alignment)
+		})
+	}
+}
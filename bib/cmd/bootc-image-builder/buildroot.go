@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/osbuild/images/pkg/rpmmd"
+
+	"github.com/osbuild/bootc-image-builder/bib/internal/setup"
+)
+
+// buildPackageSetChain is the name of the package set chain of the
+// build root pipeline
+const buildPackageSetChain = "build"
+
+// validateBuildPackages checks the --build-package arguments. Disk
+// images use the container image itself as the build root, only the
+// ISO build root is installed from packages.
+func validateBuildPackages(pkgs []string, buildsISO bool) error {
+	if len(pkgs) == 0 {
+		return nil
+	}
+	if !buildsISO {
+		return fmt.Errorf("--build-package is only supported for ISO image types, disk images use the container as the build root")
+	}
+	for _, pkg := range pkgs {
+		if !rpmNameRE.MatchString(pkg) {
+			return fmt.Errorf("invalid build package name %q", pkg)
+		}
+	}
+	return nil
+}
+
+// validateBuildContainer checks the --build-container argument, like
+// the build packages it is only supported for the ISO build root
+func validateBuildContainer(imgref string, buildsISO bool) error {
+	if imgref == "" {
+		return nil
+	}
+	if !buildsISO {
+		return fmt.Errorf("--build-container is only supported for ISO image types, disk images use the container as the build root")
+	}
+	return setup.ValidateImgref(imgref)
+}
+
+// addBuildPackages adds the extra packages to the package set chain
+// of the build root
+func addBuildPackages(chains map[string][]rpmmd.PackageSet, pkgs []string) error {
+	if len(pkgs) == 0 {
+		return nil
+	}
+	chain, ok := chains[buildPackageSetChain]
+	if !ok || len(chain) == 0 {
+		return fmt.Errorf("cannot add build packages: no %q package set", buildPackageSetChain)
+	}
+	chain[0].Include = append(chain[0].Include, pkgs...)
+	return nil
+}
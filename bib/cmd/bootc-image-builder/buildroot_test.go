@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+func TestValidateBuildPackages(t *testing.T) {
+	assert.NoError(t, validateBuildPackages(nil, false))
+	assert.NoError(t, validateBuildPackages([]string{"strace", "python3-pyyaml"}, true))
+
+	err := validateBuildPackages([]string{"strace"}, false)
+	assert.EqualError(t, err, "--build-package is only supported for ISO image types, disk images use the container as the build root")
+	err = validateBuildPackages([]string{"strace; rm -rf /"}, true)
+	assert.EqualError(t, err, `invalid build package name "strace; rm -rf /"`)
+}
+
+func TestAddBuildPackages(t *testing.T) {
+	chains := map[string][]rpmmd.PackageSet{
+		"build":         {{Include: []string{"selinux-policy-targeted"}}, {Include: []string{"other"}}},
+		"anaconda-tree": {{Include: []string{"anaconda"}}},
+	}
+	assert.NoError(t, addBuildPackages(chains, []string{"strace"}))
+	assert.Equal(t, []string{"selinux-policy-targeted", "strace"}, chains["build"][0].Include)
+	assert.Equal(t, []string{"other"}, chains["build"][1].Include)
+	assert.Equal(t, []string{"anaconda"}, chains["anaconda-tree"][0].Include)
+
+	err := addBuildPackages(map[string][]rpmmd.PackageSet{}, []string{"strace"})
+	assert.EqualError(t, err, `cannot add build packages: no "build" package set`)
+	assert.NoError(t, addBuildPackages(map[string][]rpmmd.PackageSet{}, nil))
+}
+
+func TestValidateBuildContainer(t *testing.T) {
+	assert.NoError(t, validateBuildContainer("", false))
+	assert.NoError(t, validateBuildContainer("quay.io/centos-bootc/centos-bootc:stream10", true))
+
+	err := validateBuildContainer("quay.io/centos-bootc/centos-bootc:stream10", false)
+	assert.EqualError(t, err, "--build-container is only supported for ISO image types, disk images use the container as the build root")
+	err = validateBuildContainer("quay.io/Example/Build", true)
+	assert.ErrorContains(t, err, "invalid image reference 'quay.io/Example/Build': ")
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+// systemCABundle is the CA bundle of the bib container, curl only
+// uses the given CA file so it needs to be added to the --ca-cert
+// certificates to keep the public mirrors working
+var systemCABundle = "/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem"
+
+// readCACerts reads the PEM encoded --ca-cert certificates and
+// returns them as a single bundle
+func readCACerts(paths []string) ([]byte, error) {
+	var bundle []byte
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA certificate: %w", err)
+		}
+		if err := validateCACert(data); err != nil {
+			return nil, fmt.Errorf("invalid CA certificate %q: %w", p, err)
+		}
+		bundle = append(bundle, data...)
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			bundle = append(bundle, '\n')
+		}
+	}
+	return bundle, nil
+}
+
+func validateCACert(data []byte) error {
+	var found bool
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return err
+		}
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("no PEM encoded certificate found")
+	}
+	return nil
+}
+
+// prepareCACerts writes the CA certificates into a temporary directory.
+// The directory is used as the certificate directory of the container
+// resolver, its "*.crt" files are trusted in addition to the system CAs.
+func prepareCACerts(bundle []byte) (dir string, cleanup func(), err error) {
+	dir, err = os.MkdirTemp("", "bib-ca-certs")
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot create temporary directory for CA certificates: %w", err)
+	}
+	cleanup = func() {
+		if err := os.RemoveAll(dir); err != nil {
+			logrus.Warnf("prepareCACerts: failed to remove temporary directory %s: %v", dir, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ca.crt"), bundle, 0644); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("cannot write CA certificates: %w", err)
+	}
+	return dir, cleanup, nil
+}
+
+// prepareOsbuildCACerts writes the CA bundle for the osbuild curl
+// sources into a temporary directory and returns the environment
+// variables to set for osbuild. The mTLS CA certificate (if any) is
+// included in the bundle.
+func prepareOsbuildCACerts(bundle []byte, mTLS *mTLSConfig) (envVars []string, cleanup func(), err error) {
+	system, err := os.ReadFile(systemCABundle)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("cannot read system CA bundle: %w", err)
+	}
+	caBundle := append([]byte{}, system...)
+	if mTLS != nil {
+		caBundle = append(caBundle, mTLS.ca...)
+		caBundle = append(caBundle, '\n')
+	}
+	caBundle = append(caBundle, bundle...)
+
+	dir, err := os.MkdirTemp("", "osbuild-ca-certs")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temporary directory for osbuild CA certificates: %w", err)
+	}
+	cleanup = func() {
+		if err := os.RemoveAll(dir); err != nil {
+			logrus.Warnf("prepareOsbuildCACerts: failed to remove temporary directory %s: %v", dir, err)
+		}
+	}
+	caPath := filepath.Join(dir, "ca-bundle.pem")
+	if err := os.WriteFile(caPath, caBundle, 0644); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to write CA certificates for osbuild: %w", err)
+	}
+	return []string{
+		fmt.Sprintf("OSBUILD_SOURCES_CURL_SSL_CA_CERT=%s", caPath),
+	}, cleanup, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/arch"
+)
+
+func makeTestCACert(t *testing.T, cn string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestReadCACerts(t *testing.T) {
+	tmpdir := t.TempDir()
+	ca1 := makeTestCACert(t, "ca1")
+	ca2 := makeTestCACert(t, "ca2")
+	require.NoError(t, os.WriteFile(filepath.Join(tmpdir, "ca1.pem"), ca1, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpdir, "ca2.pem"), ca2, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpdir, "bad.pem"), []byte("not a cert"), 0644))
+
+	bundle, err := readCACerts(nil)
+	require.NoError(t, err)
+	assert.Nil(t, bundle)
+
+	bundle, err = readCACerts([]string{filepath.Join(tmpdir, "ca1.pem"), filepath.Join(tmpdir, "ca2.pem")})
+	require.NoError(t, err)
+	assert.Equal(t, append(append([]byte{}, ca1...), ca2...), bundle)
+
+	_, err = readCACerts([]string{filepath.Join(tmpdir, "bad.pem")})
+	assert.EqualError(t, err, `invalid CA certificate "`+filepath.Join(tmpdir, "bad.pem")+`": no PEM encoded certificate found`)
+	_, err = readCACerts([]string{"/no/such/ca.pem"})
+	assert.ErrorContains(t, err, "cannot read CA certificate: open /no/such/ca.pem: no such file or directory")
+}
+
+func TestCACertsReachResolverAndOsbuildEnv(t *testing.T) {
+	saved := systemCABundle
+	systemCABundle = filepath.Join(t.TempDir(), "system.pem")
+	defer func() { systemCABundle = saved }()
+	require.NoError(t, os.WriteFile(systemCABundle, []byte("system\n"), 0644))
+
+	ca := makeTestCACert(t, "ca")
+	dir, cleanup, err := prepareCACerts(ca)
+	require.NoError(t, err)
+	defer cleanup()
+	data, err := os.ReadFile(filepath.Join(dir, "ca.crt"))
+	require.NoError(t, err)
+	assert.Equal(t, ca, data)
+
+	resolver := newContainerResolver(arch.ARCH_X86_64, "", dir, 0)
+	require.IsType(t, &variantResolver{}, resolver)
+	assert.Equal(t, dir, resolver.(*variantResolver).certDir)
+
+	cleanup()
+	assert.NoDirExists(t, dir)
+
+	env, cleanup, err := prepareOsbuildCACerts(ca, &mTLSConfig{ca: []byte("mtls-ca")})
+	require.NoError(t, err)
+	defer cleanup()
+	require.Len(t, env, 1)
+	caPath := strings.TrimPrefix(env[0], "OSBUILD_SOURCES_CURL_SSL_CA_CERT=")
+	assert.Equal(t, "ca-bundle.pem", filepath.Base(caPath))
+	data, err = os.ReadFile(caPath)
+	require.NoError(t, err)
+	assert.Equal(t, "system\nmtls-ca\n"+string(ca), string(data))
+
+	cleanup()
+	assert.NoFileExists(t, caPath)
+}
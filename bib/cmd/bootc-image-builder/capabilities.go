@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sys/unix"
+
+	"github.com/osbuild/images/pkg/arch"
+
+	"github.com/osbuild/bootc-image-builder/bib/internal/setup"
+)
+
+var (
+	kvmDevice = "/dev/kvm"
+	// virtiofsd is usually not in $PATH
+	virtiofsdPaths = []string{"virtiofsd", "/usr/libexec/virtiofsd"}
+
+	// the canary binaries use the GOARCH names
+	canaryArches = []string{"amd64", "arm64", "s390x", "ppc64le"}
+)
+
+// hostCapabilities describes what the host can do, e.g. which target
+// architectures can be built
+type hostCapabilities struct {
+	HostArch     string   `json:"host_arch"`
+	TargetArches []string `json:"target_arches"`
+	KVM          bool     `json:"kvm"`
+	Virtiofsd    bool     `json:"virtiofsd"`
+	Swtpm        bool     `json:"swtpm"`
+}
+
+func hasBinary(names ...string) bool {
+	for _, name := range names {
+		if _, err := exec.LookPath(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func detectCapabilities() *hostCapabilities {
+	caps := &hostCapabilities{
+		HostArch:     arch.Current().String(),
+		TargetArches: []string{},
+		KVM:          unix.Access(kvmDevice, unix.R_OK|unix.W_OK) == nil,
+		Virtiofsd:    hasBinary(virtiofsdPaths...),
+		Swtpm:        hasBinary("swtpm"),
+	}
+	for _, goarch := range canaryArches {
+		if setup.CanRunTargetArch(goarch) {
+			caps.TargetArches = append(caps.TargetArches, arch.FromString(goarch).String())
+		}
+	}
+	return caps
+}
+
+func cmdCapabilities(cmd *cobra.Command, args []string) error {
+	enc := json.NewEncoder(osStdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(detectCapabilities())
+}
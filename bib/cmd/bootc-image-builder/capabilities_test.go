@@ -0,0 +1,64 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/arch"
+
+	main "github.com/osbuild/bootc-image-builder/bib/cmd/bootc-image-builder"
+)
+
+func TestCapabilitiesMockedEnv(t *testing.T) {
+	tmpdir := t.TempDir()
+	// only PATH is used to find the binaries
+	t.Setenv("PATH", tmpdir)
+	for _, name := range []string{"bib-canary-s390x", "swtpm", "virtiofsd"} {
+		err := os.WriteFile(filepath.Join(tmpdir, name), []byte("#!/bin/sh\necho ok\n"), 0755)
+		require.NoError(t, err)
+	}
+	// a canary that cannot be run
+	err := os.WriteFile(filepath.Join(tmpdir, "bib-canary-ppc64le"), nil, 0755)
+	require.NoError(t, err)
+	kvm := filepath.Join(tmpdir, "kvm")
+	require.NoError(t, os.WriteFile(kvm, nil, 0600))
+
+	for _, tc := range []struct {
+		kvm       string
+		virtiofsd []string
+		expected  map[string]interface{}
+	}{
+		{kvm, []string{"virtiofsd"}, map[string]interface{}{"kvm": true, "virtiofsd": true}},
+		{"/no/such/kvm", []string{"/no/such/virtiofsd"}, map[string]interface{}{"kvm": false, "virtiofsd": false}},
+	} {
+		restore := main.MockCapabilitiesEnv(tc.kvm, tc.virtiofsd)
+		defer restore()
+		var stdout bytes.Buffer
+		restore = main.MockOsStdout(&stdout)
+		defer restore()
+		restore = mockOsArgs([]string{"capabilities"})
+		defer restore()
+
+		rootCmd, err := main.BuildCobraCmdline()
+		require.NoError(t, err)
+		require.NoError(t, rootCmd.Execute())
+
+		var caps map[string]interface{}
+		require.NoError(t, json.Unmarshal(stdout.Bytes(), &caps))
+		expectedArches := []interface{}{arch.Current().String()}
+		if arch.Current() != arch.ARCH_S390X {
+			expectedArches = append(expectedArches, "s390x")
+		}
+		assert.Equal(t, arch.Current().String(), caps["host_arch"])
+		assert.ElementsMatch(t, expectedArches, caps["target_arches"])
+		assert.Equal(t, true, caps["swtpm"])
+		assert.Equal(t, tc.expected["kvm"], caps["kvm"])
+		assert.Equal(t, tc.expected["virtiofsd"], caps["virtiofsd"])
+	}
+}
@@ -1,12 +1,93 @@
 package main
 
 import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
 	"github.com/cheggaaa/pb/v3"
 	"github.com/osbuild/bootc-image-builder/bib/internal/uploader"
+	"github.com/osbuild/images/pkg/arch"
 	"github.com/osbuild/images/pkg/cloud/awscloud"
 	"github.com/spf13/pflag"
+	"golang.org/x/exp/slices"
 )
 
+// ec2Arches are the (rpm style) architectures that an AMI can be
+// registered with
+var ec2Arches = []string{"x86_64", "aarch64"}
+
+// awsRegisterArch returns the architecture that is used to register
+// the AMI, this is the architecture of the built image unless it is
+// overridden via --aws-arch
+func awsRegisterArch(flags *pflag.FlagSet, targetArch string) (string, error) {
+	override, err := flags.GetString("aws-arch")
+	if err != nil {
+		return "", err
+	}
+
+	registerArch := arch.Current().String()
+	if targetArch != "" {
+		a, err := archFromString(targetArch)
+		if err != nil {
+			return "", err
+		}
+		registerArch = a.String()
+	}
+	if override != "" {
+		a, err := archFromString(override)
+		if err != nil {
+			return "", fmt.Errorf("invalid --aws-arch: %w", err)
+		}
+		if a.String() != registerArch {
+			warnings.Warnf("registering the %s image as %s AMI", registerArch, a)
+		}
+		registerArch = a.String()
+	}
+	if !slices.Contains(ec2Arches, registerArch) {
+		return "", fmt.Errorf("cannot register AMI for architecture %q, supported: %s", registerArch, strings.Join(ec2Arches, ", "))
+	}
+	return registerArch, nil
+}
+
+var (
+	// these are variables so that they can be mocked in tests
+	osStdin           io.Reader = os.Stdin
+	newAWSImageFinder           = uploader.NewAWSImageFinder
+)
+
+// confirmAMIName checks if the account already has AMIs with the given
+// name and asks before another AMI with the same name is registered.
+// With assumeYes the existing AMIs are only reported.
+func confirmAMIName(finder uploader.ImageFinder, name string, assumeYes bool) error {
+	ids, err := finder.FindImagesByName(name)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	existing := strings.Join(ids, ", ")
+	if assumeYes {
+		warnings.Warnf("AMI name %q is already used by %s", name, existing)
+		return nil
+	}
+
+	fmt.Fprintf(osStderr, "AMI name %q is already used by %s, register another AMI with this name? [y/N] ", name, existing)
+	answer, err := bufio.NewReader(osStdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("cannot read confirmation: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	default:
+		return fmt.Errorf("aborted: AMI name %q is already used by %s (use --yes to register anyway)", name, existing)
+	}
+}
+
 func uploadAMI(path, targetArch string, flags *pflag.FlagSet) error {
 	region, err := flags.GetString("aws-region")
 	if err != nil {
@@ -24,8 +105,11 @@ func uploadAMI(path, targetArch string, flags *pflag.FlagSet) error {
 	if err != nil {
 		return err
 	}
-
-	client, err := awscloud.NewDefault(region)
+	resume, err := flags.GetBool("aws-resume")
+	if err != nil {
+		return err
+	}
+	registerArch, err := awsRegisterArch(flags, targetArch)
 	if err != nil {
 		return err
 	}
@@ -38,5 +122,17 @@ func uploadAMI(path, targetArch string, flags *pflag.FlagSet) error {
 		pbar = pb.New(0)
 	}
 
-	return uploader.UploadAndRegister(client, path, bucketName, imageName, targetArch, pbar)
+	if resume {
+		client, err := uploader.NewResumableAWS(region)
+		if err != nil {
+			return err
+		}
+		return uploader.UploadAndRegisterResumable(client, path, bucketName, imageName, registerArch, pbar)
+	}
+
+	client, err := awscloud.NewDefault(region)
+	if err != nil {
+		return err
+	}
+	return uploader.UploadAndRegister(client, path, bucketName, imageName, registerArch, pbar)
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/osbuild/images/pkg/arch"
+)
+
+func TestAWSRegisterArch(t *testing.T) {
+	for _, tc := range []struct {
+		targetArch  string
+		awsArch     string
+		expected    string
+		expectedErr string
+		warning     string
+	}{
+		{"", "", arch.Current().String(), "", ""},
+		{"amd64", "", "x86_64", "", ""},
+		{"arm64", "", "aarch64", "", ""},
+		{"aarch64", "arm64", "aarch64", "", ""},
+		{"amd64", "aarch64", "aarch64", "", "WARNING: registering the x86_64 image as aarch64 AMI\n"},
+		{"s390x", "", "", `cannot register AMI for architecture "s390x", supported: x86_64, aarch64`, ""},
+		{"amd64", "ppc64le", "", `cannot register AMI for architecture "ppc64le", supported: x86_64, aarch64`, "WARNING: registering the x86_64 image as ppc64le AMI\n"},
+		{"amd64", "i386", "", `invalid --aws-arch: unsupported architecture "i386", supported: amd64, x86_64, arm64, aarch64, s390x, ppc64le`, ""},
+	} {
+		var stderr bytes.Buffer
+		restore := MockWarnings(&stderr)
+		defer restore()
+
+		flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		flags.String("aws-arch", "", "")
+		if tc.awsArch != "" {
+			assert.NoError(t, flags.Set("aws-arch", tc.awsArch))
+		}
+
+		registerArch, err := awsRegisterArch(flags, tc.targetArch)
+		if tc.expectedErr != "" {
+			assert.EqualError(t, err, tc.expectedErr)
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, registerArch)
+		}
+		assert.Equal(t, tc.warning, stderr.String())
+	}
+}
+
+type fakeImageFinder struct {
+	ids   []string
+	err   error
+	names []string
+}
+
+func (f *fakeImageFinder) FindImagesByName(name string) ([]string, error) {
+	f.names = append(f.names, name)
+	return f.ids, f.err
+}
+
+func TestConfirmAMIName(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		existing    []string
+		assumeYes   bool
+		input       string
+		expectedErr string
+		prompt      string
+		warning     string
+	}{
+		{"no-existing", nil, false, "", "", "", ""},
+		{"confirmed", []string{"ami-1"}, false, "y\n", "", `AMI name "my-ami" is already used by ami-1, register another AMI with this name? [y/N] `, ""},
+		{"confirmed-yes", []string{"ami-1"}, false, " YES\n", "", `AMI name "my-ami" is already used by ami-1, register another AMI with this name? [y/N] `, ""},
+		{"declined", []string{"ami-1", "ami-2"}, false, "n\n", `aborted: AMI name "my-ami" is already used by ami-1, ami-2 (use --yes to register anyway)`, `AMI name "my-ami" is already used by ami-1, ami-2, register another AMI with this name? [y/N] `, ""},
+		{"default-no", []string{"ami-1"}, false, "\n", `aborted: AMI name "my-ami" is already used by ami-1 (use --yes to register anyway)`, `AMI name "my-ami" is already used by ami-1, register another AMI with this name? [y/N] `, ""},
+		{"no-input", []string{"ami-1"}, false, "", `aborted: AMI name "my-ami" is already used by ami-1 (use --yes to register anyway)`, `AMI name "my-ami" is already used by ami-1, register another AMI with this name? [y/N] `, ""},
+		{"assume-yes", []string{"ami-1"}, true, "", "", "", "WARNING: AMI name \"my-ami\" is already used by ami-1\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var stderr bytes.Buffer
+			restore := MockWarnings(&stderr)
+			defer restore()
+			savedStdin := osStdin
+			osStdin = strings.NewReader(tc.input)
+			defer func() { osStdin = savedStdin }()
+
+			finder := &fakeImageFinder{ids: tc.existing}
+			err := confirmAMIName(finder, "my-ami", tc.assumeYes)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, []string{"my-ami"}, finder.names)
+			assert.Equal(t, tc.prompt+tc.warning, stderr.String())
+		})
+	}
+}
+
+func TestConfirmAMINameLookupError(t *testing.T) {
+	finder := &fakeImageFinder{err: fmt.Errorf("access denied")}
+	assert.EqualError(t, confirmAMIName(finder, "my-ami", true), "access denied")
+}
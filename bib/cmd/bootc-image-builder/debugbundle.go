@@ -0,0 +1,86 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+
+	"github.com/osbuild/images/pkg/manifest"
+)
+
+// writeDebugBundle writes a gzip compressed tarball with the manifest,
+// the build log and the versions of bib and osbuild of a failed build
+// so that it can be attached to a bug report. The build log is the
+// output of osbuild followed by the error of the build.
+//
+// The osbuild store has no metadata of the failed pipeline to add:
+// osbuild only commits the objects of finished pipelines to the store,
+// the tree of the failing stage is discarded and its output is already
+// part of the build log.
+func writeDebugBundle(path string, mf manifest.OSBuildManifest, buildLog []byte, buildErr error) (err error) {
+	bibVersion, err := versionFromBuildInfo()
+	if err != nil {
+		return err
+	}
+	version := fmt.Sprintf("%sosbuild: %s\n", bibVersion, osbuildVersion())
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	fp, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("cannot create debug bundle: %w", err)
+	}
+	defer func() {
+		if cerr := fp.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("cannot create debug bundle: %w", cerr)
+		}
+	}()
+	gz := gzip.NewWriter(fp)
+	tw := tar.NewWriter(gz)
+
+	now := time.Now()
+	for _, f := range []struct {
+		name    string
+		content []byte
+	}{
+		{"manifest.json", mf},
+		{"build.log", append(slices.Clone(buildLog), []byte(buildErr.Error()+"\n")...)},
+		{"version.txt", []byte(version)},
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.content)), ModTime: now}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.content); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// maybeWriteDebugBundle writes the debug bundle of a failed build if
+// a path is given, errors are only logged as the build error is the
+// one that matters
+func maybeWriteDebugBundle(path string, mf manifest.OSBuildManifest, buildLog []byte, buildErr error, chown string) {
+	if path == "" {
+		return
+	}
+	if err := writeDebugBundle(path, mf, buildLog, buildErr); err != nil {
+		logrus.Warnf("cannot write debug bundle %q: %v", path, err)
+		return
+	}
+	if err := chownR(path, chown); err != nil {
+		logrus.Warnf("cannot setup owner for %q: %v", path, err)
+	}
+	fmt.Fprintf(osStderr, "Debug bundle of the failed build saved in %s\n", path)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/manifest"
+
+	"github.com/osbuild/bootc-image-builder/bib/pkg/progress"
+)
+
+func readDebugBundle(t *testing.T, path string) ([]string, map[string]string) {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+
+	content := make(map[string]string)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		names = append(names, hdr.Name)
+		content[hdr.Name] = string(data)
+	}
+	return names, content
+}
+
+func TestWriteDebugBundleFailedBuild(t *testing.T) {
+	saved := osbuildVersion
+	osbuildVersion = func() string { return "130" }
+	defer func() { osbuildVersion = saved }()
+
+	// the verbose progress runs osbuild without the JSON monitor, its
+	// error does not include the output
+	tmpdir := t.TempDir()
+	err := os.WriteFile(filepath.Join(tmpdir, "osbuild"), []byte(`#!/bin/sh
+cat > /dev/null
+echo osbuild-stdout-output
+>&2 echo "stage org.osbuild.bootc.install-to-filesystem failed"
+exit 1
+`), 0755)
+	require.NoError(t, err)
+	t.Setenv("PATH", tmpdir+":"+os.Getenv("PATH"))
+
+	pbar, err := progress.New("verbose")
+	require.NoError(t, err)
+	mf := manifest.OSBuildManifest(`{"version":"2","pipelines":[]}`)
+	var buildLog bytes.Buffer
+	osbuildErr := progress.RunOSBuild(pbar, mf, "/store", "/output", nil, nil, nil, &buildLog)
+	require.EqualError(t, osbuildErr, "running osbuild failed: exit status 1")
+	buildErr := osbuildError(osbuildErr, mf, "/output/manifest-qcow2.json")
+
+	path := filepath.Join(t.TempDir(), "debug/bundle.tgz")
+	require.NoError(t, writeDebugBundle(path, mf, buildLog.Bytes(), buildErr))
+
+	names, content := readDebugBundle(t, path)
+	assert.Equal(t, []string{"manifest.json", "build.log", "version.txt"}, names)
+	assert.Equal(t, string(mf), content["manifest.json"])
+	// stdout and stderr are not ordered
+	assert.Contains(t, content["build.log"], "osbuild-stdout-output\n")
+	assert.Contains(t, content["build.log"], "stage org.osbuild.bootc.install-to-filesystem failed\n")
+	assert.True(t, strings.HasSuffix(content["build.log"], "\n"+buildErr.Error()+"\n"))
+	assert.Contains(t, content["version.txt"], "build_revision: ")
+	assert.Contains(t, content["version.txt"], "osbuild: 130\n")
+}
+
+func TestMaybeWriteDebugBundle(t *testing.T) {
+	saved := osbuildVersion
+	osbuildVersion = func() string { return "130" }
+	defer func() { osbuildVersion = saved }()
+	var stderr bytes.Buffer
+	savedStderr := osStderr
+	osStderr = &stderr
+	defer func() { osStderr = savedStderr }()
+
+	mf := manifest.OSBuildManifest(`{}`)
+	buildErr := errors.New("boom")
+
+	// no path, no bundle
+	maybeWriteDebugBundle("", mf, nil, buildErr, "")
+	assert.Empty(t, stderr.String())
+
+	path := filepath.Join(t.TempDir(), "bundle.tgz")
+	maybeWriteDebugBundle(path, mf, nil, buildErr, "")
+	assert.FileExists(t, path)
+	assert.Equal(t, "Debug bundle of the failed build saved in "+path+"\n", stderr.String())
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/osbuild/images/pkg/dnfjson"
+	"github.com/osbuild/images/pkg/rpmmd"
+	"github.com/osbuild/images/pkg/sbom"
+)
+
+// timeoutDepsolver aborts a depsolve that takes longer than the
+// timeout. The dnfjson.Solver cannot be cancelled (it has no context
+// support), the abandoned dnf-json process goes away when bib exits.
+type timeoutDepsolver struct {
+	solver  depsolver
+	timeout time.Duration
+}
+
+func (s *timeoutDepsolver) Depsolve(pkgSets []rpmmd.PackageSet, sbomType sbom.StandardType) (*dnfjson.DepsolveResult, error) {
+	type result struct {
+		res *dnfjson.DepsolveResult
+		err error
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		res, err := s.solver.Depsolve(pkgSets, sbomType)
+		resCh <- result{res, err}
+	}()
+
+	select {
+	case r := <-resCh:
+		return r.res, r.err
+	case <-time.After(s.timeout):
+		return nil, fmt.Errorf("depsolve did not finish within %v (see --depsolve-timeout)", s.timeout)
+	}
+}
+
+// withDepsolveTimeout limits the time of each depsolve of the solver,
+// no limit is used for a zero timeout
+func withDepsolveTimeout(solver depsolver, timeout time.Duration) depsolver {
+	if timeout <= 0 {
+		return solver
+	}
+	return &timeoutDepsolver{solver: solver, timeout: timeout}
+}
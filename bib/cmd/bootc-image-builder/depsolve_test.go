@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/dnfjson"
+	"github.com/osbuild/images/pkg/rpmmd"
+	"github.com/osbuild/images/pkg/sbom"
+)
+
+type slowDepsolver struct {
+	delay time.Duration
+	done  chan struct{}
+}
+
+func (s *slowDepsolver) Depsolve(pkgSets []rpmmd.PackageSet, sbomType sbom.StandardType) (*dnfjson.DepsolveResult, error) {
+	select {
+	case <-time.After(s.delay):
+	case <-s.done:
+	}
+	return &dnfjson.DepsolveResult{}, nil
+}
+
+func TestDepsolveTimeoutAbortsSlowDepsolve(t *testing.T) {
+	solver := &slowDepsolver{delay: time.Hour, done: make(chan struct{})}
+	defer close(solver.done)
+
+	start := time.Now()
+	_, err := withDepsolveTimeout(solver, 10*time.Millisecond).Depsolve(nil, 0)
+	assert.EqualError(t, err, "depsolve did not finish within 10ms (see --depsolve-timeout)")
+	assert.Less(t, time.Since(start), time.Minute)
+}
+
+func TestDepsolveTimeoutFastDepsolve(t *testing.T) {
+	solver := &slowDepsolver{done: make(chan struct{})}
+	defer close(solver.done)
+
+	res, err := withDepsolveTimeout(solver, time.Minute).Depsolve(nil, 0)
+	require.NoError(t, err)
+	assert.NotNil(t, res)
+
+	// no timeout returns the solver unchanged
+	assert.Equal(t, depsolver(solver), withDepsolveTimeout(solver, 0))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slices"
+
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+// DepsolveOptions are the dnf options of the depsolve that can be set
+// with --depsolve-option, nil means the default of the depsolver
+type DepsolveOptions struct {
+	InstallWeakDeps *bool `json:"install_weak_deps,omitempty"`
+}
+
+// unsupportedDepsolveOptions are dnf options that are known but cannot
+// be passed to osbuild-depsolve-dnf (the dnfjson API has no field for
+// them)
+var unsupportedDepsolveOptions = []string{"allow_erasing", "best"}
+
+// parseDepsolveOptions parses the "key=value" --depsolve-option
+// arguments
+func parseDepsolveOptions(args []string) (*DepsolveOptions, error) {
+	var opts DepsolveOptions
+	seen := make(map[string]bool, len(args))
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("invalid depsolve option %q, expected key=value", arg)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("depsolve option %q given multiple times", key)
+		}
+		seen[key] = true
+
+		switch key {
+		case "install_weak_deps":
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q for depsolve option %q, expected a boolean", value, key)
+			}
+			opts.InstallWeakDeps = &b
+		default:
+			if slices.Contains(unsupportedDepsolveOptions, key) {
+				return nil, fmt.Errorf("depsolve option %q is not supported by the depsolver", key)
+			}
+			return nil, fmt.Errorf("unknown depsolve option %q, supported: install_weak_deps", key)
+		}
+	}
+	return &opts, nil
+}
+
+// validateDepsolveOptions checks that the depsolve options agree with
+// --no-weak-deps
+func validateDepsolveOptions(opts *DepsolveOptions, noWeakDeps bool) error {
+	if opts != nil && opts.InstallWeakDeps != nil && *opts.InstallWeakDeps && noWeakDeps {
+		return fmt.Errorf("--no-weak-deps conflicts with --depsolve-option install_weak_deps=true")
+	}
+	return nil
+}
+
+// applyDepsolveOptions sets the depsolve options on the package sets
+func applyDepsolveOptions(pkgSets []rpmmd.PackageSet, opts *DepsolveOptions) {
+	if opts == nil || opts.InstallWeakDeps == nil {
+		return
+	}
+	for i := range pkgSets {
+		pkgSets[i].InstallWeakDeps = *opts.InstallWeakDeps
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+func TestParseDepsolveOptions(t *testing.T) {
+	opts, err := parseDepsolveOptions(nil)
+	require.NoError(t, err)
+	assert.Nil(t, opts.InstallWeakDeps)
+
+	opts, err = parseDepsolveOptions([]string{"install_weak_deps=false"})
+	require.NoError(t, err)
+	require.NotNil(t, opts.InstallWeakDeps)
+	assert.False(t, *opts.InstallWeakDeps)
+
+	opts, err = parseDepsolveOptions([]string{"install_weak_deps=1"})
+	require.NoError(t, err)
+	require.NotNil(t, opts.InstallWeakDeps)
+	assert.True(t, *opts.InstallWeakDeps)
+}
+
+func TestParseDepsolveOptionsErrors(t *testing.T) {
+	for _, tc := range []struct {
+		args        []string
+		expectedErr string
+	}{
+		{[]string{"install_weak_deps"}, `invalid depsolve option "install_weak_deps", expected key=value`},
+		{[]string{"=false"}, `invalid depsolve option "=false", expected key=value`},
+		{[]string{"install_weak_deps=maybe"}, `invalid value "maybe" for depsolve option "install_weak_deps", expected a boolean`},
+		{[]string{"install_weak_deps=true", "install_weak_deps=false"}, `depsolve option "install_weak_deps" given multiple times`},
+		{[]string{"best=false"}, `depsolve option "best" is not supported by the depsolver`},
+		{[]string{"allow_erasing=true"}, `depsolve option "allow_erasing" is not supported by the depsolver`},
+		{[]string{"gpgcheck=false"}, `unknown depsolve option "gpgcheck", supported: install_weak_deps`},
+	} {
+		_, err := parseDepsolveOptions(tc.args)
+		assert.EqualError(t, err, tc.expectedErr)
+	}
+}
+
+func TestValidateDepsolveOptions(t *testing.T) {
+	yes, no := true, false
+	assert.NoError(t, validateDepsolveOptions(nil, true))
+	assert.NoError(t, validateDepsolveOptions(&DepsolveOptions{InstallWeakDeps: &no}, true))
+	assert.NoError(t, validateDepsolveOptions(&DepsolveOptions{InstallWeakDeps: &yes}, false))
+	assert.EqualError(t, validateDepsolveOptions(&DepsolveOptions{InstallWeakDeps: &yes}, true), "--no-weak-deps conflicts with --depsolve-option install_weak_deps=true")
+}
+
+func TestApplyDepsolveOptions(t *testing.T) {
+	no := false
+	pkgSets := []rpmmd.PackageSet{{InstallWeakDeps: true}, {InstallWeakDeps: true}}
+
+	applyDepsolveOptions(pkgSets, &DepsolveOptions{})
+	assert.True(t, pkgSets[0].InstallWeakDeps)
+
+	applyDepsolveOptions(pkgSets, &DepsolveOptions{InstallWeakDeps: &no})
+	for _, pkgSet := range pkgSets {
+		assert.False(t, pkgSet.InstallWeakDeps)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// osStderr is a variable so that it can be mocked in tests
+var osStderr io.Writer = os.Stderr
+
+// diagnostics collects the warnings of a run. Warnings are printed
+// right away but they are easily lost in the (long) build output so
+// they are summarized again at the end of the build.
+type diagnostics struct {
+	mu       sync.Mutex
+	warnings []string
+}
+
+// warnings are the collected warnings of this run
+var warnings = &diagnostics{}
+
+// Warnf prints the warning and records it for the summary
+func (d *diagnostics) Warnf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.warnings = append(d.warnings, msg)
+	fmt.Fprintf(osStderr, "WARNING: %s\n", msg)
+}
+
+// Warnings returns all warnings recorded so far
+func (d *diagnostics) Warnings() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.warnings...)
+}
+
+// PrintSummary prints all recorded warnings (if any) to the given
+// writer
+func (d *diagnostics) PrintSummary(w io.Writer) {
+	warnings := d.Warnings()
+	if len(warnings) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Build finished with %d warning(s):\n", len(warnings))
+	for _, msg := range warnings {
+		fmt.Fprintf(w, "  - %s\n", msg)
+	}
+}
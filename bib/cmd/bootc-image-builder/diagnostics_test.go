@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarningsCollectedAndSummarized(t *testing.T) {
+	var stderr bytes.Buffer
+	restore := MockWarnings(&stderr)
+	defer restore()
+
+	var summary bytes.Buffer
+	warnings.PrintSummary(&summary)
+	assert.Equal(t, "", summary.String())
+
+	warnings.Warnf("target-arch is experimental")
+	warnings.Warnf("running outside a %s", "container")
+	// warnings are shown right away
+	assert.Equal(t, "WARNING: target-arch is experimental\nWARNING: running outside a container\n", stderr.String())
+	assert.Equal(t, []string{"target-arch is experimental", "running outside a container"}, warnings.Warnings())
+
+	warnings.PrintSummary(&summary)
+	assert.Equal(t, `Build finished with 2 warning(s):
+  - target-arch is experimental
+  - running outside a container
+`, summary.String())
+}
+
+func TestWarningsInBuildResult(t *testing.T) {
+	restore := MockWarnings(io.Discard)
+	defer restore()
+	warnings.Warnf("running outside a container, this is an unsupported configuration")
+
+	outputDir := t.TempDir()
+	_, err := writeBuildResult(outputDir, "quay.io/example/os:latest", []string{"qcow2"}, nil, nil, "", "")
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "build-result.json"))
+	require.NoError(t, err)
+	var res buildResult
+	require.NoError(t, json.Unmarshal(data, &res))
+	assert.Equal(t, []string{"running outside a container, this is an unsupported configuration"}, res.Warnings)
+}
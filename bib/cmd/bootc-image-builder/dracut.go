@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var dracutModuleRE = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// validateDracutModules checks the --dracut-add-module arguments. The
+// modules are only added to the initramfs of the ISO installer, disk
+// images always use the initramfs that is shipped in the container.
+func validateDracutModules(modules []string, buildsISO bool) error {
+	if len(modules) == 0 {
+		return nil
+	}
+	if !buildsISO {
+		return fmt.Errorf("--dracut-add-module is only supported for the anaconda-iso image type, disk images use the initramfs of the container")
+	}
+	for _, module := range modules {
+		if !dracutModuleRE.MatchString(module) {
+			return fmt.Errorf("invalid dracut module name %q", module)
+		}
+	}
+	return nil
+}
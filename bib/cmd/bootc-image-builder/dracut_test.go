@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateDracutModules(t *testing.T) {
+	assert.NoError(t, validateDracutModules(nil, false))
+	assert.NoError(t, validateDracutModules([]string{"nvdimm", "kernel-modules-extra", "90_custom"}, true))
+
+	err := validateDracutModules([]string{"nvdimm"}, false)
+	assert.EqualError(t, err, "--dracut-add-module is only supported for the anaconda-iso image type, disk images use the initramfs of the container")
+
+	for _, bad := range []string{"", "-omit", "two words", "../etc", "mod;rm"} {
+		err := validateDracutModules([]string{bad}, true)
+		assert.EqualError(t, err, `invalid dracut module name "`+bad+`"`)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/osbuild/bootc-image-builder/bib/internal/setup"
+)
+
+var (
+	// these are variables so that they can be mocked in tests
+	inContainer            = inContainerOrUnknown
+	setupEnsureEnvironment = setup.EnsureEnvironment
+)
+
+// ensureEnvironment prepares the container for running osbuild, this
+// is skipped if the caller set up the environment already
+// (--skip-environment-setup)
+func ensureEnvironment(storePath string, skip bool) error {
+	if skip {
+		logrus.Debug("Skipping environment setup")
+		return nil
+	}
+	logrus.Debug("Ensuring environment setup")
+	switch inContainer() {
+	case false:
+		warnings.Warnf("running outside a container, this is an unsupported configuration")
+	case true:
+		if err := setupEnsureEnvironment(storePath); err != nil {
+			return fmt.Errorf("cannot ensure the environment: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mockEnsureEnvironment(t *testing.T, container bool, err error) *[]string {
+	var calls []string
+	savedInContainer, savedEnsure := inContainer, setupEnsureEnvironment
+	inContainer = func() bool { return container }
+	setupEnsureEnvironment = func(storePath string) error {
+		calls = append(calls, storePath)
+		return err
+	}
+	t.Cleanup(func() {
+		inContainer, setupEnsureEnvironment = savedInContainer, savedEnsure
+	})
+	return &calls
+}
+
+func TestEnsureEnvironment(t *testing.T) {
+	calls := mockEnsureEnvironment(t, true, nil)
+
+	assert.NoError(t, ensureEnvironment("/store", false))
+	assert.Equal(t, []string{"/store"}, *calls)
+}
+
+func TestEnsureEnvironmentSkip(t *testing.T) {
+	calls := mockEnsureEnvironment(t, true, fmt.Errorf("must not be called"))
+
+	assert.NoError(t, ensureEnvironment("/store", true))
+	assert.Empty(t, *calls)
+}
+
+func TestEnsureEnvironmentError(t *testing.T) {
+	mockEnsureEnvironment(t, true, fmt.Errorf("mount failed"))
+
+	assert.EqualError(t, ensureEnvironment("/store", false), "cannot ensure the environment: mount failed")
+}
+
+func TestEnsureEnvironmentOutsideContainer(t *testing.T) {
+	calls := mockEnsureEnvironment(t, false, nil)
+	var stderr bytes.Buffer
+	savedWarnings, savedStderr := warnings, osStderr
+	warnings, osStderr = &diagnostics{}, &stderr
+	defer func() { warnings, osStderr = savedWarnings, savedStderr }()
+
+	assert.NoError(t, ensureEnvironment("/store", false))
+	assert.Empty(t, *calls)
+	assert.Equal(t, []string{"running outside a container, this is an unsupported configuration"}, warnings.Warnings())
+}
@@ -1,5 +1,11 @@
 package main
 
+import (
+	"io"
+
+	"github.com/osbuild/images/pkg/arch"
+)
+
 var (
 	CanChownInPath                = canChownInPath
 	CheckFilesystemCustomizations = checkFilesystemCustomizations
@@ -11,6 +17,24 @@ var (
 	CreateRand                    = createRand
 	BuildCobraCmdline             = buildCobraCmdline
 	CalcRequiredDirectorySizes    = calcRequiredDirectorySizes
+	MakeManifest                  = makeManifest
+	TargetArchAndVariant          = targetArchAndVariant
+	SaveManifest                  = saveManifest
+	ManifestSavePath              = manifestSavePath
+	ChownStore                    = chownStore
+	KernelCmdlineForTypes         = kernelCmdlineForTypes
+	FindArtifacts                 = findArtifacts
+	RunPostBuild                  = runPostBuild
+	AddUser                       = addUser
+	DefsPathsFromFlags            = defsPathsFromFlags
+	ValidateSSHKeys               = validateSSHKeys
+	OverrideOSRelease             = overrideOSRelease
+	GenerateManifest              = generateManifest
+	OsbuildError                  = osbuildError
+	WritePackageList              = writePackageList
+	PlaintextPasswordUsers        = plaintextPasswordUsers
+	ManifestPipelines             = manifestPipelines
+	SerializeTestManifest         = serializeTestManifest
 )
 
 func MockOsGetuid(new func() int) (restore func()) {
@@ -20,3 +44,51 @@ func MockOsGetuid(new func() int) (restore func()) {
 		osGetuid = saved
 	}
 }
+
+type ContainerResolver = containerResolver
+
+func MockNewContainerResolver(new func(architecture arch.Arch, variant, certDir string, concurrency int) ContainerResolver) (restore func()) {
+	saved := newContainerResolver
+	newContainerResolver = new
+	return func() {
+		newContainerResolver = saved
+	}
+}
+
+func MockLocalImageExists(new func(imgref string) bool) (restore func()) {
+	saved := localImageExists
+	localImageExists = new
+	return func() {
+		localImageExists = saved
+	}
+}
+
+func MockOsStdout(new io.Writer) (restore func()) {
+	saved := osStdout
+	osStdout = new
+	return func() {
+		osStdout = saved
+	}
+}
+
+// MockWarnings replaces the warnings collector with an empty one that
+// prints to the given writer
+func MockWarnings(stderr io.Writer) (restore func()) {
+	savedWarnings, savedStderr := warnings, osStderr
+	warnings, osStderr = &diagnostics{}, stderr
+	return func() {
+		warnings, osStderr = savedWarnings, savedStderr
+	}
+}
+
+func Warnings() []string {
+	return warnings.Warnings()
+}
+
+func MockCapabilitiesEnv(kvm string, virtiofsd []string) (restore func()) {
+	savedKVM, savedVirtiofsd := kvmDevice, virtiofsdPaths
+	kvmDevice, virtiofsdPaths = kvm, virtiofsd
+	return func() {
+		kvmDevice, virtiofsdPaths = savedKVM, savedVirtiofsd
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// filterExports returns the exports that are selected via --only-export,
+// all exports are returned if nothing is selected
+func filterExports(exports, only []string) ([]string, error) {
+	if len(only) == 0 {
+		return exports, nil
+	}
+	var filtered []string
+	for _, export := range only {
+		if !slices.Contains(exports, export) {
+			return nil, fmt.Errorf("cannot use export %q, available exports: %s", export, strings.Join(exports, ", "))
+		}
+		if !slices.Contains(filtered, export) {
+			filtered = append(filtered, export)
+		}
+	}
+	return filtered, nil
+}
+
+// manifestPipelines returns the names of all pipelines of the given
+// osbuild manifest
+func manifestPipelines(mf []byte) ([]string, error) {
+	var manifest struct {
+		Pipelines []struct {
+			Name string `json:"name"`
+		} `json:"pipelines"`
+	}
+	if err := json.Unmarshal(mf, &manifest); err != nil {
+		return nil, fmt.Errorf("cannot parse manifest: %w", err)
+	}
+	names := make([]string, 0, len(manifest.Pipelines))
+	for _, pipeline := range manifest.Pipelines {
+		names = append(names, pipeline.Name)
+	}
+	return names, nil
+}
+
+// validateCheckpoints ensures that all --checkpoint pipelines exist
+// in the manifest
+func validateCheckpoints(mf []byte, checkpoints []string) error {
+	if len(checkpoints) == 0 {
+		return nil
+	}
+	pipelines, err := manifestPipelines(mf)
+	if err != nil {
+		return err
+	}
+	for _, checkpoint := range checkpoints {
+		if !slices.Contains(pipelines, checkpoint) {
+			return fmt.Errorf("cannot checkpoint %q, available pipelines: %s", checkpoint, strings.Join(pipelines, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/bootc-image-builder/bib/pkg/progress"
+)
+
+func TestFilterExports(t *testing.T) {
+	exports := []string{"qcow2", "image", "bootiso"}
+
+	for _, tc := range []struct {
+		only     []string
+		expected []string
+		expErr   string
+	}{
+		{nil, []string{"qcow2", "image", "bootiso"}, ""},
+		{[]string{"qcow2"}, []string{"qcow2"}, ""},
+		{[]string{"bootiso", "qcow2", "bootiso"}, []string{"bootiso", "qcow2"}, ""},
+		{[]string{"vmdk"}, nil, `cannot use export "vmdk", available exports: qcow2, image, bootiso`},
+	} {
+		filtered, err := filterExports(exports, tc.only)
+		if tc.expErr != "" {
+			assert.EqualError(t, err, tc.expErr)
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, filtered)
+		}
+	}
+}
+
+func TestOnlyExportReachesOsbuild(t *testing.T) {
+	tmpdir := t.TempDir()
+	argsFile := filepath.Join(tmpdir, "args")
+	err := os.WriteFile(filepath.Join(tmpdir, "osbuild"), []byte(fmt.Sprintf("#!/bin/sh\ncat > /dev/null\necho \"$@\" > %s\n", argsFile)), 0755)
+	require.NoError(t, err)
+	t.Setenv("PATH", tmpdir+":"+os.Getenv("PATH"))
+
+	exports, err := filterExports([]string{"qcow2", "image"}, []string{"qcow2"})
+	require.NoError(t, err)
+
+	pbar, err := progress.New("verbose")
+	require.NoError(t, err)
+	err = progress.RunOSBuild(pbar, []byte(`{"fake":"manifest"}`), "/store", "/output", exports, nil, nil, nil)
+	require.NoError(t, err)
+
+	args, err := os.ReadFile(argsFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(args), "--export qcow2")
+	assert.NotContains(t, string(args), "--export image")
+}
+
+func TestValidateCheckpoints(t *testing.T) {
+	mf := []byte(`{"version": "2", "pipelines": [{"name": "build"}, {"name": "image"}, {"name": "qcow2"}]}`)
+
+	assert.NoError(t, validateCheckpoints(mf, nil))
+	assert.NoError(t, validateCheckpoints(mf, []string{"image"}))
+	assert.NoError(t, validateCheckpoints(mf, []string{"build", "image"}))
+	err := validateCheckpoints(mf, []string{"image", "ostree-deployment"})
+	assert.EqualError(t, err, `cannot checkpoint "ostree-deployment", available pipelines: build, image, qcow2`)
+	err = validateCheckpoints([]byte(`not-json`), []string{"image"})
+	assert.ErrorContains(t, err, "cannot parse manifest: ")
+}
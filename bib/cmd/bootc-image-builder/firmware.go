@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/osbuild/images/pkg/platform"
+)
+
+// firmwareBootModes maps the --firmware values to the boot modes, if
+// no firmware is given the default firmware of the architecture is
+// used (hybrid on x86_64)
+var firmwareBootModes = map[string]platform.BootMode{
+	"bios":   platform.BOOT_LEGACY,
+	"uefi":   platform.BOOT_UEFI,
+	"hybrid": platform.BOOT_HYBRID,
+}
+
+// validateFirmware checks that the firmware can be used for disk
+// images of the given architecture
+func validateFirmware(firmware string, a arch.Arch) error {
+	if firmware == "" {
+		return nil
+	}
+	if _, ok := firmwareBootModes[firmware]; !ok {
+		return fmt.Errorf("unsupported firmware %q, supported: bios, uefi, hybrid", firmware)
+	}
+	switch {
+	case a == arch.ARCH_X86_64:
+		return nil
+	case a == arch.ARCH_AARCH64 && firmware == "uefi":
+		return nil
+	}
+	return fmt.Errorf("firmware %q is not supported on %s", firmware, a)
+}
+
+// partitionTableForFirmware returns the base partition table without
+// the boot partition that the firmware does not need: the BIOS boot
+// partition for uefi and the ESP for bios
+func partitionTableForFirmware(pt disk.PartitionTable, firmware string) disk.PartitionTable {
+	var unneeded string
+	switch firmware {
+	case "uefi":
+		unneeded = disk.BIOSBootPartitionGUID
+	case "bios":
+		unneeded = disk.EFISystemPartitionGUID
+	default:
+		return pt
+	}
+	// the partitions are shared with the base partition table
+	partitions := make([]disk.Partition, 0, len(pt.Partitions))
+	for _, part := range pt.Partitions {
+		if part.Type != unneeded {
+			partitions = append(partitions, part)
+		}
+	}
+	pt.Partitions = partitions
+	return pt
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/osbuild/images/pkg/arch"
+)
+
+func TestValidateFirmware(t *testing.T) {
+	for _, tc := range []struct {
+		firmware    string
+		arch        arch.Arch
+		expectedErr string
+	}{
+		{"", arch.ARCH_X86_64, ""},
+		{"", arch.ARCH_S390X, ""},
+		{"bios", arch.ARCH_X86_64, ""},
+		{"uefi", arch.ARCH_X86_64, ""},
+		{"hybrid", arch.ARCH_X86_64, ""},
+		{"uefi", arch.ARCH_AARCH64, ""},
+		{"bios", arch.ARCH_AARCH64, `firmware "bios" is not supported on aarch64`},
+		{"hybrid", arch.ARCH_AARCH64, `firmware "hybrid" is not supported on aarch64`},
+		{"uefi", arch.ARCH_PPC64LE, `firmware "uefi" is not supported on ppc64le`},
+		{"coreboot", arch.ARCH_X86_64, `unsupported firmware "coreboot", supported: bios, uefi, hybrid`},
+	} {
+		err := validateFirmware(tc.firmware, tc.arch)
+		if tc.expectedErr != "" {
+			assert.EqualError(t, err, tc.expectedErr)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+}
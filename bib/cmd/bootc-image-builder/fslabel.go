@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/osbuild/images/pkg/disk"
+)
+
+// fsLabelMaxLen is the maximum label length supported by mkfs for the
+// given filesystem type
+var fsLabelMaxLen = map[string]int{
+	"ext4":  16,
+	"xfs":   12,
+	"btrfs": 255,
+	"vfat":  11,
+}
+
+var (
+	fsLabelRE     = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+	vfatFSLabelRE = regexp.MustCompile(`^[A-Z0-9_-]+$`)
+)
+
+// parseFSLabels parses the "mountpoint=LABEL" --fs-label arguments into
+// a map of mountpoints and their labels.
+func parseFSLabels(args []string) (map[string]string, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(args))
+	for _, arg := range args {
+		mountpoint, label, ok := strings.Cut(arg, "=")
+		if !ok || !strings.HasPrefix(mountpoint, "/") || label == "" {
+			return nil, fmt.Errorf("invalid filesystem label %q, expected mountpoint=LABEL", arg)
+		}
+		if _, ok := labels[mountpoint]; ok {
+			return nil, fmt.Errorf("filesystem label for %q given multiple times", mountpoint)
+		}
+		labels[mountpoint] = label
+	}
+	return labels, nil
+}
+
+func validateFSLabel(fsType, label string) error {
+	maxLen, ok := fsLabelMaxLen[fsType]
+	if !ok {
+		return fmt.Errorf("cannot set label for filesystem type %q", fsType)
+	}
+	if len(label) > maxLen {
+		return fmt.Errorf("label %q is too long for %s (max %d characters)", label, fsType, maxLen)
+	}
+	re := fsLabelRE
+	if fsType == "vfat" {
+		re = vfatFSLabelRE
+	}
+	if !re.MatchString(label) {
+		return fmt.Errorf("label %q contains invalid characters for %s, allowed: %s", label, fsType, re.String())
+	}
+	return nil
+}
+
+// setFSLabels overrides the labels of the filesystems mounted at the
+// given mountpoints. Filesystems without an override keep their default
+// label.
+func setFSLabels(pt *disk.PartitionTable, labels map[string]string) error {
+	if len(labels) == 0 {
+		return nil
+	}
+	found := make(map[string]bool, len(labels))
+	err := pt.ForEachMountable(func(mnt disk.Mountable, _ []disk.Entity) error {
+		label, ok := labels[mnt.GetMountpoint()]
+		if !ok {
+			return nil
+		}
+		fs, ok := mnt.(*disk.Filesystem)
+		if !ok {
+			return fmt.Errorf("cannot set label for %q: not a filesystem but %T", mnt.GetMountpoint(), mnt)
+		}
+		if err := validateFSLabel(fs.Type, label); err != nil {
+			return fmt.Errorf("cannot set label for %q: %w", fs.Mountpoint, err)
+		}
+		fs.Label = label
+		found[fs.Mountpoint] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for mountpoint := range labels {
+		if !found[mountpoint] {
+			missing = append(missing, mountpoint)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("cannot set label for %s: no such filesystem in the partition table", strings.Join(missing, ", "))
+	}
+	return nil
+}
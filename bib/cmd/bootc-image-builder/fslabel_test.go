@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFSLabels(t *testing.T) {
+	labels, err := parseFSLabels(nil)
+	require.NoError(t, err)
+	assert.Nil(t, labels)
+
+	labels, err = parseFSLabels([]string{"/=myroot", "/boot/efi=MYESP"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"/": "myroot", "/boot/efi": "MYESP"}, labels)
+
+	for _, bad := range []string{"no-equal-sign", "=label", "/boot=", "boot=label"} {
+		_, err := parseFSLabels([]string{bad})
+		assert.EqualError(t, err, `invalid filesystem label "`+bad+`", expected mountpoint=LABEL`)
+	}
+	_, err = parseFSLabels([]string{"/=a", "/=b"})
+	assert.EqualError(t, err, `filesystem label for "/" given multiple times`)
+}
+
+func TestValidateFSLabel(t *testing.T) {
+	for _, tc := range []struct {
+		fsType string
+		label  string
+		expErr string
+	}{
+		{"ext4", "root-2024_a.b", ""},
+		{"ext4", "0123456789abcdef", ""},
+		{"ext4", "0123456789abcdefg", `label "0123456789abcdefg" is too long for ext4 (max 16 characters)`},
+		{"xfs", "0123456789ab", ""},
+		{"xfs", "0123456789abc", `label "0123456789abc" is too long for xfs (max 12 characters)`},
+		{"btrfs", "with space", `label "with space" contains invalid characters for btrfs, allowed: ^[A-Za-z0-9._-]+$`},
+		{"vfat", "EFI-SYS", ""},
+		{"vfat", "efi", `label "efi" contains invalid characters for vfat, allowed: ^[A-Z0-9_-]+$`},
+		{"swap", "swap", `cannot set label for filesystem type "swap"`},
+	} {
+		t.Run(tc.fsType+"/"+tc.label, func(t *testing.T) {
+			err := validateFSLabel(tc.fsType, tc.label)
+			if tc.expErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/osbuild/images/pkg/disk"
+)
+
+var (
+	fsUUIDRE = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	// vfat has no uuids but a volume id, e.g. "7B77-95E7"
+	vfatFSUUIDRE = regexp.MustCompile(`^[0-9a-fA-F]{4}-[0-9a-fA-F]{4}$`)
+)
+
+// parseFSUUIDs parses the "mountpoint=UUID" --fs-uuid arguments into a
+// map of mountpoints and their UUIDs.
+func parseFSUUIDs(args []string) (map[string]string, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	uuids := make(map[string]string, len(args))
+	seen := make(map[string]string, len(args))
+	for _, arg := range args {
+		mountpoint, uuid, ok := strings.Cut(arg, "=")
+		if !ok || !strings.HasPrefix(mountpoint, "/") || uuid == "" {
+			return nil, fmt.Errorf("invalid filesystem uuid %q, expected mountpoint=UUID", arg)
+		}
+		if _, ok := uuids[mountpoint]; ok {
+			return nil, fmt.Errorf("filesystem uuid for %q given multiple times", mountpoint)
+		}
+		if other, ok := seen[strings.ToLower(uuid)]; ok {
+			return nil, fmt.Errorf("filesystem uuid %q is used for %q and %q", uuid, other, mountpoint)
+		}
+		uuids[mountpoint] = uuid
+		seen[strings.ToLower(uuid)] = mountpoint
+	}
+	return uuids, nil
+}
+
+func validateFSUUID(fsType, uuid string) error {
+	re := fsUUIDRE
+	if fsType == "vfat" {
+		re = vfatFSUUIDRE
+	}
+	if !re.MatchString(uuid) {
+		return fmt.Errorf("invalid uuid %q for %s, must match %s", uuid, fsType, re.String())
+	}
+	return nil
+}
+
+// setFSUUIDs overrides the (random) UUIDs of the filesystems mounted at
+// the given mountpoints.
+func setFSUUIDs(pt *disk.PartitionTable, uuids map[string]string) error {
+	if len(uuids) == 0 {
+		return nil
+	}
+	found := make(map[string]bool, len(uuids))
+	err := pt.ForEachMountable(func(mnt disk.Mountable, _ []disk.Entity) error {
+		uuid, ok := uuids[mnt.GetMountpoint()]
+		if !ok {
+			return nil
+		}
+		fs, ok := mnt.(*disk.Filesystem)
+		if !ok {
+			return fmt.Errorf("cannot set uuid for %q: not a filesystem but %T", mnt.GetMountpoint(), mnt)
+		}
+		if err := validateFSUUID(fs.Type, uuid); err != nil {
+			return fmt.Errorf("cannot set uuid for %q: %w", fs.Mountpoint, err)
+		}
+		fs.UUID = uuid
+		found[fs.Mountpoint] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for mountpoint := range uuids {
+		if !found[mountpoint] {
+			missing = append(missing, mountpoint)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("cannot set uuid for %s: no such filesystem in the partition table", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFSUUIDs(t *testing.T) {
+	uuids, err := parseFSUUIDs(nil)
+	require.NoError(t, err)
+	assert.Nil(t, uuids)
+
+	uuids, err = parseFSUUIDs([]string{"/=6e2ba8a4-ae4e-4c3b-8a56-7c8e2c6a9c1d", "/boot/efi=1234-ABCD"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"/": "6e2ba8a4-ae4e-4c3b-8a56-7c8e2c6a9c1d", "/boot/efi": "1234-ABCD"}, uuids)
+
+	for _, bad := range []string{"no-equal-sign", "=1234-ABCD", "/boot=", "boot=1234-ABCD"} {
+		_, err := parseFSUUIDs([]string{bad})
+		assert.EqualError(t, err, `invalid filesystem uuid "`+bad+`", expected mountpoint=UUID`)
+	}
+	_, err = parseFSUUIDs([]string{"/=1234-ABCD", "/=1234-ABCE"})
+	assert.EqualError(t, err, `filesystem uuid for "/" given multiple times`)
+	_, err = parseFSUUIDs([]string{"/=6e2ba8a4-ae4e-4c3b-8a56-7c8e2c6a9c1d", "/boot=6E2BA8A4-AE4E-4C3B-8A56-7C8E2C6A9C1D"})
+	assert.EqualError(t, err, `filesystem uuid "6E2BA8A4-AE4E-4C3B-8A56-7C8E2C6A9C1D" is used for "/" and "/boot"`)
+}
+
+func TestValidateFSUUID(t *testing.T) {
+	for _, tc := range []struct {
+		fsType string
+		uuid   string
+		expErr string
+	}{
+		{"ext4", "6e2ba8a4-ae4e-4c3b-8a56-7c8e2c6a9c1d", ""},
+		{"xfs", "6E2BA8A4-AE4E-4C3B-8A56-7C8E2C6A9C1D", ""},
+		{"xfs", "6e2ba8a4ae4e4c3b8a567c8e2c6a9c1d", `invalid uuid "6e2ba8a4ae4e4c3b8a567c8e2c6a9c1d" for xfs, must match ^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`},
+		{"ext4", "1234-ABCD", `invalid uuid "1234-ABCD" for ext4, must match ^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`},
+		{"vfat", "1234-ABCD", ""},
+		{"vfat", "6e2ba8a4-ae4e-4c3b-8a56-7c8e2c6a9c1d", `invalid uuid "6e2ba8a4-ae4e-4c3b-8a56-7c8e2c6a9c1d" for vfat, must match ^[0-9a-fA-F]{4}-[0-9a-fA-F]{4}$`},
+	} {
+		t.Run(tc.fsType+"/"+tc.uuid, func(t *testing.T) {
+			err := validateFSUUID(tc.fsType, tc.uuid)
+			if tc.expErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expErr)
+			}
+		})
+	}
+}
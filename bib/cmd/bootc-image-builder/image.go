@@ -25,6 +25,7 @@ import (
 	"github.com/osbuild/images/pkg/rpmmd"
 	"github.com/osbuild/images/pkg/runner"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
 
 	"github.com/osbuild/bootc-image-builder/bib/internal/buildconfig"
 	"github.com/osbuild/bootc-image-builder/bib/internal/distrodef"
@@ -36,7 +37,8 @@ import (
 const DEFAULT_SIZE = uint64(10 * GibiByte)
 
 type ManifestConfig struct {
-	// OCI image path (without the transport, that is always docker://)
+	// OCI image reference (without a transport), the image is always
+	// read from the local container storage
 	Imgref string
 
 	ImageTypes imagetypes.ImageTypes
@@ -60,12 +62,118 @@ type ManifestConfig struct {
 	// RootFSType specifies the filesystem type for the root partition
 	RootFSType string
 
-	// use librepo ad the rpm downlaod backend
-	UseLibrepo bool
+	// The osbuild source that downloads the rpms
+	RpmDownloader osbuild.RpmDownloader
+
+	// Image reference that the installed system will use for updates,
+	// if empty Imgref is used
+	TargetImgref string
+
+	// Platform variant (e.g. "v8") used to select the container image,
+	// only set when given via --platform
+	PlatformVariant string
+
+	// Maps rpm repository url prefixes to their replacement, applied
+	// to the depsolved repositories and packages
+	RepoMirrors map[string]string
+
+	// Do not install weak dependencies (recommends) of packages
+	NoWeakDeps bool
+
+	// DepsolveOptions are the --depsolve-option dnf options, they
+	// override NoWeakDeps
+	DepsolveOptions *DepsolveOptions
+
+	// Maps mountpoints to filesystem labels that override the default
+	// labels of the partition table
+	FSLabels map[string]string
+
+	// Maps mountpoints to filesystem UUIDs that override the random
+	// UUIDs of the partition table
+	FSUUIDs map[string]string
+
+	// Alignment of the partition start offsets in bytes, 0 means the
+	// default alignment of the partition table
+	PartitionAlignment uint64
+
+	// Maximum size of the disk image in bytes, 0 means no limit
+	MaxImageSize uint64
+
+	// Mountpoints of data partitions in the order they are placed on
+	// the disk
+	PartitionOrder []string
+
+	// Partition table type that overrides the default of the
+	// architecture, PT_NONE means the default
+	PartitionTableType disk.PartitionTableType
+
+	// Extra dracut modules for the initramfs of the ISO installer
+	DracutAddModules []string
+
+	// Filesystem (squashfs, ext4 or erofs) of the anaconda stage2
+	// image of the ISO installer, if empty squashfs is used. This is
+	// unrelated to the root filesystem of the installed system.
+	ISOStage2FS string
+
+	// Extra packages for the ISO installer environment
+	InstallerPackages []string
+
+	// Extra packages for the build root, only used for ISOs as disk
+	// images use the container as the build root
+	BuildPackages []string
+
+	// Allow a separate /var filesystem customization, the /var subdir
+	// restrictions still apply
+	AllowVarPartition bool
+
+	// Mount the root filesystem read-write instead of the default
+	// read-only
+	RWRoot bool
+
+	// Omit the SELinux relabel of the customized disk image, only
+	// meant for throwaway development images
+	SkipSELinux bool
+
+	// Extra kernel arguments from --kernel-cmdline that apply to the
+	// requested image types
+	KernelCmdline []string
+
+	// Firmware (bios, uefi or hybrid) of disk images, if empty the
+	// default of the architecture is used
+	Firmware string
+
+	// Serial console (e.g. "ttyS1,115200n8") of disk images, if empty
+	// ttyS0 is used
+	SerialConsole string
+
+	// Directory with the --ca-cert certificates for the container
+	// resolver, it is temporary so it is not part of the input hash
+	CACertDir string `json:"-"`
+
+	// Maximum number of containers that are resolved at the same
+	// time, 0 means no limit. It does not change the output so it is
+	// not part of the input hash
+	ResolveConcurrency int `json:"-"`
+
+	// BuildImgref is the container whose repositories are used for the
+	// build root of ISOs (--build-container), BuildSourceInfo is its
+	// distro information and BuildDepsolver depsolves the build root
+	// packages. Empty/nil means the container itself is used.
+	BuildImgref     string
+	BuildSourceInfo *source.Info
+	BuildDepsolver  depsolver `json:"-"`
+
+	// Seed of the random number generator for the partition and
+	// filesystem UUIDs, 0 means a random seed
+	Seed int64
 }
 
 func Manifest(c *ManifestConfig) (*manifest.Manifest, error) {
 	rng := createRand()
+	if c.Seed != 0 {
+		/* #nosec G404 */
+		rng = rand.New(rand.NewSource(c.Seed))
+	}
 
 	if c.ImageTypes.BuildsISO() {
 		return manifestForISO(c, rng)
@@ -77,7 +185,7 @@ var (
 	// The mountpoint policy for bootc images is more restrictive than the
 	// ostree mountpoint policy defined in osbuild/images. It only allows /
 	// (for sizing the root partition) and custom mountpoints under /var but
-	// not /var itself.
+	// not /var itself (unless --allow-var-partition is given).
 
 	// Since our policy library doesn't support denying a path while allowing
 	// its subpaths (only the opposite), we augment the standard policy check
@@ -90,7 +198,8 @@ var (
 
 		// /var is not allowed, but we need to allow any subdirectories that
 		// are not denied below, so we allow it initially and then check it
-		// separately (in checkMountpoints())
+		// separately (in checkMountpoints()) unless a separate /var
+		// partition was explicitly allowed
 		"/var": {Deny: false},
 
 		// /var subdir denials
@@ -111,13 +220,15 @@ var (
 	})
 )
 
-func checkMountpoints(filesystems []blueprint.FilesystemCustomization, policy *pathpolicy.PathPolicies) error {
+// checkMountpoints checks the custom mountpoints against the policy. A
+// custom /var is denied unless allowVar is set.
+func checkMountpoints(filesystems []blueprint.FilesystemCustomization, policy *pathpolicy.PathPolicies, allowVar bool) error {
 	errs := []error{}
 	for _, fs := range filesystems {
 		if err := policy.Check(fs.Mountpoint); err != nil {
 			errs = append(errs, err)
 		}
-		if fs.Mountpoint == "/var" {
+		if fs.Mountpoint == "/var" && !allowVar {
 			// this error message is consistent with the errors returned by policy.Check()
 			// TODO: remove trailing space inside the quoted path when the function is fixed in osbuild/images.
 			errs = append(errs, fmt.Errorf(`path "/var" is not allowed`))
@@ -129,7 +240,7 @@ func checkMountpoints(filesystems []blueprint.FilesystemCustomization, policy *p
 	return nil
 }
 
-func checkFilesystemCustomizations(fsCustomizations []blueprint.FilesystemCustomization, ptmode disk.PartitioningMode) error {
+func checkFilesystemCustomizations(fsCustomizations []blueprint.FilesystemCustomization, ptmode disk.PartitioningMode, allowVar bool) error {
 	var policy *pathpolicy.PathPolicies
 	switch ptmode {
 	case disk.BtrfsPartitioningMode:
@@ -140,7 +251,7 @@ func checkFilesystemCustomizations(fsCustomizations []blueprint.FilesystemCustom
 	default:
 		policy = mountpointPolicy
 	}
-	if err := checkMountpoints(fsCustomizations, policy); err != nil {
+	if err := checkMountpoints(fsCustomizations, policy, allowVar); err != nil {
 		return err
 	}
 	return nil
@@ -207,15 +318,39 @@ func genPartitionTable(c *ManifestConfig, customizations *blueprint.Customizatio
 	if err != nil {
 		return nil, fmt.Errorf("error reading disk customizations: %w", err)
 	}
+	var pt *disk.PartitionTable
 	switch {
 	// XXX: move into images library
 	case fsCust != nil && diskCust != nil:
 		return nil, fmt.Errorf("cannot combine disk and filesystem customizations")
 	case diskCust != nil:
-		return genPartitionTableDiskCust(c, diskCust, rng)
+		pt, err = genPartitionTableDiskCust(c, diskCust, rng)
 	default:
-		return genPartitionTableFsCust(c, fsCust, rng)
+		pt, err = genPartitionTableFsCust(c, fsCust, rng)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := setFSLabels(pt, c.FSLabels); err != nil {
+		return nil, err
+	}
+	if err := setFSUUIDs(pt, c.FSUUIDs); err != nil {
+		return nil, err
 	}
+	if c.RWRoot {
+		warnings.Warnf("mounting the root filesystem read-write, this is only safe if the container image does not use composefs and non-ostree aware tools can corrupt the deployment")
+		if err := setRootReadWrite(pt); err != nil {
+			return nil, err
+		}
+	}
+	if err := orderPartitions(pt, c.PartitionOrder); err != nil {
+		return nil, err
+	}
+	alignPartitions(pt, c.PartitionAlignment)
+	if err := checkImageSize(pt, c.MaxImageSize); err != nil {
+		return nil, err
+	}
+	return pt, nil
 }
 
 // calcRequiredDirectorySizes will calculate the minimum sizes for /
@@ -275,10 +410,21 @@ func genPartitionTableDiskCust(c *ManifestConfig, diskCust *blueprint.DiskCustom
 	if err != nil {
 		return nil, err
 	}
+	bootMode := platform.BOOT_HYBRID
+	if c.Firmware != "" {
+		bootMode = firmwareBootModes[c.Firmware]
+	}
+	ptType := basept.Type
+	if c.PartitionTableType != disk.PT_NONE {
+		if diskCust.Type != "" && diskCust.Type != c.PartitionTableType.String() {
+			return nil, fmt.Errorf("cannot use --partition-table %s with a %s disk customization", c.PartitionTableType, diskCust.Type)
+		}
+		ptType = c.PartitionTableType
+	}
 	partOptions := &disk.CustomPartitionTableOptions{
-		PartitionTableType: basept.Type,
+		PartitionTableType: ptType,
 		// XXX: not setting/defaults will fail to boot with btrfs/lvm
-		BootMode:         platform.BOOT_HYBRID,
+		BootMode:         bootMode,
 		DefaultFSType:    defaultFSType,
 		RequiredMinSizes: requiredMinSizes,
 	}
@@ -290,12 +436,17 @@ func genPartitionTableFsCust(c *ManifestConfig, fsCust []blueprint.FilesystemCus
 	if !ok {
 		return nil, fmt.Errorf("pipelines: no partition tables defined for %s", c.Architecture)
 	}
+	basept = partitionTableForFirmware(basept, c.Firmware)
+	basept, err := partitionTableForType(basept, c.PartitionTableType)
+	if err != nil {
+		return nil, err
+	}
 
 	partitioningMode := disk.RawPartitioningMode
 	if c.RootFSType == "btrfs" {
 		partitioningMode = disk.BtrfsPartitioningMode
 	}
-	if err := checkFilesystemCustomizations(fsCust, partitioningMode); err != nil {
+	if err := checkFilesystemCustomizations(fsCust, partitioningMode, c.AllowVarPartition); err != nil {
 		return nil, err
 	}
 	fsCustomizations := updateFilesystemSizes(fsCust, c.RootfsMinsize)
@@ -311,15 +462,26 @@ func genPartitionTableFsCust(c *ManifestConfig, fsCust []blueprint.FilesystemCus
 	return pt, nil
 }
 
-func manifestForDiskImage(c *ManifestConfig, rng *rand.Rand) (*manifest.Manifest, error) {
-	if c.Imgref == "" {
-		return nil, fmt.Errorf("pipeline: no base image defined")
+// containerSourceSpec returns the container source for the image. The
+// name of the source ends up as the image reference that the installed
+// system tracks so it can differ from the (local) build source.
+func containerSourceSpec(c *ManifestConfig) container.SourceSpec {
+	name := c.Imgref
+	if c.TargetImgref != "" {
+		name = c.TargetImgref
 	}
-	containerSource := container.SourceSpec{
+	return container.SourceSpec{
 		Source: c.Imgref,
-		Name:   c.Imgref,
+		Name:   name,
 		Local:  true,
 	}
+}
+
+func manifestForDiskImage(c *ManifestConfig, rng *rand.Rand) (*manifest.Manifest, error) {
+	if c.Imgref == "" {
+		return nil, fmt.Errorf("pipeline: no base image defined")
+	}
+	containerSource := containerSourceSpec(c)
 
 	var customizations *blueprint.Customizations
 	if c.Config != nil {
@@ -331,20 +493,21 @@ func manifestForDiskImage(c *ManifestConfig, rng *rand.Rand) (*manifest.Manifest
 	img.Groups = users.GroupsFromBP(customizations.GetGroups())
 	// TODO: get from the bootc container instead of hardcoding it
 	img.SELinux = "targeted"
-
-	img.KernelOptionsAppend = []string{
-		"rw",
-		// TODO: Drop this as we expect kargs to come from the container image,
-		// xref https://github.com/CentOS/centos-bootc-layered/blob/main/cloud/usr/lib/bootc/install/05-cloud-kargs.toml
-		"console=tty0",
-		"console=ttyS0",
+	if c.SkipSELinux {
+		warnings.Warnf("skipping the SELinux relabel (--experimental-skip-selinux), files created by the customizations are unlabeled and the image may not work with SELinux enforcing, do not use it outside of development")
+		img.SELinux = ""
 	}
 
+	img.KernelOptionsAppend = []string{"rw"}
+	// TODO: Drop this as we expect kargs to come from the container image,
+	// xref https://github.com/CentOS/centos-bootc-layered/blob/main/cloud/usr/lib/bootc/install/05-cloud-kargs.toml
+	img.KernelOptionsAppend = append(img.KernelOptionsAppend, consoleKernelOptions(c.SerialConsole)...)
+
 	switch c.Architecture {
 	case arch.ARCH_X86_64:
 		img.Platform = &platform.X86{
 			BasePlatform: platform.BasePlatform{},
-			BIOS:         true,
+			BIOS:         c.Firmware != "uefi",
 		}
 	case arch.ARCH_AARCH64:
 		img.Platform = &platform.Aarch64{
@@ -372,6 +535,7 @@ func manifestForDiskImage(c *ManifestConfig, rng *rand.Rand) (*manifest.Manifest
 	if kopts := customizations.GetKernel(); kopts != nil && kopts.Append != "" {
 		img.KernelOptionsAppend = append(img.KernelOptionsAppend, kopts.Append)
 	}
+	img.KernelOptionsAppend = append(img.KernelOptionsAppend, c.KernelCmdline...)
 
 	pt, err := genPartitionTable(c, customizations, rng)
 	if err != nil {
@@ -422,11 +586,7 @@ func manifestForISO(c *ManifestConfig, rng *rand.Rand) (*manifest.Manifest, erro
 		return nil, err
 	}
 
-	containerSource := container.SourceSpec{
-		Source: c.Imgref,
-		Name:   c.Imgref,
-		Local:  true,
-	}
+	containerSource := containerSourceSpec(c)
 
 	// The ref is not needed and will be removed from the ctor later
 	// in time
@@ -438,7 +598,9 @@ func manifestForISO(c *ManifestConfig, rng *rand.Rand) (*manifest.Manifest, erro
 	img.OSVersion = c.SourceInfo.OSRelease.VersionID
 
 	img.ExtraBasePackages = rpmmd.PackageSet{
-		Include: imageDef.Packages,
+		// clone so the installer packages do not end up in the
+		// (possibly shared) backing array of the image definition
+		Include: append(slices.Clone(imageDef.Packages), c.InstallerPackages...),
 	}
 
 	img.ISOLabel = labelForISO(&c.SourceInfo.OSRelease, &c.Architecture)
@@ -456,6 +618,7 @@ func manifestForISO(c *ManifestConfig, rng *rand.Rand) (*manifest.Manifest, erro
 	if kopts := customizations.GetKernel(); kopts != nil && kopts.Append != "" {
 		img.Kickstart.KernelOptionsAppend = append(img.Kickstart.KernelOptionsAppend, kopts.Append)
 	}
+	img.Kickstart.KernelOptionsAppend = append(img.Kickstart.KernelOptionsAppend, c.KernelCmdline...)
 	img.Kickstart.NetworkOnBoot = true
 
 	instCust, err := customizations.GetInstaller()
@@ -471,13 +634,19 @@ func manifestForISO(c *ManifestConfig, rng *rand.Rand) (*manifest.Manifest, erro
 		anaconda.ModuleServices,
 		anaconda.ModuleSecurity,
 	)
+	img.AdditionalDracutModules = append(img.AdditionalDracutModules, c.DracutAddModules...)
 
 	img.Kickstart.OSTree = &kickstart.OSTree{
 		OSName: "default",
 	}
-	// use lorax-templates-rhel if the source distro is not Fedora with the exception of Fedora ELN
+	// use lorax-templates-rhel if the source distro is not Fedora with the exception of Fedora ELN,
+	// lorax runs in the build root so the distro of the build container decides
+	buildOSRelease := c.SourceInfo.OSRelease
+	if c.BuildSourceInfo != nil {
+		buildOSRelease = c.BuildSourceInfo.OSRelease
+	}
 	img.UseRHELLoraxTemplates =
-		c.SourceInfo.OSRelease.ID != "fedora" || c.SourceInfo.OSRelease.VersionID == "eln"
+		buildOSRelease.ID != "fedora" || buildOSRelease.VersionID == "eln"
 
 	switch c.Architecture {
 	case arch.ARCH_X86_64:
@@ -516,8 +685,10 @@ func manifestForISO(c *ManifestConfig, rng *rand.Rand) (*manifest.Manifest, erro
 	default:
 		return nil, fmt.Errorf("unsupported architecture %v", c.Architecture)
 	}
-	// see https://github.com/osbuild/bootc-image-builder/issues/733
-	img.RootfsType = manifest.SquashfsRootfs
+	img.RootfsType, err = isoStage2RootfsType(c.ISOStage2FS)
+	if err != nil {
+		return nil, err
+	}
 	img.Filename = "install.iso"
 
 	mf := manifest.New()
@@ -1,11 +1,16 @@
 package main_test
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
 
 	"github.com/osbuild/images/pkg/arch"
 	"github.com/osbuild/images/pkg/blueprint"
@@ -144,9 +149,9 @@ func TestCheckFilesystemCustomizationsValidates(t *testing.T) {
 		},
 	} {
 		if tc.expectedErr == "" {
-			assert.NoError(t, bib.CheckFilesystemCustomizations(tc.fsCust, tc.ptmode))
+			assert.NoError(t, bib.CheckFilesystemCustomizations(tc.fsCust, tc.ptmode, false))
 		} else {
-			assert.ErrorContains(t, bib.CheckFilesystemCustomizations(tc.fsCust, tc.ptmode), tc.expectedErr)
+			assert.ErrorContains(t, bib.CheckFilesystemCustomizations(tc.fsCust, tc.ptmode, false), tc.expectedErr)
 		}
 	}
 }
@@ -202,7 +207,7 @@ func TestLocalMountpointPolicy(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.path, func(t *testing.T) {
-			err := bib.CheckFilesystemCustomizations([]blueprint.FilesystemCustomization{{Mountpoint: tc.path}}, disk.RawPartitioningMode)
+			err := bib.CheckFilesystemCustomizations([]blueprint.FilesystemCustomization{{Mountpoint: tc.path}}, disk.RawPartitioningMode, false)
 			if err != nil && tc.allowed {
 				t.Errorf("expected %s to be allowed, but got error: %v", tc.path, err)
 			} else if err == nil && !tc.allowed {
@@ -212,6 +217,186 @@ func TestLocalMountpointPolicy(t *testing.T) {
 	}
 }
 
+func TestCheckFilesystemCustomizationsAllowVar(t *testing.T) {
+	for _, tc := range []struct {
+		path        string
+		ptmode      disk.PartitioningMode
+		expectedErr string
+	}{
+		// newly allowed
+		{"/var", disk.RawPartitioningMode, ""},
+		// still allowed
+		{"/var/data", disk.RawPartitioningMode, ""},
+		// still denied
+		{"/var/home", disk.RawPartitioningMode, `path "/var/home" is not allowed`},
+		{"/var/run", disk.RawPartitioningMode, `path "/var/run" is not allowed`},
+		{"/usr", disk.RawPartitioningMode, `path "/usr" is not allowed`},
+		// btrfs only allows / and /boot
+		{"/var", disk.BtrfsPartitioningMode, `path "/var" is not allowed`},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			err := bib.CheckFilesystemCustomizations([]blueprint.FilesystemCustomization{{Mountpoint: tc.path}}, tc.ptmode, true)
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestGenPartitionTableAllowVarPartition(t *testing.T) {
+	cus := &blueprint.Customizations{
+		Filesystem: []blueprint.FilesystemCustomization{
+			{Mountpoint: "/var", MinSize: 5 * datasizes.GiB},
+		},
+	}
+	cnf := &bib.ManifestConfig{
+		Architecture: arch.FromString("amd64"),
+		RootFSType:   "xfs",
+	}
+	_, err := bib.GenPartitionTable(cnf, cus, bib.CreateRand())
+	assert.ErrorContains(t, err, `path "/var" is not allowed`)
+
+	cnf.AllowVarPartition = true
+	pt, err := bib.GenPartitionTable(cnf, cus, bib.CreateRand())
+	require.NoError(t, err)
+	mnt, parent := findMountableSizeableFor(pt, "/var")
+	require.NotNil(t, mnt)
+	assert.Equal(t, "xfs", mnt.GetFSType())
+	assert.GreaterOrEqual(t, parent.GetSize(), uint64(5*datasizes.GiB))
+}
+
+func TestGenPartitionTableRWRoot(t *testing.T) {
+	var stderr bytes.Buffer
+	restore := bib.MockWarnings(&stderr)
+	defer restore()
+
+	cnf := &bib.ManifestConfig{
+		Architecture: arch.FromString("amd64"),
+		RootFSType:   "xfs",
+		RWRoot:       true,
+	}
+	pt, err := bib.GenPartitionTable(cnf, &blueprint.Customizations{}, bib.CreateRand())
+	require.NoError(t, err)
+	rootMnt := pt.FindMountable("/")
+	require.NotNil(t, rootMnt)
+	assert.Equal(t, "rw", rootMnt.(*disk.Filesystem).FSTabOptions)
+	// /boot stays read-only
+	assert.Equal(t, "ro", pt.FindMountable("/boot").(*disk.Filesystem).FSTabOptions)
+
+	require.Len(t, bib.Warnings(), 1)
+	assert.Contains(t, bib.Warnings()[0], "mounting the root filesystem read-write")
+	assert.Contains(t, stderr.String(), "WARNING: mounting the root filesystem read-write")
+
+	// the base partition tables are not modified
+	cnf.RWRoot = false
+	pt, err = bib.GenPartitionTable(cnf, &blueprint.Customizations{}, bib.CreateRand())
+	require.NoError(t, err)
+	assert.Equal(t, "ro", pt.FindMountable("/").(*disk.Filesystem).FSTabOptions)
+}
+
+func hasPartitionType(pt *disk.PartitionTable, partType string) bool {
+	for _, part := range pt.Partitions {
+		if part.Type == partType {
+			return true
+		}
+	}
+	return false
+}
+
+func TestGenPartitionTableFirmware(t *testing.T) {
+	for _, tc := range []struct {
+		firmware    string
+		expectBIOS  bool
+		expectESP   bool
+		customDisks bool
+	}{
+		{"", true, true, false},
+		{"hybrid", true, true, false},
+		{"uefi", false, true, false},
+		{"bios", true, false, false},
+		{"", true, true, true},
+		{"uefi", false, true, true},
+		{"bios", true, false, true},
+	} {
+		t.Run(fmt.Sprintf("%s-disk-customizations=%v", tc.firmware, tc.customDisks), func(t *testing.T) {
+			cnf := &bib.ManifestConfig{
+				Architecture: arch.FromString("amd64"),
+				RootFSType:   "xfs",
+				Firmware:     tc.firmware,
+			}
+			cus := &blueprint.Customizations{}
+			if tc.customDisks {
+				cus.Disk = &blueprint.DiskCustomization{
+					Partitions: []blueprint.PartitionCustomization{
+						{
+							FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+								Mountpoint: "/",
+								FSType:     "xfs",
+							},
+						},
+					},
+				}
+			}
+			pt, err := bib.GenPartitionTable(cnf, cus, bib.CreateRand())
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectBIOS, hasPartitionType(pt, disk.BIOSBootPartitionGUID))
+			assert.Equal(t, tc.expectESP, hasPartitionType(pt, disk.EFISystemPartitionGUID))
+			assert.NotNil(t, pt.FindMountable("/"))
+		})
+	}
+
+	// the base partition table is not modified
+	cnf := &bib.ManifestConfig{
+		Architecture: arch.FromString("amd64"),
+		RootFSType:   "xfs",
+		Firmware:     "uefi",
+	}
+	_, err := bib.GenPartitionTable(cnf, &blueprint.Customizations{}, bib.CreateRand())
+	require.NoError(t, err)
+	cnf.Firmware = ""
+	pt, err := bib.GenPartitionTable(cnf, &blueprint.Customizations{}, bib.CreateRand())
+	require.NoError(t, err)
+	assert.True(t, hasPartitionType(pt, disk.BIOSBootPartitionGUID))
+}
+
+func TestGenPartitionTableRWRootDiskCustomizations(t *testing.T) {
+	restore := bib.MockWarnings(io.Discard)
+	defer restore()
+
+	cnf := &bib.ManifestConfig{
+		Architecture: arch.FromString("amd64"),
+		RootFSType:   "xfs",
+		RWRoot:       true,
+	}
+	cus := &blueprint.Customizations{
+		Disk: &blueprint.DiskCustomization{
+			Partitions: []blueprint.PartitionCustomization{
+				{
+					Type: "lvm",
+					VGCustomization: blueprint.VGCustomization{
+						LogicalVolumes: []blueprint.LVCustomization{
+							{
+								FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+									Mountpoint: "/",
+									FSType:     "ext4",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	pt, err := bib.GenPartitionTable(cnf, cus, bib.CreateRand())
+	require.NoError(t, err)
+	opts, err := pt.FindMountable("/").GetFSTabOptions()
+	require.NoError(t, err)
+	assert.Equal(t, "rw", strings.Split(opts.MntOps, ",")[0])
+	assert.NotContains(t, strings.Split(opts.MntOps, ","), "ro")
+}
+
 func TestBasePartitionTablesHaveRoot(t *testing.T) {
 	// make sure that all base partition tables have at least a root partition defined
 	for arch, pt := range bib.PartitionTables {
@@ -425,6 +610,293 @@ func TestGenPartitionTableSetsRootfsForAllFilesystemsBtrfs(t *testing.T) {
 	assert.Equal(t, "vfat", mnt.GetFSType())
 }
 
+func TestGenPartitionTableFSLabels(t *testing.T) {
+	rng := bib.CreateRand()
+
+	cnf := &bib.ManifestConfig{
+		Architecture: arch.FromString("amd64"),
+		RootFSType:   "xfs",
+		FSLabels: map[string]string{
+			"/":         "img1-root",
+			"/boot/efi": "IMG1-ESP",
+		},
+	}
+	pt, err := bib.GenPartitionTable(cnf, &blueprint.Customizations{}, rng)
+	require.NoError(t, err)
+
+	for mntPoint, expected := range map[string]string{
+		"/":         "img1-root",
+		"/boot/efi": "IMG1-ESP",
+		// no override, keeps the default
+		"/boot": "boot",
+	} {
+		mnt, _ := findMountableSizeableFor(pt, mntPoint)
+		assert.Equal(t, expected, mnt.(*disk.Filesystem).Label)
+	}
+
+	// the base partition tables are not modified
+	basept := bib.PartitionTables["x86_64"]
+	mnt, _ := findMountableSizeableFor(&basept, "/")
+	assert.Equal(t, "root", mnt.(*disk.Filesystem).Label)
+}
+
+func TestGenPartitionTableFSLabelsErrors(t *testing.T) {
+	for _, tc := range []struct {
+		labels map[string]string
+		expErr string
+	}{
+		{map[string]string{"/": "this-is-too-long"}, `cannot set label for "/": label "this-is-too-long" is too long for xfs (max 12 characters)`},
+		{map[string]string{"/var/data": "data"}, `cannot set label for /var/data: no such filesystem in the partition table`},
+	} {
+		cnf := &bib.ManifestConfig{
+			Architecture: arch.FromString("amd64"),
+			RootFSType:   "xfs",
+			FSLabels:     tc.labels,
+		}
+		_, err := bib.GenPartitionTable(cnf, &blueprint.Customizations{}, bib.CreateRand())
+		assert.EqualError(t, err, tc.expErr)
+	}
+}
+
+func TestGenPartitionTableFSUUIDs(t *testing.T) {
+	cnf := &bib.ManifestConfig{
+		Architecture: arch.FromString("amd64"),
+		RootFSType:   "xfs",
+		FSUUIDs: map[string]string{
+			"/":         "6e2ba8a4-ae4e-4c3b-8a56-7c8e2c6a9c1d",
+			"/boot/efi": "1234-ABCD",
+		},
+	}
+	pt, err := bib.GenPartitionTable(cnf, &blueprint.Customizations{}, bib.CreateRand())
+	require.NoError(t, err)
+
+	mnt, _ := findMountableSizeableFor(pt, "/")
+	assert.Equal(t, "6e2ba8a4-ae4e-4c3b-8a56-7c8e2c6a9c1d", mnt.(*disk.Filesystem).UUID)
+	mnt, _ = findMountableSizeableFor(pt, "/boot/efi")
+	assert.Equal(t, "1234-ABCD", mnt.(*disk.Filesystem).UUID)
+	// no override, keeps the random uuid
+	mnt, _ = findMountableSizeableFor(pt, "/boot")
+	assert.NotEmpty(t, mnt.(*disk.Filesystem).UUID)
+	assert.NotEqual(t, "6e2ba8a4-ae4e-4c3b-8a56-7c8e2c6a9c1d", mnt.(*disk.Filesystem).UUID)
+
+	_, err = bib.GenPartitionTable(&bib.ManifestConfig{
+		Architecture: arch.FromString("amd64"),
+		RootFSType:   "xfs",
+		FSUUIDs:      map[string]string{"/var/data": "6e2ba8a4-ae4e-4c3b-8a56-7c8e2c6a9c1d"},
+	}, &blueprint.Customizations{}, bib.CreateRand())
+	assert.EqualError(t, err, "cannot set uuid for /var/data: no such filesystem in the partition table")
+}
+
+func TestGenPartitionTableMaxImageSize(t *testing.T) {
+	cnf := &bib.ManifestConfig{
+		Architecture:  arch.FromString("amd64"),
+		RootFSType:    "xfs",
+		RootfsMinsize: 10 * datasizes.GiB,
+		MaxImageSize:  20 * datasizes.GiB,
+	}
+	pt, err := bib.GenPartitionTable(cnf, &blueprint.Customizations{}, bib.CreateRand())
+	require.NoError(t, err)
+	assert.LessOrEqual(t, pt.Size, uint64(20*datasizes.GiB))
+
+	// the computed layout is larger than the limit
+	cnf.MaxImageSize = 5 * datasizes.GiB
+	_, err = bib.GenPartitionTable(cnf, &blueprint.Customizations{}, bib.CreateRand())
+	assert.ErrorContains(t, err, "exceeds the maximum image size of 5368709120 bytes (5.00 GiB)")
+}
+
+func TestGenPartitionTablePartitionAlignment(t *testing.T) {
+	const alignment = 4 * 1024 * 1024
+
+	for _, cus := range []*blueprint.Customizations{
+		{},
+		{
+			Filesystem: []blueprint.FilesystemCustomization{
+				{Mountpoint: "/var/data", MinSize: 3_000_000},
+			},
+		},
+	} {
+		cnf := &bib.ManifestConfig{
+			Architecture:       arch.FromString("amd64"),
+			RootFSType:         "xfs",
+			PartitionAlignment: alignment,
+		}
+		pt, err := bib.GenPartitionTable(cnf, cus, bib.CreateRand())
+		require.NoError(t, err)
+
+		parts := slices.Clone(pt.Partitions)
+		sort.Slice(parts, func(i, j int) bool {
+			return parts[i].Start < parts[j].Start
+		})
+		var end uint64
+		for _, part := range parts {
+			assert.Zero(t, part.Start%alignment, "partition start %v not aligned", part.Start)
+			assert.GreaterOrEqual(t, part.Start, end, "partitions overlap")
+			end = part.Start + part.Size
+		}
+		assert.Less(t, end+pt.HeaderSize(), pt.Size+1)
+		assert.Zero(t, pt.Size%alignment)
+	}
+}
+
+// partitionMountpointsByOffset returns the mountpoints of the
+// partitions with a filesystem in the order they are on the disk
+func partitionMountpointsByOffset(pt *disk.PartitionTable) []string {
+	parts := slices.Clone(pt.Partitions)
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].Start < parts[j].Start
+	})
+	var mountpoints []string
+	for _, part := range parts {
+		if fs, ok := part.Payload.(*disk.Filesystem); ok {
+			mountpoints = append(mountpoints, fs.Mountpoint)
+		}
+	}
+	return mountpoints
+}
+
+func TestGenPartitionTablePartitionOrder(t *testing.T) {
+	for _, cus := range []*blueprint.Customizations{
+		{
+			Filesystem: []blueprint.FilesystemCustomization{
+				{Mountpoint: "/var/data", MinSize: 3_000_000},
+				{Mountpoint: "/var/log", MinSize: 2_000_000},
+				{Mountpoint: "/var/lib/containers", MinSize: 5_000_000},
+			},
+		},
+		{
+			Disk: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{MinSize: 3_000_000, FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{Mountpoint: "/var/data", FSType: "xfs"}},
+					{MinSize: 2_000_000, FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{Mountpoint: "/var/log", FSType: "xfs"}},
+					{MinSize: 5_000_000, FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{Mountpoint: "/var/lib/containers", FSType: "xfs"}},
+				},
+			},
+		},
+	} {
+		cnf := &bib.ManifestConfig{
+			Architecture:      arch.FromString("amd64"),
+			RootFSType:        "xfs",
+			AllowVarPartition: true,
+			PartitionOrder:    []string{"/var/lib/containers", "/var/data", "/var/log"},
+		}
+		pt, err := bib.GenPartitionTable(cnf, cus, bib.CreateRand())
+		require.NoError(t, err)
+
+		var dataMountpoints []string
+		for _, mnt := range partitionMountpointsByOffset(pt) {
+			if strings.HasPrefix(mnt, "/var/") {
+				dataMountpoints = append(dataMountpoints, mnt)
+			}
+		}
+		assert.Equal(t, cnf.PartitionOrder, dataMountpoints)
+
+		// the partitions must not overlap and fit into the disk
+		parts := slices.Clone(pt.Partitions)
+		sort.Slice(parts, func(i, j int) bool {
+			return parts[i].Start < parts[j].Start
+		})
+		var end uint64
+		for _, part := range parts {
+			assert.GreaterOrEqual(t, part.Start, end, "partitions overlap")
+			end = part.Start + part.Size
+		}
+		assert.Less(t, end+pt.HeaderSize(), pt.Size+1)
+	}
+}
+
+func TestGenPartitionTablePartitionOrderUnknownMountpoint(t *testing.T) {
+	cnf := &bib.ManifestConfig{
+		Architecture:   arch.FromString("amd64"),
+		RootFSType:     "xfs",
+		PartitionOrder: []string{"/var/log"},
+	}
+	_, err := bib.GenPartitionTable(cnf, &blueprint.Customizations{}, bib.CreateRand())
+	assert.EqualError(t, err, `cannot order partition "/var/log": no such mountpoint in the partition table`)
+}
+
+func TestGenPartitionTablePartitionTableType(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		arch   string
+		cus    *blueprint.Customizations
+		ptType disk.PartitionTableType
+		expErr string
+	}{
+		{"default", "amd64", &blueprint.Customizations{}, disk.PT_NONE, ""},
+		{"dos-x86_64", "amd64", &blueprint.Customizations{}, disk.PT_DOS, ""},
+		{"dos-aarch64", "arm64", &blueprint.Customizations{}, disk.PT_DOS, ""},
+		{"dos-ppc64le", "ppc64le", &blueprint.Customizations{}, disk.PT_DOS, ""},
+		{"gpt-x86_64", "amd64", &blueprint.Customizations{}, disk.PT_GPT, ""},
+		{
+			"dos-aarch64-data-partition", "arm64",
+			&blueprint.Customizations{
+				Filesystem: []blueprint.FilesystemCustomization{
+					{Mountpoint: "/var/data", MinSize: 3_000_000},
+				},
+			},
+			disk.PT_DOS, "",
+		},
+		{
+			"dos-x86_64-too-many-partitions", "amd64",
+			&blueprint.Customizations{
+				Filesystem: []blueprint.FilesystemCustomization{
+					{Mountpoint: "/var/data", MinSize: 3_000_000},
+				},
+			},
+			disk.PT_DOS, "maximum number of partitions reached (4)",
+		},
+		{
+			"dos-disk-customization", "amd64",
+			&blueprint.Customizations{
+				Disk: &blueprint.DiskCustomization{
+					Partitions: []blueprint.PartitionCustomization{
+						{MinSize: 3_000_000, FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{Mountpoint: "/", FSType: "xfs"}},
+					},
+				},
+			},
+			disk.PT_DOS, "",
+		},
+		{
+			"dos-disk-customization-conflict", "amd64",
+			&blueprint.Customizations{
+				Disk: &blueprint.DiskCustomization{
+					Type: "gpt",
+					Partitions: []blueprint.PartitionCustomization{
+						{MinSize: 3_000_000, FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{Mountpoint: "/", FSType: "xfs"}},
+					},
+				},
+			},
+			disk.PT_DOS, "cannot use --partition-table dos with a gpt disk customization",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cnf := &bib.ManifestConfig{
+				Architecture:       arch.FromString(tc.arch),
+				RootFSType:         "xfs",
+				PartitionTableType: tc.ptType,
+			}
+			pt, err := bib.GenPartitionTable(cnf, tc.cus, bib.CreateRand())
+			if tc.expErr != "" {
+				assert.ErrorContains(t, err, tc.expErr)
+				return
+			}
+			require.NoError(t, err)
+
+			expected := tc.ptType
+			if expected == disk.PT_NONE {
+				expected = disk.PT_GPT
+			}
+			assert.Equal(t, expected, pt.Type)
+			if pt.Type == disk.PT_DOS {
+				for _, part := range pt.Partitions {
+					// an empty type is a linux partition for sfdisk
+					assert.LessOrEqual(t, len(part.Type), 2, "partition type %q is not a dos type", part.Type)
+				}
+			}
+		})
+	}
+}
+
 func TestGenPartitionTableDiskCustomizationRunsValidateLayoutConstraints(t *testing.T) {
 	rng := bib.CreateRand()
 
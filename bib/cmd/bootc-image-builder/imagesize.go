@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/disk"
+)
+
+// parseMaxImageSize parses the --max-image-size option, e.g. "8GiB".
+// An empty string means no limit and returns 0.
+func parseMaxImageSize(s string) (uint64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	size, err := datasizes.Parse(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid maximum image size %q: %w", s, err)
+	}
+	if size == 0 {
+		return 0, fmt.Errorf("invalid maximum image size %q, must be greater than zero", s)
+	}
+	return size, nil
+}
+
+// checkImageSize ensures that the disk of the partition table fits into
+// maxSize, no limit is used for a zero maxSize
+func checkImageSize(pt *disk.PartitionTable, maxSize uint64) error {
+	if maxSize == 0 || pt.Size <= maxSize {
+		return nil
+	}
+	return fmt.Errorf("image size %d bytes (%.2f GiB) exceeds the maximum image size of %d bytes (%.2f GiB)", pt.Size, float64(pt.Size)/datasizes.GiB, maxSize, float64(maxSize)/datasizes.GiB)
+}
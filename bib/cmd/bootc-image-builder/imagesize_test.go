@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/disk"
+)
+
+func TestParseMaxImageSize(t *testing.T) {
+	size, err := parseMaxImageSize("")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), size)
+
+	size, err = parseMaxImageSize("8GiB")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(8*datasizes.GiB), size)
+
+	_, err = parseMaxImageSize("0")
+	assert.EqualError(t, err, `invalid maximum image size "0", must be greater than zero`)
+	_, err = parseMaxImageSize("lots")
+	assert.ErrorContains(t, err, `invalid maximum image size "lots": `)
+}
+
+func TestCheckImageSize(t *testing.T) {
+	pt := &disk.PartitionTable{Size: 10 * datasizes.GiB}
+
+	assert.NoError(t, checkImageSize(pt, 0))
+	assert.NoError(t, checkImageSize(pt, 10*datasizes.GiB))
+	err := checkImageSize(pt, 8*datasizes.GiB)
+	assert.EqualError(t, err, "image size 10737418240 bytes (10.00 GiB) exceeds the maximum image size of 8589934592 bytes (8.00 GiB)")
+}
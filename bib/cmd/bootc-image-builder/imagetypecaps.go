@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/osbuild/images/pkg/blueprint"
+
+	"github.com/osbuild/bootc-image-builder/bib/internal/buildconfig"
+	"github.com/osbuild/bootc-image-builder/bib/internal/imagetypes"
+)
+
+// imageTypeCapabilities are the build config customizations that an
+// image type supports. Customizations an image type does not support
+// would be silently ignored when building it, so they are rejected.
+type imageTypeCapabilities struct {
+	// filesystem and disk customizations, the ISO installer uses the
+	// partitioning of the kickstart instead
+	Partitioning bool
+	// installer (kickstart, anaconda modules) customizations
+	Installer bool
+	// fips customization, disk images get FIPS from the container
+	FIPS bool
+}
+
+var (
+	diskImageCapabilities = imageTypeCapabilities{Partitioning: true}
+	isoImageCapabilities  = imageTypeCapabilities{Installer: true, FIPS: true}
+)
+
+func capabilitiesForImageType(imgType string) (imageTypeCapabilities, error) {
+	imageTypes, err := imagetypes.New(imgType)
+	if err != nil {
+		return imageTypeCapabilities{}, err
+	}
+	if imageTypes.BuildsISO() {
+		return isoImageCapabilities, nil
+	}
+	return diskImageCapabilities, nil
+}
+
+// validateConfigForImageTypes checks that the customizations of the build
+// config are supported by all requested image types, all unsupported
+// customizations are reported
+func validateConfigForImageTypes(config *buildconfig.BuildConfig, imageTypes imagetypes.ImageTypes) error {
+	if config == nil || config.Customizations == nil {
+		return nil
+	}
+	customizations := config.Customizations
+
+	var errs []error
+	for _, imgType := range imageTypes {
+		caps, err := capabilitiesForImageType(imgType)
+		if err != nil {
+			return err
+		}
+		unsupported := func(what string) {
+			errs = append(errs, fmt.Errorf("image type %q does not support %s customizations", imgType, what))
+		}
+		if !caps.Partitioning && len(customizations.GetFilesystems()) > 0 {
+			unsupported("filesystem")
+		}
+		if !caps.Partitioning && customizations.Disk != nil {
+			unsupported("disk")
+		}
+		if !caps.Installer && hasInstallerCustomizations(customizations) {
+			unsupported("installer")
+		}
+		if !caps.FIPS && customizations.GetFIPS() {
+			unsupported("fips")
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid build config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func hasInstallerCustomizations(customizations *blueprint.Customizations) bool {
+	inst := customizations.Installer
+	if inst == nil {
+		return false
+	}
+	return inst.Unattended || len(inst.SudoNopasswd) > 0 || inst.Kickstart != nil || inst.Modules != nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/blueprint"
+	"github.com/osbuild/images/pkg/datasizes"
+
+	"github.com/osbuild/bootc-image-builder/bib/internal/buildconfig"
+	"github.com/osbuild/bootc-image-builder/bib/internal/imagetypes"
+)
+
+func TestCapabilitiesForImageType(t *testing.T) {
+	for _, imgType := range []string{"qcow2", "raw", "ami", "vmdk", "vhd", "gce"} {
+		caps, err := capabilitiesForImageType(imgType)
+		require.NoError(t, err)
+		assert.Equal(t, diskImageCapabilities, caps, imgType)
+	}
+	for _, imgType := range []string{"anaconda-iso", "iso"} {
+		caps, err := capabilitiesForImageType(imgType)
+		require.NoError(t, err)
+		assert.Equal(t, isoImageCapabilities, caps, imgType)
+	}
+
+	_, err := capabilitiesForImageType("floppy")
+	assert.Error(t, err)
+}
+
+func TestValidateConfigForImageTypes(t *testing.T) {
+	filesystems := &blueprint.Customizations{
+		Filesystem: []blueprint.FilesystemCustomization{{Mountpoint: "/var", MinSize: 2 * datasizes.GiB}},
+	}
+	disk := &blueprint.Customizations{
+		Disk: &blueprint.DiskCustomization{
+			Partitions: []blueprint.PartitionCustomization{
+				{
+					Type: "lvm",
+					VGCustomization: blueprint.VGCustomization{
+						Name: "rootvg",
+						LogicalVolumes: []blueprint.LVCustomization{
+							{
+								Name:                         "rootlv",
+								MinSize:                      2 * datasizes.GiB,
+								FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{Mountpoint: "/", FSType: "xfs"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	installer := &blueprint.Customizations{
+		Installer: &blueprint.InstallerCustomization{
+			Kickstart: &blueprint.Kickstart{Contents: "text --non-interactive"},
+		},
+	}
+	enabled := true
+	fips := &blueprint.Customizations{FIPS: &enabled}
+
+	for _, tc := range []struct {
+		name           string
+		imageTypes     []string
+		customizations *blueprint.Customizations
+		expErr         string
+	}{
+		{"no-customizations", []string{"qcow2"}, nil, ""},
+		{"disk-filesystem", []string{"qcow2", "raw"}, filesystems, ""},
+		{"disk-lvm", []string{"ami"}, disk, ""},
+		{"iso-installer", []string{"anaconda-iso"}, installer, ""},
+		{"iso-fips", []string{"iso"}, fips, ""},
+		{"iso-filesystem", []string{"anaconda-iso"}, filesystems, `invalid build config: image type "anaconda-iso" does not support filesystem customizations`},
+		{"iso-lvm", []string{"iso"}, disk, `invalid build config: image type "iso" does not support disk customizations`},
+		{"disk-installer", []string{"qcow2"}, installer, `invalid build config: image type "qcow2" does not support installer customizations`},
+		{"disk-fips", []string{"vmdk"}, fips, `invalid build config: image type "vmdk" does not support fips customizations`},
+		{
+			"multiple",
+			[]string{"qcow2", "raw"},
+			&blueprint.Customizations{Installer: installer.Installer, FIPS: fips.FIPS},
+			"invalid build config: " +
+				`image type "qcow2" does not support installer customizations` + "\n" +
+				`image type "qcow2" does not support fips customizations` + "\n" +
+				`image type "raw" does not support installer customizations` + "\n" +
+				`image type "raw" does not support fips customizations`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			imageTypes, err := imagetypes.New(tc.imageTypes...)
+			require.NoError(t, err)
+			config := &buildconfig.BuildConfig{Customizations: tc.customizations}
+
+			err = validateConfigForImageTypes(config, imageTypes)
+			if tc.expErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+
+	"github.com/osbuild/images/pkg/manifest"
+)
+
+// inputHash returns a hash over the resolved build inputs: the
+// sources of the manifest (the container image and the depsolved
+// packages) and the effective manifest configuration. Unlike the
+// manifest itself the hash does not change between runs because of
+// e.g. randomly generated partition UUIDs.
+func inputHash(mf manifest.OSBuildManifest, c *ManifestConfig) (string, error) {
+	var m struct {
+		Sources json.RawMessage `json:"sources"`
+	}
+	if err := json.Unmarshal(mf, &m); err != nil {
+		return "", fmt.Errorf("cannot parse manifest: %w", err)
+	}
+	config, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("cannot serialize manifest config: %w", err)
+	}
+
+	h := sha256.New()
+	h.Write(m.Sources)
+	h.Write(config)
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+// buildInputHash extends the input hash of the manifest with the
+// options of the build that change the artifacts but not the manifest,
+// i.e. the osbuild exports that are built (see --only-export)
+func buildInputHash(hash string, exports []string) string {
+	exports = slices.Clone(exports)
+	sort.Strings(exports)
+
+	h := sha256.New()
+	h.Write([]byte(hash))
+	for _, export := range exports {
+		fmt.Fprintf(h, "\x00export:%s", export)
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil))
+}
+
+// unchangedBuildResult returns the build result of a previous build
+// in the output directory if it was built from the same inputs and
+// all its artifacts still exist
+func unchangedBuildResult(outputDir, hash string) (*buildResult, bool) {
+	data, err := os.ReadFile(filepath.Join(outputDir, buildResultFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false
+	}
+	if err != nil {
+		logrus.Warnf("cannot read previous build result: %v", err)
+		return nil, false
+	}
+	var res buildResult
+	if err := json.Unmarshal(data, &res); err != nil {
+		logrus.Warnf("cannot parse previous build result: %v", err)
+		return nil, false
+	}
+	if res.InputHash != hash {
+		return nil, false
+	}
+	for _, artifact := range res.Artifacts {
+		if _, err := os.Stat(filepath.Join(outputDir, artifact)); err != nil {
+			return nil, false
+		}
+	}
+	return &res, true
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/container"
+	"github.com/osbuild/images/pkg/manifest"
+
+	"github.com/osbuild/bootc-image-builder/bib/internal/source"
+)
+
+// serializeTestManifest serializes the disk manifest of the given
+// config with a fake build and image container with the given image id
+func serializeTestManifest(t *testing.T, c *ManifestConfig, imageID string) manifest.OSBuildManifest {
+	containerSpec := container.Spec{
+		Source:  "test-container",
+		Digest:  "sha256:dddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddd",
+		ImageID: imageID,
+	}
+	mani, err := Manifest(c)
+	require.NoError(t, err)
+	mf, err := mani.Serialize(nil, map[string][]container.Spec{
+		"build": {containerSpec},
+		"image": {containerSpec},
+	}, nil, nil)
+	require.NoError(t, err)
+	return mf
+}
+
+func TestInputHash(t *testing.T) {
+	c := &ManifestConfig{
+		Architecture: arch.ARCH_X86_64,
+		Imgref:       "testempty",
+		ImageTypes:   []string{"qcow2"},
+		SourceInfo: &source.Info{
+			OSRelease: source.OSRelease{
+				ID:         "fedora",
+				VersionID:  "40",
+				Name:       "Fedora Linux",
+				PlatformID: "platform:f40",
+			},
+			UEFIVendor: "fedora",
+		},
+		DistroDefPaths: []string{"../../data/defs"},
+		RootFSType:     "ext4",
+	}
+	imageID := "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+
+	mf1 := serializeTestManifest(t, c, imageID)
+	mf2 := serializeTestManifest(t, c, imageID)
+	// the manifests differ because of the random partition UUIDs
+	assert.NotEqual(t, mf1, mf2)
+	hash1, err := inputHash(mf1, c)
+	require.NoError(t, err)
+	hash2, err := inputHash(mf2, c)
+	require.NoError(t, err)
+	assert.Equal(t, hash1, hash2)
+	assert.Regexp(t, `^sha256:[0-9a-f]{64}$`, hash1)
+
+	// a different container image changes the hash
+	hash, err := inputHash(serializeTestManifest(t, c, "sha256:2222222222222222222222222222222222222222222222222222222222222222"), c)
+	require.NoError(t, err)
+	assert.NotEqual(t, hash1, hash)
+
+	// and so does a different config
+	c.RootFSType = "xfs"
+	hash, err = inputHash(serializeTestManifest(t, c, imageID), c)
+	require.NoError(t, err)
+	assert.NotEqual(t, hash1, hash)
+}
+
+func TestSkipIfUnchangedSecondRun(t *testing.T) {
+	outputDir := t.TempDir()
+	hash := "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	// nothing was built yet
+	_, ok := unchangedBuildResult(outputDir, hash)
+	assert.False(t, ok)
+
+	// the first run records the input hash
+	artifact := filepath.Join(outputDir, "qcow2/disk.qcow2")
+	require.NoError(t, os.MkdirAll(filepath.Dir(artifact), 0755))
+	require.NoError(t, os.WriteFile(artifact, []byte("disk"), 0644))
+	_, err := writeBuildResult(outputDir, "quay.io/example/os:latest", []string{"qcow2"}, []string{artifact}, nil, hash, "")
+	require.NoError(t, err)
+
+	// the second run with identical inputs is skipped
+	res, ok := unchangedBuildResult(outputDir, hash)
+	assert.True(t, ok)
+	assert.Equal(t, hash, res.InputHash)
+	assert.Equal(t, []string{"qcow2/disk.qcow2"}, res.Artifacts)
+
+	// but not if the inputs changed
+	_, ok = unchangedBuildResult(outputDir, "sha256:other")
+	assert.False(t, ok)
+
+	// or an artifact is missing
+	require.NoError(t, os.Remove(artifact))
+	_, ok = unchangedBuildResult(outputDir, hash)
+	assert.False(t, ok)
+}
+
+func TestBuildInputHash(t *testing.T) {
+	hash := "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	full := buildInputHash(hash, []string{"qcow2", "image"})
+	assert.Regexp(t, `^sha256:[0-9a-f]{64}$`, full)
+	assert.Equal(t, full, buildInputHash(hash, []string{"image", "qcow2"}))
+	assert.NotEqual(t, full, buildInputHash(hash, []string{"qcow2"}))
+	assert.NotEqual(t, full, buildInputHash("sha256:other", []string{"qcow2", "image"}))
+}
+
+func TestSkipIfUnchangedOnlyExport(t *testing.T) {
+	outputDir := t.TempDir()
+	hash := "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	// a previous "--only-export qcow2" run
+	artifact := filepath.Join(outputDir, "qcow2/disk.qcow2")
+	require.NoError(t, os.MkdirAll(filepath.Dir(artifact), 0755))
+	require.NoError(t, os.WriteFile(artifact, []byte("disk"), 0644))
+	_, err := writeBuildResult(outputDir, "quay.io/example/os:latest", []string{"qcow2", "raw"}, []string{artifact}, nil, buildInputHash(hash, []string{"qcow2"}), "")
+	require.NoError(t, err)
+
+	// is not reused for a full build with the same inputs
+	_, ok := unchangedBuildResult(outputDir, buildInputHash(hash, []string{"qcow2", "image"}))
+	assert.False(t, ok)
+	// but for the same partial build
+	_, ok = unchangedBuildResult(outputDir, buildInputHash(hash, []string{"qcow2"}))
+	assert.True(t, ok)
+}
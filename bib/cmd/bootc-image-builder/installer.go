@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// rpmNameRE matches valid rpm package names
+var rpmNameRE = regexp.MustCompile(`^[A-Za-z0-9_.+-]+$`)
+
+// validateInstallerPackages checks the --installer-package arguments,
+// the packages are only installed into the ISO installer environment
+func validateInstallerPackages(pkgs []string, buildsISO bool) error {
+	if len(pkgs) == 0 {
+		return nil
+	}
+	if !buildsISO {
+		return fmt.Errorf("--installer-package is only supported for the anaconda-iso image type")
+	}
+	for _, pkg := range pkgs {
+		if !rpmNameRE.MatchString(pkg) {
+			return fmt.Errorf("invalid installer package name %q", pkg)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateInstallerPackages(t *testing.T) {
+	for _, tc := range []struct {
+		pkgs      []string
+		buildsISO bool
+		expErr    string
+	}{
+		{nil, false, ""},
+		{nil, true, ""},
+		{[]string{"anaconda-addon-example", "python3-foo", "libstdc++"}, true, ""},
+		{[]string{"anaconda-addon-example"}, false, "--installer-package is only supported for the anaconda-iso image type"},
+		{[]string{"foo bar"}, true, `invalid installer package name "foo bar"`},
+		{[]string{""}, true, `invalid installer package name ""`},
+	} {
+		err := validateInstallerPackages(tc.pkgs, tc.buildsISO)
+		if tc.expErr == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tc.expErr)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/osbuild/images/pkg/manifest"
+)
+
+// isoStage2Types maps the --iso-stage2-fs values to the rootfs types of
+// the anaconda stage2 image, "ext4" is an ext4 image in a squashfs
+var isoStage2Types = map[string]manifest.RootfsType{
+	"squashfs": manifest.SquashfsRootfs,
+	"ext4":     manifest.SquashfsExt4Rootfs,
+	"erofs":    manifest.ErofsRootfs,
+}
+
+// isoStage2RootfsType returns the rootfs type of the stage2 image of the
+// installer ISO, a plain squashfs is used by default
+func isoStage2RootfsType(fs string) (manifest.RootfsType, error) {
+	if fs == "" {
+		// see https://github.com/osbuild/bootc-image-builder/issues/733
+		return manifest.SquashfsRootfs, nil
+	}
+	rootfsType, ok := isoStage2Types[fs]
+	if !ok {
+		return 0, fmt.Errorf("unsupported ISO stage2 filesystem %q, supported: squashfs, ext4, erofs", fs)
+	}
+	return rootfsType, nil
+}
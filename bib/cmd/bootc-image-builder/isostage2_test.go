@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/manifest"
+)
+
+func TestISOStage2RootfsType(t *testing.T) {
+	for _, tc := range []struct {
+		fs       string
+		expected manifest.RootfsType
+	}{
+		{"", manifest.SquashfsRootfs},
+		{"squashfs", manifest.SquashfsRootfs},
+		{"ext4", manifest.SquashfsExt4Rootfs},
+		{"erofs", manifest.ErofsRootfs},
+	} {
+		rootfsType, err := isoStage2RootfsType(tc.fs)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, rootfsType, tc.fs)
+	}
+
+	_, err := isoStage2RootfsType("xfs")
+	assert.EqualError(t, err, `unsupported ISO stage2 filesystem "xfs", supported: squashfs, ext4, erofs`)
+}
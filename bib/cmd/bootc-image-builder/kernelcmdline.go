@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/slices"
+
+	"github.com/osbuild/bootc-image-builder/bib/internal/imagetypes"
+)
+
+// kernelCmdline is a single --kernel-cmdline argument, the args are
+// only used for the given image types (or all types if none are set)
+type kernelCmdline struct {
+	Types []string
+	Args  string
+}
+
+// parseKernelCmdline parses a --kernel-cmdline argument of the form
+// "ARGS" or "type=TYPE[,TYPE...]:ARGS", the args may be quoted
+func parseKernelCmdline(s string) (kernelCmdline, error) {
+	var kc kernelCmdline
+
+	args := s
+	if scope, rest, ok := strings.Cut(s, ":"); ok && strings.HasPrefix(scope, "type=") {
+		for _, typ := range strings.Split(strings.TrimPrefix(scope, "type="), ",") {
+			if _, err := imagetypes.New(typ); err != nil {
+				return kc, fmt.Errorf("invalid kernel cmdline %q: %w", s, err)
+			}
+			kc.Types = append(kc.Types, typ)
+		}
+		args = rest
+	}
+	if len(args) >= 2 && args[0] == '"' && args[len(args)-1] == '"' {
+		args = args[1 : len(args)-1]
+	}
+	kc.Args = strings.TrimSpace(args)
+	if kc.Args == "" {
+		return kc, fmt.Errorf("invalid kernel cmdline %q: no kernel arguments", s)
+	}
+	return kc, nil
+}
+
+// kernelCmdlineForTypes returns the kernel arguments of all
+// --kernel-cmdline arguments that apply to the given image types.
+//
+// All disk (or ISO) types of a build share the same image, so scoped
+// arguments can only be used if they apply to all requested types.
+func kernelCmdlineForTypes(args []string, imgTypes imagetypes.ImageTypes) ([]string, error) {
+	var kargs []string
+	for _, arg := range args {
+		kc, err := parseKernelCmdline(arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(kc.Types) > 0 {
+			var matching, other []string
+			for _, typ := range imgTypes {
+				if slices.Contains(kc.Types, typ) {
+					matching = append(matching, typ)
+				} else {
+					other = append(other, typ)
+				}
+			}
+			if len(matching) == 0 {
+				continue
+			}
+			if len(other) > 0 {
+				return nil, fmt.Errorf("cannot use kernel cmdline %q only for %s: the image is shared with %s, build them separately", arg, strings.Join(matching, ","), strings.Join(other, ","))
+			}
+		}
+		kargs = append(kargs, kc.Args)
+	}
+	return kargs, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKernelCmdline(t *testing.T) {
+	for _, tc := range []struct {
+		arg         string
+		expected    kernelCmdline
+		expectedErr string
+	}{
+		{"console=ttyS0", kernelCmdline{Args: "console=ttyS0"}, ""},
+		{"console=ttyS0 quiet", kernelCmdline{Args: "console=ttyS0 quiet"}, ""},
+		{`type=ami:"console=ttyS0"`, kernelCmdline{Types: []string{"ami"}, Args: "console=ttyS0"}, ""},
+		{"type=raw,qcow2:console=tty0", kernelCmdline{Types: []string{"raw", "qcow2"}, Args: "console=tty0"}, ""},
+		// a ":" in the args is not a scope
+		{"rd.neednet=1 ip=dhcp:eth0", kernelCmdline{Args: "rd.neednet=1 ip=dhcp:eth0"}, ""},
+		{"type=foo:console=ttyS0", kernelCmdline{}, `invalid kernel cmdline "type=foo:console=ttyS0": unsupported image type "foo", valid types are ami, anaconda-iso, gce, iso, qcow2, raw, vagrant-libvirt, vhd, vhdx, vmdk`},
+		{`type=ami:""`, kernelCmdline{}, `invalid kernel cmdline "type=ami:\"\"": no kernel arguments`},
+		{"", kernelCmdline{}, `invalid kernel cmdline "": no kernel arguments`},
+	} {
+		kc, err := parseKernelCmdline(tc.arg)
+		if tc.expectedErr != "" {
+			assert.EqualError(t, err, tc.expectedErr)
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, kc)
+		}
+	}
+}
+
+func TestKernelCmdlineForTypes(t *testing.T) {
+	args := []string{"quiet", `type=ami:"console=ttyS0"`, "type=raw,qcow2:console=tty0"}
+
+	for _, tc := range []struct {
+		imgTypes    []string
+		expected    []string
+		expectedErr string
+	}{
+		{[]string{"ami"}, []string{"quiet", "console=ttyS0"}, ""},
+		{[]string{"qcow2"}, []string{"quiet", "console=tty0"}, ""},
+		{[]string{"raw", "qcow2"}, []string{"quiet", "console=tty0"}, ""},
+		{[]string{"vmdk"}, []string{"quiet"}, ""},
+		{[]string{"ami", "qcow2"}, nil, `cannot use kernel cmdline "type=ami:\"console=ttyS0\"" only for ami: the image is shared with qcow2, build them separately`},
+	} {
+		kargs, err := kernelCmdlineForTypes(args, tc.imgTypes)
+		if tc.expectedErr != "" {
+			assert.EqualError(t, err, tc.expectedErr)
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, kargs)
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"os"
 	"os/exec"
@@ -10,6 +13,7 @@ import (
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -19,10 +23,12 @@ import (
 	"github.com/osbuild/images/pkg/arch"
 	"github.com/osbuild/images/pkg/cloud/awscloud"
 	"github.com/osbuild/images/pkg/container"
+	"github.com/osbuild/images/pkg/disk"
 	"github.com/osbuild/images/pkg/dnfjson"
 	"github.com/osbuild/images/pkg/manifest"
 	"github.com/osbuild/images/pkg/osbuild"
 	"github.com/osbuild/images/pkg/rpmmd"
+	"github.com/osbuild/images/pkg/sbom"
 
 	"github.com/osbuild/bootc-image-builder/bib/internal/buildconfig"
 	podman_container "github.com/osbuild/bootc-image-builder/bib/internal/container"
@@ -50,6 +56,22 @@ var distroDefPaths = []string{
 	"/usr/share/bootc-image-builder/defs",
 }
 
+// defsPathsFromFlags returns the distro definition search paths with the
+// --defs-path directories first so that they take precedence
+func defsPathsFromFlags(flags *pflag.FlagSet) ([]string, error) {
+	customPaths, _ := flags.GetStringArray("defs-path")
+	for _, p := range customPaths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("cannot use defs path: %w", err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("cannot use defs path: %s is not a directory", p)
+		}
+	}
+	return append(slices.Clone(customPaths), distroDefPaths...), nil
+}
+
 var (
 	osGetuid = os.Getuid
 	osGetgid = os.Getgid
@@ -103,7 +125,12 @@ func getContainerSize(imgref string) (uint64, error) {
 	return size, nil
 }
 
-func makeManifest(c *ManifestConfig, solver *dnfjson.Solver, cacheRoot string) (manifest.OSBuildManifest, map[string][]rpmmd.RepoConfig, error) {
+// depsolver is the subset of the dnfjson.Solver that makeManifest needs
+type depsolver interface {
+	Depsolve(pkgSets []rpmmd.PackageSet, sbomType sbom.StandardType) (*dnfjson.DepsolveResult, error)
+}
+
+func makeManifest(c *ManifestConfig, solver depsolver, cacheRoot string) (manifest.OSBuildManifest, map[string]dnfjson.DepsolveResult, error) {
 	mani, err := Manifest(c)
 	if err != nil {
 		return nil, nil, fmt.Errorf("cannot get manifest: %w", err)
@@ -111,14 +138,27 @@ func makeManifest(c *ManifestConfig, solver *dnfjson.Solver, cacheRoot string) (
 
 	// depsolve packages
 	depsolvedSets := make(map[string]dnfjson.DepsolveResult)
-	depsolvedRepos := make(map[string][]rpmmd.RepoConfig)
-	for name, pkgSet := range mani.GetPackageSetChains() {
-		res, err := solver.Depsolve(pkgSet, 0)
+	pkgSetChains := mani.GetPackageSetChains()
+	if err := addBuildPackages(pkgSetChains, c.BuildPackages); err != nil {
+		return nil, nil, err
+	}
+	for name, pkgSet := range pkgSetChains {
+		if c.NoWeakDeps {
+			for i := range pkgSet {
+				pkgSet[i].InstallWeakDeps = false
+			}
+		}
+		applyDepsolveOptions(pkgSet, c.DepsolveOptions)
+		pkgSolver := solver
+		if name == buildPackageSetChain && c.BuildDepsolver != nil {
+			pkgSolver = c.BuildDepsolver
+		}
+		res, err := pkgSolver.Depsolve(pkgSet, 0)
 		if err != nil {
 			return nil, nil, fmt.Errorf("cannot depsolve: %w", err)
 		}
+		applyRepoMirrors(res, c.RepoMirrors)
 		depsolvedSets[name] = *res
-		depsolvedRepos[name] = res.Repos
 	}
 
 	// Resolve container - the normal case is that host and target
@@ -128,8 +168,7 @@ func makeManifest(c *ManifestConfig, solver *dnfjson.Solver, cacheRoot string) (
 	// is fast enough (given that it's mostly I/O and all I/O is
 	// run naively via syscall translation)
 
-	// XXX: should NewResolver() take "arch.Arch"?
-	resolver := container.NewResolver(c.Architecture.String())
+	resolver := newContainerResolver(c.Architecture, c.PlatformVariant, c.CACertDir, c.ResolveConcurrency)
 
 	containerSpecs := make(map[string][]container.Spec)
 	for plName, sourceSpecs := range mani.GetContainerSourceSpecs() {
@@ -148,126 +187,480 @@ func makeManifest(c *ManifestConfig, solver *dnfjson.Solver, cacheRoot string) (
 		containerSpecs[plName] = specs
 	}
 
-	var opts manifest.SerializeOptions
-	if c.UseLibrepo {
-		opts.RpmDownloader = osbuild.RpmDownloaderLibrepo
+	opts := manifest.SerializeOptions{
+		RpmDownloader: c.RpmDownloader,
 	}
 	mf, err := mani.Serialize(depsolvedSets, containerSpecs, nil, &opts)
 	if err != nil {
 		return nil, nil, fmt.Errorf("[ERROR] manifest serialization failed: %s", err.Error())
 	}
-	return mf, depsolvedRepos, nil
+	if slices.Contains(c.ImageTypes, "vhdx") {
+		mf, err = addVhdxPipeline(mf)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return mf, depsolvedSets, nil
 }
 
-func saveManifest(ms manifest.OSBuildManifest, fpath string) error {
-	b, err := json.MarshalIndent(ms, "", "  ")
+// manifestSavePath returns the path the manifest is saved to during
+// build: the --manifest-path if set or the derived name in the output
+// directory. An empty path is returned for --no-save-manifest.
+func manifestSavePath(outputDir, manifestFname, manifestPath string, noSave bool) (string, error) {
+	if noSave {
+		return "", nil
+	}
+	if manifestPath == "" {
+		return filepath.Join(outputDir, manifestFname), nil
+	}
+
+	// check early that the manifest can be written, the build
+	// takes a long time and should not fail at the end
+	dir := filepath.Dir(manifestPath)
+	fp, err := os.CreateTemp(dir, ".bib-manifest-check-")
 	if err != nil {
-		return fmt.Errorf("failed to marshal data for %q: %s", fpath, err.Error())
+		return "", fmt.Errorf("cannot write manifest to %q: %w", dir, err)
 	}
-	b = append(b, '\n') // add new line at end of file
+	fp.Close()
+	if err := os.Remove(fp.Name()); err != nil {
+		return "", err
+	}
+	return manifestPath, nil
+}
+
+// saveManifest writes the manifest to the given path. The manifest is
+// encoded directly into the file to avoid keeping a second (indented)
+// copy of a potentially large manifest in memory.
+func saveManifest(pbar progress.ProgressBar, ms manifest.OSBuildManifest, fpath string) (err error) {
+	pbar.SetMessagef("Saving manifest %s", filepath.Base(fpath))
+
 	fp, err := os.Create(fpath)
 	if err != nil {
 		return fmt.Errorf("failed to create output file %q: %s", fpath, err.Error())
 	}
-	defer fp.Close()
-	if _, err := fp.Write(b); err != nil {
+	defer func() {
+		if cerr := fp.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("failed to close output file %q: %s", fpath, cerr.Error())
+		}
+	}()
+
+	// Encode() adds a new line at the end of the file
+	enc := json.NewEncoder(fp)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(ms); err != nil {
 		return fmt.Errorf("failed to write output file %q: %s", fpath, err.Error())
 	}
+
+	pbar.SetMessagef("Saved manifest %s", filepath.Base(fpath))
 	return nil
 }
 
-// manifestFromCobra generate an osbuild manifest from a cobra commandline.
-//
-// It takes an unstarted progres bar and will start it at the right
-// point (it cannot be started yet to avoid the "podman pull" progress
-// and our progress fighting). The caller is responsible for stopping
-// the progress bar (this function cannot know what else needs to happen
-// after manifest generation).
-//
-// TODO: provide a podman progress reader to integrate the podman progress
-// into our progress.
-func manifestFromCobra(cmd *cobra.Command, args []string, pbar progress.ProgressBar) ([]byte, *mTLSConfig, error) {
-	cntArch := arch.Current()
+// osbuildError wraps a failed osbuild run so that the error (and thus
+// bug reports) points to the manifest that was built. The manifest
+// itself is only logged at debug level as it can be very large.
+func osbuildError(err error, mf manifest.OSBuildManifest, manifestPath string) error {
+	logrus.Debugf("manifest of the failed build:\n%s", mf)
+	if manifestPath == "" {
+		return fmt.Errorf("cannot run osbuild (run without --no-save-manifest to keep the manifest): %w", err)
+	}
+	return fmt.Errorf("cannot run osbuild (manifest: %s): %w", manifestPath, err)
+}
 
+// ManifestOptions are the options for the manifest generation, they
+// are independent of the commandline so that the manifest generation
+// can be used without cobra.
+type ManifestOptions struct {
+	Imgref     string
+	ImageTypes []string
+	// Config is the (already loaded) user config, it must not be nil
+	Config *buildconfig.BuildConfig
+
+	// TargetArch is the architecture to build for, empty means the
+	// architecture of the host
+	TargetArch      string
+	PlatformVariant string
+	// RootFSType overrides the default root filesystem type of the
+	// container
+	RootFSType   string
+	RpmCacheRoot string
+	// RefreshRpmCache removes the cached repository metadata before
+	// depsolving
+	RefreshRpmCache bool
+	// DepsolveTimeout limits the time of each depsolve, zero means
+	// no limit
+	DepsolveTimeout time.Duration
+	RpmDownloader   osbuild.RpmDownloader
+	TargetImgref    string
+	// BuildImgref is the container used for the ISO build root
+	// instead of Imgref
+	BuildImgref string
+
+	DistroDefPaths     []string
+	RepoMirrors        map[string]string
+	NoWeakDeps         bool
+	DepsolveOptions    *DepsolveOptions
+	FSLabels           map[string]string
+	FSUUIDs            map[string]string
+	PartitionAlignment uint64
+	MaxImageSize       uint64
+	PartitionOrder     []string
+	PartitionTableType disk.PartitionTableType
+	DracutAddModules   []string
+	ISOStage2FS        string
+	InstallerPackages  []string
+	BuildPackages      []string
+	AllowVarPartition  bool
+	UEFIVendor         string
+	RWRoot             bool
+	SkipSELinux        bool
+	OSReleaseID        string
+	OSReleaseVersion   string
+	// KernelCmdline are the unparsed "[type=TYPE[,TYPE]:]ARGS" kernel
+	// arguments
+	KernelCmdline []string
+	Firmware      string
+	// SerialConsole replaces the default ttyS0 console of disk images
+	SerialConsole string
+	// Seed makes the generated UUIDs (and so the manifest)
+	// reproducible, 0 means a random seed
+	Seed int64
+	// ResolveConcurrency limits the number of concurrent container
+	// resolves, 0 means no limit
+	ResolveConcurrency int
+	// OstreeCommit is the expected ostree commit of the container
+	OstreeCommit string
+	// CACerts are the paths of extra CA certificates for the
+	// container registries and the rpm repositories
+	CACerts []string
+	// PackageListPath is the file the NEVRAs of the depsolved
+	// packages are written to
+	PackageListPath string
+	// ProxyEnv is the proxy environment for --proxy and --no-proxy,
+	// it is applied to the bib process by generateManifest
+	ProxyEnv []string
+}
+
+// manifestOptionsFromCobra collects the manifest options from a cobra
+// commandline, only the syntax of the options is checked here.
+func manifestOptionsFromCobra(cmd *cobra.Command, args []string) (*ManifestOptions, error) {
 	imgref := args[0]
 	userConfigFile, _ := cmd.Flags().GetString("config")
+	configSha256, _ := cmd.Flags().GetString("config-sha256")
 	imgTypes, _ := cmd.Flags().GetStringArray("type")
 	rpmCacheRoot, _ := cmd.Flags().GetString("rpmmd")
-	targetArch, _ := cmd.Flags().GetString("target-arch")
+	refreshRpmCache, _ := cmd.Flags().GetBool("refresh-cache")
+	depsolveTimeout, _ := cmd.Flags().GetDuration("depsolve-timeout")
 	rootFs, _ := cmd.Flags().GetString("rootfs")
-	useLibrepo, _ := cmd.Flags().GetBool("use-librepo")
+	targetImgref, _ := cmd.Flags().GetString("target-imgref")
+	buildImgref, _ := cmd.Flags().GetString("build-container")
+	repoMirrorArgs, _ := cmd.Flags().GetStringArray("repo-mirror")
+	noWeakDeps, _ := cmd.Flags().GetBool("no-weak-deps")
+	depsolveOptionArgs, _ := cmd.Flags().GetStringArray("depsolve-option")
+	fsLabelArgs, _ := cmd.Flags().GetStringArray("fs-label")
+	fsUUIDArgs, _ := cmd.Flags().GetStringArray("fs-uuid")
+	partitionAlignmentArg, _ := cmd.Flags().GetString("partition-alignment")
+	maxImageSizeArg, _ := cmd.Flags().GetString("max-image-size")
+	partitionOrder, _ := cmd.Flags().GetStringArray("partition-order")
+	partitionTableArg, _ := cmd.Flags().GetString("partition-table")
+	dracutAddModules, _ := cmd.Flags().GetStringArray("dracut-add-module")
+	isoStage2FS, _ := cmd.Flags().GetString("iso-stage2-fs")
+	installerPackages, _ := cmd.Flags().GetStringArray("installer-package")
+	buildPackages, _ := cmd.Flags().GetStringArray("build-package")
+	allowVarPartition, _ := cmd.Flags().GetBool("allow-var-partition")
+	uefiVendor, _ := cmd.Flags().GetString("uefi-vendor")
+	rwRoot, _ := cmd.Flags().GetBool("rw-root")
+	skipSELinux, _ := cmd.Flags().GetBool("experimental-skip-selinux")
+	osReleaseID, _ := cmd.Flags().GetString("os-release-id")
+	osReleaseVersion, _ := cmd.Flags().GetString("os-release-version")
+	kernelCmdlineArgs, _ := cmd.Flags().GetStringArray("kernel-cmdline")
+	firmware, _ := cmd.Flags().GetString("firmware")
+	serialConsole, _ := cmd.Flags().GetString("serial-console")
+	seed, _ := cmd.Flags().GetInt64("seed")
+	resolveConcurrency, _ := cmd.Flags().GetInt("resolve-concurrency")
+	caCerts, _ := cmd.Flags().GetStringArray("ca-cert")
+	ostreeCommit, _ := cmd.Flags().GetString("ostree-commit")
+	packageListPath, _ := cmd.Flags().GetString("package-list")
+	proxy, _ := cmd.Flags().GetString("proxy")
+	noProxy, _ := cmd.Flags().GetString("no-proxy")
+
+	targetArch, platformVariant, err := targetArchAndVariant(cmd.Flags())
+	if err != nil {
+		return nil, err
+	}
+	rpmDownloader, err := rpmDownloaderFromFlags(cmd.Flags())
+	if err != nil {
+		return nil, err
+	}
+	repoMirrors, err := parseRepoMirrors(repoMirrorArgs)
+	if err != nil {
+		return nil, err
+	}
+	depsolveOptions, err := parseDepsolveOptions(depsolveOptionArgs)
+	if err != nil {
+		return nil, err
+	}
+	fsLabels, err := parseFSLabels(fsLabelArgs)
+	if err != nil {
+		return nil, err
+	}
+	fsUUIDs, err := parseFSUUIDs(fsUUIDArgs)
+	if err != nil {
+		return nil, err
+	}
+	partitionAlignment, err := parsePartitionAlignment(partitionAlignmentArg)
+	if err != nil {
+		return nil, err
+	}
+	maxImageSize, err := parseMaxImageSize(maxImageSizeArg)
+	if err != nil {
+		return nil, err
+	}
+	partitionTableType, err := parsePartitionTableType(partitionTableArg)
+	if err != nil {
+		return nil, err
+	}
+	proxyVars, err := proxyEnv(proxy, noProxy)
+	if err != nil {
+		return nil, err
+	}
+	defsPaths, err := defsPathsFromFlags(cmd.Flags())
+	if err != nil {
+		return nil, err
+	}
 
 	// If --local was given, warn in the case of --local or --local=true (true is the default), error in the case of --local=false
 	if cmd.Flags().Changed("local") {
 		localStorage, _ := cmd.Flags().GetBool("local")
 		if localStorage {
-			fmt.Fprintf(os.Stderr, "WARNING: --local is now the default behavior, you can remove it from the command line\n")
+			warnings.Warnf("--local is now the default behavior, you can remove it from the command line")
 		} else {
-			return nil, nil, fmt.Errorf(`--local=false is no longer supported, remove it and make sure to pull the container before running bib:
+			return nil, fmt.Errorf(`--local=false is no longer supported, remove it and make sure to pull the container before running bib:
 	sudo podman pull %s`, imgref)
 		}
 	}
 
-	if targetArch != "" && arch.FromString(targetArch) != arch.Current() {
+	cliUser, err := userFromFlags(cmd.Flags())
+	if err != nil {
+		return nil, err
+	}
+	config, err := readUserConfig(userConfigFile, configSha256, httpProxy(proxy, noProxy))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config: %w", err)
+	}
+	addUser(config, cliUser)
+
+	return &ManifestOptions{
+		Imgref:     imgref,
+		ImageTypes: imgTypes,
+		Config:     config,
+
+		TargetArch:      targetArch,
+		PlatformVariant: platformVariant,
+		RootFSType:      rootFs,
+		RpmCacheRoot:    rpmCacheRoot,
+		RefreshRpmCache: refreshRpmCache,
+		DepsolveTimeout: depsolveTimeout,
+		RpmDownloader:   rpmDownloader,
+		TargetImgref:    targetImgref,
+		BuildImgref:     buildImgref,
+
+		DistroDefPaths:     defsPaths,
+		RepoMirrors:        repoMirrors,
+		NoWeakDeps:         noWeakDeps,
+		DepsolveOptions:    depsolveOptions,
+		FSLabels:           fsLabels,
+		FSUUIDs:            fsUUIDs,
+		PartitionAlignment: partitionAlignment,
+		MaxImageSize:       maxImageSize,
+		PartitionOrder:     partitionOrder,
+		PartitionTableType: partitionTableType,
+		DracutAddModules:   dracutAddModules,
+		ISOStage2FS:        isoStage2FS,
+		InstallerPackages:  installerPackages,
+		BuildPackages:      buildPackages,
+		AllowVarPartition:  allowVarPartition,
+		UEFIVendor:         uefiVendor,
+		RWRoot:             rwRoot,
+		SkipSELinux:        skipSELinux,
+		OSReleaseID:        osReleaseID,
+		OSReleaseVersion:   osReleaseVersion,
+		KernelCmdline:      kernelCmdlineArgs,
+		Firmware:           firmware,
+		SerialConsole:      serialConsole,
+		Seed:               seed,
+		ResolveConcurrency: resolveConcurrency,
+		CACerts:            caCerts,
+		OstreeCommit:       ostreeCommit,
+		PackageListPath:    packageListPath,
+		ProxyEnv:           proxyVars,
+	}, nil
+}
+
+// manifestFromCobra generate an osbuild manifest from a cobra commandline.
+//
+// It takes an unstarted progres bar and will start it at the right
+// point (it cannot be started yet to avoid the "podman pull" progress
+// and our progress fighting). The caller is responsible for stopping
+// the progress bar (this function cannot know what else needs to happen
+// after manifest generation).
+func manifestFromCobra(cmd *cobra.Command, args []string, pbar progress.ProgressBar) ([]byte, *mTLSConfig, []byte, string, error) {
+	opts, err := manifestOptionsFromCobra(cmd, args)
+	if err != nil {
+		return nil, nil, nil, "", err
+	}
+	return generateManifest(opts, pbar)
+}
+
+// generateManifest generates an osbuild manifest for the container
+// in opts.Imgref, the container must be available in the container
+// storage. See manifestFromCobra for the handling of the progress bar.
+// Next to the manifest it returns the mTLS config and the --ca-cert
+// bundle that osbuild needs to fetch the sources and the input hash.
+//
+// TODO: provide a podman progress reader to integrate the podman progress
+// into our progress.
+func generateManifest(opts *ManifestOptions, pbar progress.ProgressBar) ([]byte, *mTLSConfig, []byte, string, error) {
+	cntArch := arch.Current()
+	imgref := opts.Imgref
+
+	if err := setup.ValidateImgref(imgref); err != nil {
+		return nil, nil, nil, "", err
+	}
+	if err := validatePartitionOrder(opts.PartitionOrder); err != nil {
+		return nil, nil, nil, "", err
+	}
+	if err := validateOstreeCommitArg(opts.OstreeCommit); err != nil {
+		return nil, nil, nil, "", err
+	}
+	if err := setupProxy(opts.ProxyEnv); err != nil {
+		return nil, nil, nil, "", err
+	}
+
+	if opts.TargetArch != "" && arch.FromString(opts.TargetArch) != arch.Current() {
 		// TODO: detect if binfmt_misc for target arch is
 		// available, e.g. by mounting the binfmt_misc fs into
 		// the container and inspects the files or by
 		// including tiny statically linked target-arch
 		// binaries inside our bib container
-		fmt.Fprintf(os.Stderr, "WARNING: target-arch is experimental and needs an installed 'qemu-user' package\n")
-		if slices.Contains(imgTypes, "iso") {
-			return nil, nil, fmt.Errorf("cannot build iso for different target arches yet")
+		warnings.Warnf("target-arch is experimental and needs an installed 'qemu-user' package")
+		if slices.Contains(opts.ImageTypes, "iso") {
+			return nil, nil, nil, "", fmt.Errorf("cannot build iso for different target arches yet")
 		}
-		cntArch = arch.FromString(targetArch)
+		cntArch = arch.FromString(opts.TargetArch)
 	}
 	// TODO: add "target-variant", see https://github.com/osbuild/bootc-image-builder/pull/139/files#r1467591868
 
-	if err := setup.ValidateHasContainerStorageMounted(); err != nil {
-		return nil, nil, fmt.Errorf("could not access container storage, did you forget -v /var/lib/containers/storage:/var/lib/containers/storage? (%w)", err)
+	imageTypes, err := imagetypes.New(opts.ImageTypes...)
+	if err != nil {
+		return nil, nil, nil, "", fmt.Errorf("cannot detect build types %v: %w", opts.ImageTypes, err)
 	}
-
-	imageTypes, err := imagetypes.New(imgTypes...)
+	if err := validateDracutModules(opts.DracutAddModules, imageTypes.BuildsISO()); err != nil {
+		return nil, nil, nil, "", err
+	}
+	if opts.ISOStage2FS != "" && !imageTypes.BuildsISO() {
+		return nil, nil, nil, "", fmt.Errorf("--iso-stage2-fs is only supported for ISO image types")
+	}
+	if _, err := isoStage2RootfsType(opts.ISOStage2FS); err != nil {
+		return nil, nil, nil, "", err
+	}
+	if err := validateInstallerPackages(opts.InstallerPackages, imageTypes.BuildsISO()); err != nil {
+		return nil, nil, nil, "", err
+	}
+	if err := validateBuildPackages(opts.BuildPackages, imageTypes.BuildsISO()); err != nil {
+		return nil, nil, nil, "", err
+	}
+	if err := validateBuildContainer(opts.BuildImgref, imageTypes.BuildsISO()); err != nil {
+		return nil, nil, nil, "", err
+	}
+	if opts.Firmware != "" && imageTypes.BuildsISO() {
+		return nil, nil, nil, "", fmt.Errorf("--firmware is only supported for disk image types")
+	}
+	if opts.PartitionTableType != disk.PT_NONE && imageTypes.BuildsISO() {
+		return nil, nil, nil, "", fmt.Errorf("--partition-table is only supported for disk image types")
+	}
+	if opts.MaxImageSize != 0 && imageTypes.BuildsISO() {
+		return nil, nil, nil, "", fmt.Errorf("--max-image-size is only supported for disk image types")
+	}
+	if opts.SerialConsole != "" && imageTypes.BuildsISO() {
+		return nil, nil, nil, "", fmt.Errorf("--serial-console is only supported for disk image types")
+	}
+	if opts.SkipSELinux && imageTypes.BuildsISO() {
+		return nil, nil, nil, "", fmt.Errorf("--experimental-skip-selinux is only supported for disk image types")
+	}
+	if opts.PackageListPath != "" && !imageTypes.BuildsISO() {
+		return nil, nil, nil, "", fmt.Errorf("--package-list is only supported for ISO image types, the packages of disk images come from the container")
+	}
+	if err := validateFirmware(opts.Firmware, cntArch); err != nil {
+		return nil, nil, nil, "", err
+	}
+	if err := validateSerialConsole(opts.SerialConsole); err != nil {
+		return nil, nil, nil, "", err
+	}
+	if err := validateResolveConcurrency(opts.ResolveConcurrency); err != nil {
+		return nil, nil, nil, "", err
+	}
+	if err := validateDepsolveOptions(opts.DepsolveOptions, opts.NoWeakDeps); err != nil {
+		return nil, nil, nil, "", err
+	}
+	kernelCmdline, err := kernelCmdlineForTypes(opts.KernelCmdline, imageTypes)
 	if err != nil {
-		return nil, nil, fmt.Errorf("cannot detect build types %v: %w", imgTypes, err)
+		return nil, nil, nil, "", err
 	}
-
-	config, err := buildconfig.ReadWithFallback(userConfigFile)
+	if err := validateUserSSHKeys(opts.Config); err != nil {
+		return nil, nil, nil, "", err
+	}
+	if opts.Seed != 0 {
+		if users := plaintextPasswordUsers(opts.Config); len(users) > 0 {
+			warnings.Warnf("the password of %s is hashed with a random salt, use a password hash for a reproducible manifest", strings.Join(users, ", "))
+		}
+	}
+	if err := validateConfigForImageTypes(opts.Config, imageTypes); err != nil {
+		return nil, nil, nil, "", err
+	}
+	caBundle, err := readCACerts(opts.CACerts)
 	if err != nil {
-		return nil, nil, fmt.Errorf("cannot read config: %w", err)
+		return nil, nil, nil, "", err
+	}
+
+	if err := setup.ValidateHasContainerStorageMounted(); err != nil {
+		return nil, nil, nil, "", fmt.Errorf("could not access container storage, did you forget -v /var/lib/containers/storage:/var/lib/containers/storage? (%w)", err)
 	}
 
 	pbar.SetPulseMsgf("Manifest generation step")
 	pbar.Start()
 
 	if err := setup.ValidateHasContainerTags(imgref); err != nil {
-		return nil, nil, err
+		return nil, nil, nil, "", err
 	}
 
 	cntSize, err := getContainerSize(imgref)
 	if err != nil {
-		return nil, nil, fmt.Errorf("cannot get container size: %w", err)
+		return nil, nil, nil, "", fmt.Errorf("cannot get container size: %w", err)
 	}
 	container, err := podman_container.New(imgref)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, "", err
 	}
 	defer func() {
 		if err := container.Stop(); err != nil {
 			logrus.Warnf("error stopping container: %v", err)
 		}
 	}()
+	if err := setup.ValidateBootcVersion(imgref, container); err != nil {
+		return nil, nil, nil, "", err
+	}
 
 	var rootfsType string
 	if !imageTypes.BuildsISO() {
-		if rootFs != "" {
-			rootfsType = rootFs
+		if opts.RootFSType != "" {
+			rootfsType = opts.RootFSType
 		} else {
 			rootfsType, err = container.DefaultRootfsType()
 			if err != nil {
-				return nil, nil, fmt.Errorf("cannot get rootfs type for container: %w", err)
+				return nil, nil, nil, "", fmt.Errorf("cannot get rootfs type for container: %w", err)
 			}
 			if rootfsType == "" {
-				return nil, nil, fmt.Errorf(`no default root filesystem type specified in container, please use "--rootfs" to set manually`)
+				return nil, nil, nil, "", fmt.Errorf(`no default root filesystem type specified in container, please use "--rootfs" to set manually`)
 			}
 		}
 
@@ -279,52 +672,154 @@ func manifestFromCobra(cmd *cobra.Command, args []string, pbar progress.Progress
 		// and is expected to be included in v9.1.0 https://github.com/qemu/qemu/commit/e6e903db6a5e960e595f9f1fd034adb942dd9508
 		// Remove the following condition once we update to qemu-user v9.1.0.
 		if cntArch != arch.Current() && rootfsType != "ext4" {
-			logrus.Warningf("container preferred root filesystem %q cannot be used during cross arch build", rootfsType)
+			warnings.Warnf("container preferred root filesystem %q cannot be used during cross arch build", rootfsType)
 			rootfsType = "ext4"
 		}
 	}
+	if err := verifyOstreeCommit(container.Root(), opts.OstreeCommit); err != nil {
+		return nil, nil, nil, "", err
+	}
 	// Gather some data from the containers distro
 	sourceinfo, err := source.LoadInfo(container.Root())
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, "", err
+	}
+	if opts.UEFIVendor != "" {
+		if err := sourceinfo.SetUEFIVendor(container.Root(), opts.UEFIVendor); err != nil {
+			return nil, nil, nil, "", err
+		}
 	}
 
 	// This is needed just for RHEL and RHSM in most cases, but let's run it every time in case
 	// the image has some non-standard dnf plugins.
 	if err := container.InitDNF(); err != nil {
-		return nil, nil, err
+		return nil, nil, nil, "", err
 	}
-	solver, err := container.NewContainerSolver(rpmCacheRoot, cntArch, sourceinfo)
+	solver, err := container.NewContainerSolver(opts.RpmCacheRoot, cntArch, sourceinfo)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, "", err
+	}
+	if opts.RefreshRpmCache {
+		if err := refreshRpmmdCache(solver); err != nil {
+			return nil, nil, nil, "", err
+		}
+	}
+	// the overrides are only used for the distro detection, the
+	// depsolving always uses the real os-release of the container
+	if err := overrideOSRelease(&sourceinfo.OSRelease, opts.OSReleaseID, opts.OSReleaseVersion); err != nil {
+		return nil, nil, nil, "", err
 	}
 
 	manifestConfig := &ManifestConfig{
 		Architecture:   cntArch,
-		Config:         config,
+		Config:         opts.Config,
 		ImageTypes:     imageTypes,
 		Imgref:         imgref,
 		RootfsMinsize:  cntSize * containerSizeToDiskSizeMultiplier,
-		DistroDefPaths: distroDefPaths,
+		DistroDefPaths: opts.DistroDefPaths,
 		SourceInfo:     sourceinfo,
 		RootFSType:     rootfsType,
-		UseLibrepo:     useLibrepo,
+		RpmDownloader:  opts.RpmDownloader,
+		TargetImgref:   opts.TargetImgref,
+		BuildImgref:    opts.BuildImgref,
+
+		PlatformVariant: opts.PlatformVariant,
+		RepoMirrors:     opts.RepoMirrors,
+		NoWeakDeps:      opts.NoWeakDeps,
+		DepsolveOptions: opts.DepsolveOptions,
+		FSLabels:        opts.FSLabels,
+		FSUUIDs:         opts.FSUUIDs,
+
+		PartitionAlignment: opts.PartitionAlignment,
+		MaxImageSize:       opts.MaxImageSize,
+		PartitionOrder:     opts.PartitionOrder,
+		PartitionTableType: opts.PartitionTableType,
+		DracutAddModules:   opts.DracutAddModules,
+		ISOStage2FS:        opts.ISOStage2FS,
+		InstallerPackages:  opts.InstallerPackages,
+		BuildPackages:      opts.BuildPackages,
+		AllowVarPartition:  opts.AllowVarPartition,
+		RWRoot:             opts.RWRoot,
+		SkipSELinux:        opts.SkipSELinux,
+		KernelCmdline:      kernelCmdline,
+		Firmware:           opts.Firmware,
+		SerialConsole:      opts.SerialConsole,
+		Seed:               opts.Seed,
+		ResolveConcurrency: opts.ResolveConcurrency,
+	}
+	if len(caBundle) > 0 {
+		caCertDir, cleanup, err := prepareCACerts(caBundle)
+		if err != nil {
+			return nil, nil, nil, "", err
+		}
+		defer cleanup()
+		manifestConfig.CACertDir = caCertDir
+	}
+
+	if opts.BuildImgref != "" {
+		if err := setup.ValidateHasContainerTags(opts.BuildImgref); err != nil {
+			return nil, nil, nil, "", err
+		}
+		buildContainer, err := podman_container.New(opts.BuildImgref)
+		if err != nil {
+			return nil, nil, nil, "", err
+		}
+		defer func() {
+			if err := buildContainer.Stop(); err != nil {
+				logrus.Warnf("error stopping build container: %v", err)
+			}
+		}()
+		buildSourceInfo, err := source.LoadInfo(buildContainer.Root())
+		if err != nil {
+			return nil, nil, nil, "", err
+		}
+		if err := buildContainer.InitDNF(); err != nil {
+			return nil, nil, nil, "", err
+		}
+		buildSolver, err := buildContainer.NewContainerSolver(opts.RpmCacheRoot, cntArch, buildSourceInfo)
+		if err != nil {
+			return nil, nil, nil, "", err
+		}
+		if opts.RefreshRpmCache {
+			if err := refreshRpmmdCache(buildSolver); err != nil {
+				return nil, nil, nil, "", err
+			}
+		}
+		manifestConfig.BuildSourceInfo = buildSourceInfo
+		manifestConfig.BuildDepsolver = withDepsolveTimeout(buildSolver, opts.DepsolveTimeout)
 	}
 
-	manifest, repos, err := makeManifest(manifestConfig, solver, rpmCacheRoot)
+	manifest, depsolvedSets, err := makeManifest(manifestConfig, withDepsolveTimeout(solver, opts.DepsolveTimeout), opts.RpmCacheRoot)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, "", err
+	}
+	if opts.PackageListPath != "" {
+		if err := writePackageList(opts.PackageListPath, depsolvedSets); err != nil {
+			return nil, nil, nil, "", err
+		}
 	}
 
+	repos := make(map[string][]rpmmd.RepoConfig, len(depsolvedSets))
+	for name, res := range depsolvedSets {
+		repos[name] = res.Repos
+	}
 	mTLS, err := extractTLSKeys(SimpleFileReader{}, repos)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, "", err
+	}
+	hash, err := inputHash(manifest, manifestConfig)
+	if err != nil {
+		return nil, nil, nil, "", err
 	}
 
-	return manifest, mTLS, nil
+	return manifest, mTLS, caBundle, hash, nil
 }
 
 func cmdManifest(cmd *cobra.Command, args []string) error {
+	if format, _ := cmd.Flags().GetString("print-config"); format != "" {
+		return printConfig(cmd, args, format)
+	}
+
 	pbar, err := progress.New("")
 	if err != nil {
 		// this should never happen
@@ -332,7 +827,7 @@ func cmdManifest(cmd *cobra.Command, args []string) error {
 	}
 	defer pbar.Stop()
 
-	mf, _, err := manifestFromCobra(cmd, args, pbar)
+	mf, _, _, _, err := manifestFromCobra(cmd, args, pbar)
 	if err != nil {
 		return fmt.Errorf("cannot generate manifest: %w", err)
 	}
@@ -344,6 +839,12 @@ func handleAWSFlags(cmd *cobra.Command) (upload bool, err error) {
 	imgTypes, _ := cmd.Flags().GetStringArray("type")
 	region, _ := cmd.Flags().GetString("aws-region")
 	if region == "" {
+		if cmd.Flags().Changed("aws-arch") {
+			return false, fmt.Errorf("--aws-arch requires --aws-region")
+		}
+		if cmd.Flags().Changed("aws-confirm") {
+			return false, fmt.Errorf("--aws-confirm requires --aws-region")
+		}
 		return false, nil
 	}
 	bucketName, _ := cmd.Flags().GetString("aws-bucket")
@@ -351,6 +852,13 @@ func handleAWSFlags(cmd *cobra.Command) (upload bool, err error) {
 	if !slices.Contains(imgTypes, "ami") {
 		return false, fmt.Errorf("aws flags set for non-ami image type (type is set to %s)", strings.Join(imgTypes, ","))
 	}
+	targetArch, _, err := targetArchAndVariant(cmd.Flags())
+	if err != nil {
+		return false, err
+	}
+	if _, err := awsRegisterArch(cmd.Flags(), targetArch); err != nil {
+		return false, err
+	}
 
 	// check as many permission prerequisites as possible before starting
 	client, err := awscloud.NewDefault(region)
@@ -385,34 +893,80 @@ func handleAWSFlags(cmd *cobra.Command) (upload bool, err error) {
 	if !writePermission {
 		return false, fmt.Errorf("you don't have write permissions to bucket '%s' with the given AWS account", bucketName)
 	}
+	if confirm, _ := cmd.Flags().GetBool("aws-confirm"); confirm {
+		logrus.Info("Checking for existing AMIs...")
+		imageName, _ := cmd.Flags().GetString("aws-ami-name")
+		assumeYes, _ := cmd.Flags().GetBool("yes")
+		finder, err := newAWSImageFinder(region)
+		if err != nil {
+			return false, err
+		}
+		if err := confirmAMIName(finder, imageName, assumeYes); err != nil {
+			return false, err
+		}
+	}
 	logrus.Info("Upload conditions met.")
 	return true, nil
 }
 
-func cmdBuild(cmd *cobra.Command, args []string) error {
+func cmdBuild(cmd *cobra.Command, args []string) (err error) {
+	if format, _ := cmd.Flags().GetString("print-config"); format != "" {
+		return printConfig(cmd, args, format)
+	}
+	startedOn := time.Now()
+
 	chown, _ := cmd.Flags().GetString("chown")
+	chownStoreDir, _ := cmd.Flags().GetBool("chown-store")
 	imgTypes, _ := cmd.Flags().GetStringArray("type")
 	osbuildStore, _ := cmd.Flags().GetString("store")
 	outputDir, _ := cmd.Flags().GetString("output")
-	targetArch, _ := cmd.Flags().GetString("target-arch")
+	noCreateOutput, _ := cmd.Flags().GetBool("no-create-output")
+	outputModeArg, _ := cmd.Flags().GetString("output-mode")
 	progressType, _ := cmd.Flags().GetString("progress")
+	postBuild, _ := cmd.Flags().GetString("post-build")
+	annotationArgs, _ := cmd.Flags().GetStringArray("annotation")
+	eventSocket, _ := cmd.Flags().GetString("event-socket")
+	progressFd, _ := cmd.Flags().GetInt("progress-fd")
+	onlyExports, _ := cmd.Flags().GetStringArray("only-export")
+	checkpoints, _ := cmd.Flags().GetStringArray("checkpoint")
+	verifyBoot, _ := cmd.Flags().GetBool("verify-boot")
+	manifestPathArg, _ := cmd.Flags().GetString("manifest-path")
+	noSaveManifest, _ := cmd.Flags().GetBool("no-save-manifest")
+	skipIfUnchanged, _ := cmd.Flags().GetBool("skip-if-unchanged")
+	provenancePath, _ := cmd.Flags().GetString("provenance")
+	ostreeCommit, _ := cmd.Flags().GetString("ostree-commit")
+	packageListPath, _ := cmd.Flags().GetString("package-list")
+	debugBundlePath, _ := cmd.Flags().GetString("debug-bundle")
+	skipEnvironmentSetup, _ := cmd.Flags().GetBool("skip-environment-setup")
+	stageTimingsPath, _ := cmd.Flags().GetString("stage-timings")
+	scratchOutputMode, _ := cmd.Flags().GetString("scratch-output")
+	targetArch, _, err := targetArchAndVariant(cmd.Flags())
+	if err != nil {
+		return err
+	}
+	annotations, err := parseAnnotations(annotationArgs)
+	if err != nil {
+		return err
+	}
+	outputMode, err := parseOutputMode(outputModeArg)
+	if err != nil {
+		return err
+	}
 
 	logrus.Debug("Validating environment")
 	if err := setup.Validate(targetArch); err != nil {
 		return fmt.Errorf("cannot validate the setup: %w", err)
 	}
-	logrus.Debug("Ensuring environment setup")
-	switch inContainerOrUnknown() {
-	case false:
-		fmt.Fprintf(os.Stderr, "WARNING: running outside a container, this is an unsupported configuration\n")
-	case true:
-		if err := setup.EnsureEnvironment(osbuildStore); err != nil {
-			return fmt.Errorf("cannot ensure the environment: %w", err)
-		}
+	if err := ensureEnvironment(osbuildStore, skipEnvironmentSetup); err != nil {
+		return err
 	}
 
-	if err := os.MkdirAll(outputDir, 0o777); err != nil {
-		return fmt.Errorf("cannot setup build dir: %w", err)
+	if err := prepareOutputDir(outputDir, noCreateOutput, outputMode); err != nil {
+		return err
+	}
+	scratchOutput, err := useScratchOutput(scratchOutputMode, outputDir)
+	if err != nil {
+		return err
 	}
 
 	upload, err := handleAWSFlags(cmd)
@@ -427,16 +981,46 @@ func cmdBuild(cmd *cobra.Command, args []string) error {
 	if !canChown && chown != "" {
 		return fmt.Errorf("chowning is not allowed in output directory")
 	}
+	if chownStoreDir && chown == "" {
+		return fmt.Errorf("--chown-store requires --chown")
+	}
 
 	pbar, err := progress.New(progressType)
 	if err != nil {
 		return fmt.Errorf("cannto create progress bar: %w", err)
 	}
+	if eventSocket != "" {
+		pbar, err = progress.NewEventSocketProgressBar(eventSocket, pbar)
+		if err != nil {
+			return err
+		}
+	}
+	if progressFd > 0 {
+		pbar, err = progress.NewEventFdProgressBar(progressFd, pbar)
+		if err != nil {
+			return err
+		}
+	}
+	var timingsPbar *progress.StageTimingsProgressBar
+	if stageTimingsPath != "" {
+		timingsPbar = progress.NewStageTimingsProgressBar(pbar)
+		pbar = timingsPbar
+	}
 	defer pbar.Stop()
+	defer func() {
+		// the successful result is reported below
+		if rr, ok := pbar.(progress.ResultReporter); ok && err != nil {
+			rr.SetResult(nil, err)
+		}
+	}()
 
 	manifest_fname := fmt.Sprintf("manifest-%s.json", strings.Join(imgTypes, "-"))
+	manifestPath, err := manifestSavePath(outputDir, manifest_fname, manifestPathArg, noSaveManifest)
+	if err != nil {
+		return err
+	}
 	pbar.SetMessagef("Generating manifest %s", manifest_fname)
-	mf, mTLS, err := manifestFromCobra(cmd, args, pbar)
+	mf, mTLS, caBundle, hash, err := manifestFromCobra(cmd, args, pbar)
 	if err != nil {
 		return fmt.Errorf("cannot build manifest: %w", err)
 	}
@@ -448,9 +1032,48 @@ func cmdBuild(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	exports := imageTypes.Exports()
-	manifestPath := filepath.Join(outputDir, manifest_fname)
-	if err := saveManifest(mf, manifestPath); err != nil {
-		return fmt.Errorf("cannot save manifest: %w", err)
+	buildExports, err := filterExports(exports, onlyExports)
+	if err != nil {
+		return err
+	}
+	hash = buildInputHash(hash, buildExports)
+	if skipIfUnchanged {
+		if res, ok := unchangedBuildResult(outputDir, hash); ok {
+			pbar.SetMessagef("Inputs unchanged, skipping the build (results in %s)", outputDir)
+			if rr, ok := pbar.(progress.ResultReporter); ok {
+				rr.SetResult(res, nil)
+			}
+			return nil
+		}
+	}
+	if err := checkQemuImg(buildExports); err != nil {
+		return err
+	}
+	if upload && !slices.Contains(buildExports, "image") {
+		return fmt.Errorf("cannot upload AMI without the \"image\" export")
+	}
+	if verifyBoot && !slices.Contains(buildExports, "image") {
+		return fmt.Errorf("--verify-boot requires the raw or ami image type")
+	}
+	buildsVagrantBox := slices.Contains(imgTypes, "vagrant-libvirt")
+	if buildsVagrantBox && !slices.Contains(buildExports, "qcow2") {
+		return fmt.Errorf("cannot create vagrant box without the \"qcow2\" export")
+	}
+	if err := validateCheckpoints(mf, checkpoints); err != nil {
+		return err
+	}
+	// checkpointed pipelines are exported too, this makes it easy to
+	// inspect intermediate trees (but they are not build artifacts)
+	osbuildExports := slices.Clone(buildExports)
+	for _, checkpoint := range checkpoints {
+		if !slices.Contains(osbuildExports, checkpoint) {
+			osbuildExports = append(osbuildExports, checkpoint)
+		}
+	}
+	if manifestPath != "" {
+		if err := saveManifest(pbar, mf, manifestPath); err != nil {
+			return fmt.Errorf("cannot save manifest: %w", err)
+		}
 	}
 
 	pbar.SetPulseMsgf("Image building step")
@@ -472,18 +1095,104 @@ func cmdBuild(cmd *cobra.Command, args []string) error {
 
 		osbuildEnv = append(osbuildEnv, envVars...)
 	}
+	if len(caBundle) > 0 {
+		// this overrides the CA of the mTLS config, it is part of
+		// the bundle
+		envVars, cleanup, err := prepareOsbuildCACerts(caBundle, mTLS)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		osbuildEnv = append(osbuildEnv, envVars...)
+	}
 
-	if err = progress.RunOSBuild(pbar, mf, osbuildStore, outputDir, exports, osbuildEnv); err != nil {
-		return fmt.Errorf("cannot run osbuild: %w", err)
+	// on network filesystems osbuild writes the artifacts to a local
+	// scratch directory, they are moved to the output dir at the end
+	osbuildOutputDir := outputDir
+	if scratchOutput {
+		osbuildOutputDir, err = os.MkdirTemp(osbuildStore, "output-")
+		if err != nil {
+			return fmt.Errorf("cannot create scratch output directory: %w", err)
+		}
+		defer os.RemoveAll(osbuildOutputDir)
+	}
+
+	// the osbuild output is only kept for the debug bundle
+	var buildLog bytes.Buffer
+	var osbuildLog io.Writer
+	if debugBundlePath != "" {
+		osbuildLog = &buildLog
+	}
+	err = progress.RunOSBuild(pbar, mf, osbuildStore, osbuildOutputDir, osbuildExports, checkpoints, osbuildEnv, osbuildLog)
+	// the timings are also useful for a failed build
+	if timingsPbar != nil {
+		if werr := writeStageTimings(stageTimingsPath, timingsPbar.Timings()); werr != nil {
+			logrus.Warnf("%v", werr)
+		} else if werr := chownR(stageTimingsPath, chown); werr != nil {
+			logrus.Warnf("cannot setup owner for %q: %v", stageTimingsPath, werr)
+		}
+	}
+	if err != nil {
+		err = osbuildError(err, mf, manifestPath)
+		maybeWriteDebugBundle(debugBundlePath, mf, buildLog.Bytes(), err, chown)
+		return err
+	}
+
+	// the post-processing runs before the artifacts are moved out of
+	// the scratch directory, it reads the whole image
+	if buildsVagrantBox {
+		pbar.SetMessagef("Creating vagrant box")
+		if err := makeVagrantLibvirtBox(filepath.Join(osbuildOutputDir, "qcow2", "disk.qcow2"), filepath.Join(osbuildOutputDir, vagrantLibvirtDir, "disk.box")); err != nil {
+			return err
+		}
+	}
+	if verifyBoot {
+		pbar.SetMessagef("Verifying boot loader entries")
+		if err := verifyDiskImageBoots(filepath.Join(osbuildOutputDir, "image", "disk.raw")); err != nil {
+			return err
+		}
+	}
+	if scratchOutput {
+		pbar.SetMessagef("Moving artifacts to %s", outputDir)
+		if err := moveArtifacts(osbuildOutputDir, outputDir); err != nil {
+			return err
+		}
 	}
 
 	pbar.SetMessagef("Build complete!")
+	artifacts, err := findArtifacts(outputDir, buildExports)
+	if err != nil {
+		return fmt.Errorf("cannot find build artifacts: %w", err)
+	}
+	if buildsVagrantBox {
+		artifacts = append(artifacts, filepath.Join(outputDir, vagrantLibvirtDir, "disk.box"))
+	}
+	res, err := writeBuildResult(outputDir, args[0], imgTypes, artifacts, annotations, hash, ostreeCommit)
+	if err != nil {
+		return err
+	}
+	if provenancePath != "" {
+		pbar.SetMessagef("Writing provenance")
+		cntDigest, err := getContainerDigest(args[0])
+		if err != nil {
+			return fmt.Errorf("cannot get container digest: %w", err)
+		}
+		if err := writeProvenance(provenancePath, res, outputDir, cntDigest, mf, provenanceParameters(cmd, args[0]), startedOn); err != nil {
+			return err
+		}
+	}
+	if postBuild != "" {
+		if err := runPostBuild(pbar, postBuild, outputDir, artifacts); err != nil {
+			return err
+		}
+	}
 	if upload {
 		// XXX: pass our own progress.ProgressBar here
 		// *for now* just stop our own progress and let the uploadAMI
 		// progress take over - but we really need to fix this in a
-		// followup
-		pbar.Stop()
+		// followup. The events keep going so that the result (or
+		// the upload error) is still reported.
+		progress.StopDisplay(pbar)
 		for idx, imgType := range imgTypes {
 			switch imgType {
 			case "ami":
@@ -502,30 +1211,56 @@ func cmdBuild(cmd *cobra.Command, args []string) error {
 	if err := chownR(outputDir, chown); err != nil {
 		return fmt.Errorf("cannot setup owner for %q: %w", outputDir, err)
 	}
+	if packageListPath != "" {
+		if err := chownR(packageListPath, chown); err != nil {
+			return fmt.Errorf("cannot setup owner for %q: %w", packageListPath, err)
+		}
+	}
+	// only after osbuild is done with the store
+	if chownStoreDir {
+		if err := chownStore(osbuildStore, chown); err != nil {
+			return fmt.Errorf("cannot setup owner for store %q: %w", osbuildStore, err)
+		}
+	}
+	if rr, ok := pbar.(progress.ResultReporter); ok {
+		rr.SetResult(res, nil)
+	}
+	// stop the progress so that the summary is not overwritten
+	pbar.Stop()
+	warnings.PrintSummary(osStderr)
 
 	return nil
 }
 
-func chownR(path string, chown string) error {
-	if chown == "" {
-		return nil
-	}
+// parseChown parses the UID[:GID] --chown argument, the gid of the
+// current process is used if no GID is given
+func parseChown(chown string) (uid, gid int, err error) {
 	errFmt := "cannot parse chown: %v"
 
-	var gid int
 	uidS, gidS, _ := strings.Cut(chown, ":")
-	uid, err := strconv.Atoi(uidS)
+	uid, err = strconv.Atoi(uidS)
 	if err != nil {
-		return fmt.Errorf(errFmt, err)
+		return 0, 0, fmt.Errorf(errFmt, err)
 	}
 	if gidS != "" {
 		gid, err = strconv.Atoi(gidS)
 		if err != nil {
-			return fmt.Errorf(errFmt, err)
+			return 0, 0, fmt.Errorf(errFmt, err)
 		}
 	} else {
 		gid = osGetgid()
 	}
+	return uid, gid, nil
+}
+
+func chownR(path string, chown string) error {
+	if chown == "" {
+		return nil
+	}
+	uid, gid, err := parseChown(chown)
+	if err != nil {
+		return err
+	}
 
 	return filepath.Walk(path, func(name string, info os.FileInfo, err error) error {
 		if err == nil {
@@ -535,6 +1270,26 @@ func chownR(path string, chown string) error {
 	})
 }
 
+// chownStore sets the owner of the osbuild store. The store contains
+// complete os trees with (absolute) symlinks so the symlinks themselves
+// are chowned and never followed.
+func chownStore(store string, chown string) error {
+	if chown == "" {
+		return nil
+	}
+	uid, gid, err := parseChown(chown)
+	if err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(store, func(name string, d fs.DirEntry, err error) error {
+		if err == nil {
+			err = os.Lchown(name, uid, gid)
+		}
+		return err
+	})
+}
+
 var rootLogLevel string
 
 func rootPreRunE(cmd *cobra.Command, _ []string) error {
@@ -557,6 +1312,10 @@ func rootPreRunE(cmd *cobra.Command, _ []string) error {
 			return err
 		}
 	}
+	tmpdir, _ := cmd.Flags().GetString("tmpdir")
+	if err := setupTmpdir(tmpdir); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -605,9 +1364,12 @@ func buildCobraCmdline() (*cobra.Command, error) {
 		Version:           version,
 	}
 	rootCmd.SetVersionTemplate(version)
+	rootCmd.SetGlobalNormalizationFunc(normalizeArchAlias)
 
 	rootCmd.PersistentFlags().StringVar(&rootLogLevel, "log-level", "", "logging level (debug, info, error); default error")
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, `Switch to verbose mode`)
+	rootCmd.PersistentFlags().String("tmpdir", "", "directory for temporary files (sets TMPDIR), e.g. if /var/tmp is too small")
+	rootCmd.PersistentFlags().Bool("no-implicit-build", false, "do not assume the build command if no command is given")
 
 	buildCmd := &cobra.Command{
 		Use:   "build IMAGE_NAME",
@@ -650,47 +1412,129 @@ func buildCobraCmdline() (*cobra.Command, error) {
 
 	rootCmd.AddCommand(versionCmd)
 
+	capabilitiesCmd := &cobra.Command{
+		Use:          "capabilities",
+		Short:        "Show what the host can build (e.g. target architectures) as json",
+		Args:         cobra.NoArgs,
+		RunE:         cmdCapabilities,
+		SilenceUsage: true,
+	}
+	rootCmd.AddCommand(capabilitiesCmd)
+
 	rootCmd.AddCommand(manifestCmd)
 	manifestCmd.Flags().Bool("tls-verify", false, "DEPRECATED: require HTTPS and verify certificates when contacting registries")
 	if err := manifestCmd.Flags().MarkHidden("tls-verify"); err != nil {
 		return nil, fmt.Errorf("cannot hide 'tls-verify' :%w", err)
 	}
 	manifestCmd.Flags().String("rpmmd", "/rpmmd", "rpm metadata cache directory")
-	manifestCmd.Flags().String("target-arch", "", "build for the given target architecture (experimental)")
+	manifestCmd.Flags().Duration("depsolve-timeout", 0, "abort a depsolve that takes longer than this, e.g. 10m (0 means no limit)")
+	manifestCmd.Flags().Bool("refresh-cache", false, "remove the cached rpm metadata of the container distro in --rpmmd before depsolving")
+	manifestCmd.Flags().String("target-arch", "", "build for the given target architecture (experimental), --arch is an alias")
+	manifestCmd.Flags().String("platform", "", "select the container image for the given platform, e.g. linux/arm64/v8 (overrides --target-arch)")
 	manifestCmd.Flags().StringArray("type", []string{"qcow2"}, fmt.Sprintf("image types to build [%s]", imagetypes.Available()))
 	manifestCmd.Flags().Bool("local", true, "DEPRECATED: --local is now the default behavior, make sure to pull the container image before running bootc-image-builder")
 	if err := manifestCmd.Flags().MarkHidden("local"); err != nil {
 		return nil, fmt.Errorf("cannot hide 'local' :%w", err)
 	}
 	manifestCmd.Flags().String("rootfs", "", "Root filesystem type. If not given, the default configured in the source container image is used.")
-	manifestCmd.Flags().Bool("use-librepo", false, "(experimenal) switch to librepo for pkg download, needs new enough osbuild")
+	manifestCmd.Flags().StringArray("fs-label", nil, "set the label of the filesystem mounted at MOUNTPOINT (MOUNTPOINT=LABEL, can be given multiple times)")
+	manifestCmd.Flags().StringArray("fs-uuid", nil, "set the uuid of the filesystem mounted at MOUNTPOINT (MOUNTPOINT=UUID, can be given multiple times)")
+	manifestCmd.Flags().String("max-image-size", "", "fail if the disk image is larger than the given size, e.g. 8GiB")
+	manifestCmd.Flags().String("partition-alignment", "", "align the start of all partitions to the given size, e.g. 4MiB (default 1MiB)")
+	manifestCmd.Flags().String("partition-table", "", "partition table type of disk images: gpt or dos (default gpt)")
+	manifestCmd.Flags().StringArray("partition-order", nil, "place the data partition mounted at MOUNTPOINT on the disk in the order the option is given (can be given multiple times)")
+	manifestCmd.Flags().Bool("allow-var-partition", false, "allow a separate /var filesystem customization (not supported with btrfs)")
+	manifestCmd.Flags().Bool("rw-root", false, "mount the root filesystem read-write (only safe for images that do not use composefs)")
+	manifestCmd.Flags().Bool("experimental-skip-selinux", false, "DEVELOPMENT ONLY: skip the SELinux relabel of the customized disk image for faster builds")
+	manifestCmd.Flags().String("os-release-id", "", "os-release ID used to detect the distro instead of the one from the container (e.g. for derived distros)")
+	manifestCmd.Flags().String("os-release-version", "", "os-release VERSION_ID used to detect the distro instead of the one from the container")
+	manifestCmd.Flags().String("uefi-vendor", "", "UEFI vendor directory to use instead of the detected one (e.g. when the image has multiple vendor directories)")
+	manifestCmd.Flags().StringArray("defs-path", nil, "additional directory with distro definitions, searched before the default ones (can be given multiple times)")
+	manifestCmd.Flags().String("firmware", "", "firmware of disk images: bios, uefi or hybrid (default depends on the architecture)")
+	manifestCmd.Flags().Int64("seed", 0, "seed for the generated partition and filesystem UUIDs to get a reproducible manifest (default: random)")
+	manifestCmd.Flags().String("serial-console", "", "serial console of disk images that replaces the default ttyS0, e.g. ttyS1,115200n8")
+	manifestCmd.Flags().String("ostree-commit", "", "fail unless the container has the given ostree commit embedded")
+	manifestCmd.Flags().String("package-list", "", "write the sorted NEVRAs of the depsolved packages (ISO only) to this path")
+	manifestCmd.Flags().Int("resolve-concurrency", 0, fmt.Sprintf("maximum number of containers that are resolved at the same time, 0 means no limit (at most %d)", maxResolveConcurrency))
+	manifestCmd.Flags().StringArray("ca-cert", nil, "trust the given PEM encoded CA certificate for container registries and rpm repositories (can be given multiple times)")
+	manifestCmd.Flags().StringArray("kernel-cmdline", nil, "append kernel arguments, \"type=TYPE[,TYPE]:ARGS\" only for the given image types (can be given multiple times)")
+	manifestCmd.Flags().StringArray("build-package", nil, "install the given package into the build root of ISO builds (can be given multiple times)")
+	manifestCmd.Flags().StringArray("installer-package", nil, "install the given package into the ISO installer environment (can be given multiple times)")
+	manifestCmd.Flags().StringArray("dracut-add-module", nil, "add the dracut module to the initramfs of the ISO installer (can be given multiple times)")
+	manifestCmd.Flags().String("iso-stage2-fs", "", "filesystem of the installer (stage2) image of the ISO: squashfs, ext4 or erofs (default squashfs)")
+	manifestCmd.Flags().String("user", "", "create a user with the given name in the image (a user of the same name in the config takes precedence)")
+	manifestCmd.Flags().String("password-hash", "", "crypt(3) password hash for --user")
+	manifestCmd.Flags().String("ssh-key", "", "ssh public key for --user")
+	manifestCmd.Flags().Bool("no-weak-deps", false, "do not install weak dependencies (recommends) of packages")
+	manifestCmd.Flags().StringArray("depsolve-option", nil, "set the dnf depsolve option KEY=VALUE, e.g. install_weak_deps=false (can be given multiple times)")
+	manifestCmd.Flags().StringArray("repo-mirror", nil, "rewrite rpm repository urls starting with FROM to start with TO instead (FROM=TO, can be given multiple times)")
+	manifestCmd.Flags().String("proxy", "", "http(s) proxy url used for the container and rpm content")
+	manifestCmd.Flags().String("no-proxy", "", "comma separated list of hosts that are accessed without --proxy")
+	manifestCmd.Flags().String("rpm-downloader", "curl", "osbuild source to download the rpms with: curl or librepo (librepo needs a new enough osbuild)")
+	manifestCmd.Flags().Bool("use-librepo", false, "DEPRECATED: use --rpm-downloader=librepo")
+	if err := manifestCmd.Flags().MarkHidden("use-librepo"); err != nil {
+		return nil, fmt.Errorf("cannot hide 'use-librepo' :%w", err)
+	}
+	manifestCmd.Flags().String("target-imgref", "", "container image reference the installed system will use for updates (default: IMAGE_NAME)")
+	manifestCmd.Flags().String("build-container", "", "container image whose repositories are used for the ISO build root (default: IMAGE_NAME)")
+	manifestCmd.Flags().String("print-config", "", "print the effective configuration (json or toml) and exit")
+	manifestCmd.Flags().Lookup("print-config").NoOptDefVal = "json"
 	// --config is only useful for developers who run bib outside
 	// of a container to generate a manifest. so hide it by
 	// default from users.
-	manifestCmd.Flags().String("config", "", "build config file; /config.json will be used if present")
+	manifestCmd.Flags().String("config", "", "build config file or http(s) URL; /config.json will be used if present")
 	if err := manifestCmd.Flags().MarkHidden("config"); err != nil {
 		return nil, fmt.Errorf("cannot hide 'config' :%w", err)
 	}
+	manifestCmd.Flags().String("config-sha256", "", "expected sha256 checksum of a --config URL")
+	if err := manifestCmd.Flags().MarkHidden("config-sha256"); err != nil {
+		return nil, fmt.Errorf("cannot hide 'config-sha256' :%w", err)
+	}
 
 	buildCmd.Flags().AddFlagSet(manifestCmd.Flags())
 	buildCmd.Flags().String("aws-ami-name", "", "name for the AMI in AWS (only for type=ami)")
 	buildCmd.Flags().String("aws-bucket", "", "target S3 bucket name for intermediate storage when creating AMI (only for type=ami)")
 	buildCmd.Flags().String("aws-region", "", "target region for AWS uploads (only for type=ami)")
+	buildCmd.Flags().String("aws-arch", "", "architecture to register the AMI with instead of the architecture of the image (only for type=ami)")
+	buildCmd.Flags().Bool("aws-resume", false, "upload in parts and record the progress next to the image, an interrupted upload can be resumed with \"upload aws --resume\" (only for type=ami)")
+	buildCmd.Flags().Bool("aws-confirm", false, "ask before registering an AMI if the account has an AMI with the same name already (only for type=ami)")
+	buildCmd.Flags().Bool("yes", false, "assume yes for all confirmations (e.g. --aws-confirm)")
 	buildCmd.Flags().String("chown", "", "chown the ouput directory to match the specified UID:GID")
+	buildCmd.Flags().Bool("chown-store", false, "also chown the osbuild store to the --chown UID:GID after the build")
 	buildCmd.Flags().String("output", ".", "artifact output directory")
+	buildCmd.Flags().Bool("no-create-output", false, "require the output directory to exist instead of creating it")
+	buildCmd.Flags().String("output-mode", "0755", "permissions of the output directory if it is created")
 	buildCmd.Flags().String("store", "/store", "osbuild store for intermediate pipeline trees")
+	buildCmd.Flags().String("scratch-output", "auto", "build the artifacts in a scratch directory in the store and move them to the output directory at the end: auto (only for network filesystems), always or never")
+	buildCmd.Flags().Bool("skip-environment-setup", false, "do not set up the container environment for osbuild (mounts, SELinux labels), the caller has done it already")
 	//TODO: add json progress for higher level tools like "podman bootc"
 	buildCmd.Flags().String("progress", "auto", "type of progress bar to use (e.g. verbose,term)")
+	buildCmd.Flags().String("provenance", "", "write an in-toto SLSA provenance statement of the build to this path")
+	buildCmd.Flags().StringArray("annotation", nil, "add the KEY=VALUE annotation to the build result summary (can be given multiple times)")
+	buildCmd.Flags().String("manifest-path", "", "save the manifest to this path instead of the output directory")
+	buildCmd.Flags().Bool("no-save-manifest", false, "do not save the manifest")
+	buildCmd.Flags().Bool("skip-if-unchanged", false, "skip the build if the output directory has the result of a build with the same inputs")
+	buildCmd.Flags().Bool("verify-boot", false, "check that the built raw disk has a boot loader entry with an existing kernel and initramfs")
+	buildCmd.Flags().StringArray("checkpoint", nil, "checkpoint the given osbuild pipeline in the store and export it, e.g. image (can be given multiple times)")
+	buildCmd.Flags().StringArray("only-export", nil, "only build the given osbuild export, e.g. qcow2 (can be given multiple times)")
+	buildCmd.Flags().String("event-socket", "", "connect to the given unix socket and send progress events as JSON lines to it")
+	buildCmd.Flags().Int("progress-fd", 0, "send progress events as JSON lines to the given inherited file descriptor")
+	buildCmd.Flags().String("post-build", "", "script to run after a successful build, gets the output dir and the artifacts as arguments")
+	buildCmd.Flags().String("stage-timings", "", "write the start, end and duration of each osbuild stage to this path (CSV for a .csv extension, JSON otherwise)")
+	buildCmd.Flags().String("debug-bundle", "", "write a tgz with the manifest, build log and versions to this path if the build fails")
 	// flag rules
-	for _, dname := range []string{"output", "store", "rpmmd"} {
+	for _, dname := range []string{"output", "store", "rpmmd", "defs-path"} {
 		if err := buildCmd.MarkFlagDirname(dname); err != nil {
 			return nil, err
 		}
 	}
-	if err := buildCmd.MarkFlagFilename("config"); err != nil {
-		return nil, err
+	for _, fname := range []string{"config", "post-build"} {
+		if err := buildCmd.MarkFlagFilename(fname); err != nil {
+			return nil, err
+		}
 	}
 	buildCmd.MarkFlagsRequiredTogether("aws-region", "aws-bucket", "aws-ami-name")
+	buildCmd.MarkFlagsMutuallyExclusive("manifest-path", "no-save-manifest")
 
 	// If no subcommand is given, assume the user wants to use the build subcommand
 	// See https://github.com/spf13/cobra/issues/823#issuecomment-870027246
@@ -703,19 +1547,87 @@ func buildCobraCmdline() (*cobra.Command, error) {
 		args := append([]string{buildCmd.Name()}, os.Args[1:]...)
 		rootCmd.SetArgs(args)
 	}
-	// command not known, i.e. happens for "bib quay.io/centos/..."
-	if err != nil && !slices.Contains([]string{"help", "completion"}, os.Args[1]) {
+	// with --no-implicit-build cobra reports the unknown command
+	strict := hasNoImplicitBuild(os.Args[1:])
+	// command not known, i.e. happens for "bib quay.io/centos/..." but
+	// not for an obvious typo like "bib buld quay.io/centos/..."
+	if err != nil && !strict && !slices.Contains([]string{"help", "completion"}, os.Args[1]) && !isSubcommandTypo(rootCmd, os.Args[1]) {
 		injectBuildArg()
 	}
 	// command appears valid, e.g. "bib --local quay.io/centos" but this
 	// is the parser just assuming "quay.io" is an argument for "--local" :(
-	if err == nil && cmd.Use == rootCmd.Use && cmd.Flags().Parse(os.Args[1:]) != pflag.ErrHelp {
+	if err == nil && !strict && cmd.Use == rootCmd.Use && cmd.Flags().Parse(os.Args[1:]) != pflag.ErrHelp {
 		injectBuildArg()
 	}
 
 	return rootCmd, nil
 }
 
+// hasNoImplicitBuild checks if --no-implicit-build is given, this
+// needs to be known before cobra parses the commandline
+func hasNoImplicitBuild(args []string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg == "--no-implicit-build" || arg == "--no-implicit-build=true" {
+			return true
+		}
+	}
+	return false
+}
+
+// isSubcommandTypo returns true if the argument is not an image
+// reference but close to the name of a subcommand, e.g. "buld". Only
+// an edit distance of 1 or 2 counts as a typo, short image names like
+// "man" or "ver" are not (cobra would suggest "manifest" and "version"
+// for them).
+func isSubcommandTypo(rootCmd *cobra.Command, arg string) bool {
+	// image references have a registry, tag or digest
+	if strings.HasPrefix(arg, "-") || strings.ContainsAny(arg, "/:.@") {
+		return false
+	}
+	closeToSubcommand := false
+	for _, cmd := range rootCmd.Commands() {
+		// skips e.g. the "help" command
+		if !cmd.IsAvailableCommand() {
+			continue
+		}
+		for _, name := range append([]string{cmd.Name()}, cmd.Aliases...) {
+			if d := editDistance(arg, name); d >= 1 && d <= 2 {
+				closeToSubcommand = true
+			}
+		}
+	}
+	// a local image with that name is never a typo
+	return closeToSubcommand && !localImageExists(arg)
+}
+
+var localImageExists = func(imgref string) bool {
+	return exec.Command("podman", "image", "exists", imgref).Run() == nil
+}
+
+// editDistance returns the Levenshtein distance of a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
 func run() error {
 	rootCmd, err := buildCobraCmdline()
 	if err != nil {
@@ -1,15 +1,21 @@
 package main_test
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"testing"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/exp/slices"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -17,9 +23,12 @@ import (
 	"github.com/osbuild/images/pkg/arch"
 	"github.com/osbuild/images/pkg/blueprint"
 	"github.com/osbuild/images/pkg/container"
+	"github.com/osbuild/images/pkg/disk"
 	"github.com/osbuild/images/pkg/dnfjson"
 	"github.com/osbuild/images/pkg/manifest"
+	"github.com/osbuild/images/pkg/osbuild"
 	"github.com/osbuild/images/pkg/rpmmd"
+	"github.com/osbuild/images/pkg/sbom"
 
 	main "github.com/osbuild/bootc-image-builder/bib/cmd/bootc-image-builder"
 	"github.com/osbuild/bootc-image-builder/bib/internal/buildconfig"
@@ -61,6 +70,138 @@ func TestCanChownInPathCannotChange(t *testing.T) {
 	assert.Equal(t, canChown, false)
 }
 
+func TestChownStore(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("chowning to another user needs root")
+	}
+
+	store := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "host-file")
+	require.NoError(t, os.WriteFile(outside, nil, 0644))
+	tree := filepath.Join(store, "objects", "abc", "data", "tree")
+	require.NoError(t, os.MkdirAll(filepath.Join(tree, "etc"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tree, "etc", "hostname"), []byte("bib"), 0644))
+	// absolute symlinks in the trees must not be followed
+	require.NoError(t, os.Symlink(outside, filepath.Join(tree, "etc", "link")))
+
+	err := main.ChownStore(store, "1000:1001")
+	require.NoError(t, err)
+
+	for _, p := range []string{store, tree, filepath.Join(tree, "etc"), filepath.Join(tree, "etc", "hostname"), filepath.Join(tree, "etc", "link")} {
+		st, err := os.Lstat(p)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(1000), st.Sys().(*syscall.Stat_t).Uid, p)
+		assert.Equal(t, uint32(1001), st.Sys().(*syscall.Stat_t).Gid, p)
+	}
+	st, err := os.Stat(outside)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0), st.Sys().(*syscall.Stat_t).Uid)
+}
+
+func TestChownStoreBadChown(t *testing.T) {
+	err := main.ChownStore(t.TempDir(), "alice")
+	assert.EqualError(t, err, `cannot parse chown: strconv.Atoi: parsing "alice": invalid syntax`)
+	// nothing to do without --chown
+	assert.NoError(t, main.ChownStore("/does/not/exist", ""))
+}
+
+// fakeProgressBar records the messages it gets
+type fakeProgressBar struct {
+	msgs []string
+}
+
+func (f *fakeProgressBar) SetProgress(level int, msg string, done int, total int) error {
+	return nil
+}
+func (f *fakeProgressBar) SetPulseMsgf(msg string, args ...interface{}) {}
+func (f *fakeProgressBar) SetMessagef(msg string, args ...interface{}) {
+	f.msgs = append(f.msgs, fmt.Sprintf(msg, args...))
+}
+func (f *fakeProgressBar) Start() {}
+func (f *fakeProgressBar) Stop()  {}
+
+func TestSaveManifestRoundTrips(t *testing.T) {
+	mf := manifest.OSBuildManifest(`{"version":"2","pipelines":[{"name":"build","stages":[{"type":"org.osbuild.rpm"}]}]}`)
+	fpath := filepath.Join(t.TempDir(), "manifest.json")
+
+	pbar := &fakeProgressBar{}
+	err := main.SaveManifest(pbar, mf, fpath)
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(fpath)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(content), "}\n"))
+	assert.Contains(t, string(content), "\n  \"pipelines\": [\n")
+
+	var got, expected interface{}
+	require.NoError(t, json.Unmarshal(content, &got))
+	require.NoError(t, json.Unmarshal(mf, &expected))
+	assert.Equal(t, expected, got)
+
+	assert.Equal(t, []string{"Saving manifest manifest.json", "Saved manifest manifest.json"}, pbar.msgs)
+}
+
+func TestSaveManifestBadPath(t *testing.T) {
+	err := main.SaveManifest(&fakeProgressBar{}, manifest.OSBuildManifest(`{}`), "/does/not/exist/manifest.json")
+	assert.ErrorContains(t, err, `failed to create output file "/does/not/exist/manifest.json"`)
+}
+
+func TestManifestSavePath(t *testing.T) {
+	outputDir := t.TempDir()
+	customPath := filepath.Join(t.TempDir(), "custom.json")
+
+	for _, tc := range []struct {
+		manifestPath string
+		noSave       bool
+		expected     string
+		expectedErr  string
+	}{
+		{"", false, filepath.Join(outputDir, "manifest-qcow2.json"), ""},
+		{customPath, false, customPath, ""},
+		{"", true, "", ""},
+		{"/does/not/exist/manifest.json", false, "", `cannot write manifest to "/does/not/exist": `},
+	} {
+		fpath, err := main.ManifestSavePath(outputDir, "manifest-qcow2.json", tc.manifestPath, tc.noSave)
+		if tc.expectedErr != "" {
+			assert.ErrorContains(t, err, tc.expectedErr)
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, fpath)
+		}
+	}
+	// the writable check does not leave anything behind
+	entries, err := os.ReadDir(filepath.Dir(customPath))
+	require.NoError(t, err)
+	assert.Len(t, entries, 0)
+}
+
+func TestManifestSavedAtCustomPath(t *testing.T) {
+	outputDir := t.TempDir()
+	customPath := filepath.Join(t.TempDir(), "custom.json")
+
+	fpath, err := main.ManifestSavePath(outputDir, "manifest-qcow2.json", customPath, false)
+	require.NoError(t, err)
+	err = main.SaveManifest(&fakeProgressBar{}, manifest.OSBuildManifest(`{"version":"2"}`), fpath)
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(customPath)
+	require.NoError(t, err)
+	assert.Equal(t, "{\n  \"version\": \"2\"\n}\n", string(content))
+	assert.NoFileExists(t, filepath.Join(outputDir, "manifest-qcow2.json"))
+}
+
+func TestOsbuildErrorReferencesManifest(t *testing.T) {
+	osbuildErr := errors.New("exit status 1")
+	mf := manifest.OSBuildManifest(`{"version":"2"}`)
+
+	err := main.OsbuildError(osbuildErr, mf, "/output/manifest-qcow2.json")
+	assert.EqualError(t, err, "cannot run osbuild (manifest: /output/manifest-qcow2.json): exit status 1")
+	assert.ErrorIs(t, err, osbuildErr)
+
+	err = main.OsbuildError(osbuildErr, mf, "")
+	assert.EqualError(t, err, "cannot run osbuild (run without --no-save-manifest to keep the manifest): exit status 1")
+}
+
 type manifestTestCase struct {
 	config            *main.ManifestConfig
 	imageTypes        imagetypes.ImageTypes
@@ -310,6 +451,23 @@ func TestManifestSerialization(t *testing.T) {
 				},
 			},
 		},
+		"vhdx-base": {
+			config:     baseConfig,
+			imageTypes: []string{"vhdx"},
+			containers: diskContainers,
+			expStages: map[string][]string{
+				"build": {"org.osbuild.container-deploy"},
+				"image": {
+					"org.osbuild.bootc.install-to-filesystem",
+				},
+			},
+			notExpectedStages: map[string][]string{
+				"build": {"org.osbuild.rpm"},
+				"image": {
+					"org.osbuild.users",
+				},
+			},
+		},
 		"qcow2-base": {
 			config:     baseConfig,
 			imageTypes: []string{"qcow2"},
@@ -458,6 +616,316 @@ func TestManifestSerialization(t *testing.T) {
 	}
 }
 
+func findStageOptions(t *testing.T, serialized manifest.OSBuildManifest, plName, stageType string) map[string]interface{} {
+	var mf struct {
+		Pipelines []struct {
+			Name   string `json:"name"`
+			Stages []struct {
+				Type    string                 `json:"type"`
+				Options map[string]interface{} `json:"options"`
+			} `json:"stages"`
+		} `json:"pipelines"`
+	}
+	require.NoError(t, json.Unmarshal(serialized, &mf))
+	for _, pl := range mf.Pipelines {
+		if pl.Name != plName {
+			continue
+		}
+		for _, st := range pl.Stages {
+			if st.Type == stageType {
+				return st.Options
+			}
+		}
+	}
+	t.Fatalf("cannot find stage %q in pipeline %q", stageType, plName)
+	return nil
+}
+
+// serializeTestManifest serializes the disk manifest of the given
+// config with a fake build and image container
+func serializeTestManifest(t *testing.T, conf *main.ManifestConfig) manifest.OSBuildManifest {
+	return main.SerializeTestManifest(t, conf, "sha256:1111111111111111111111111111111111111111111111111111111111111111")
+}
+
+func TestManifestSerializationTargetImgref(t *testing.T) {
+	for _, tc := range []struct {
+		targetImgref string
+		expected     string
+	}{
+		{"", "testempty"},
+		{"mirror.example.com/bootc/os:latest", "mirror.example.com/bootc/os:latest"},
+	} {
+		t.Run(tc.expected, func(t *testing.T) {
+			config := main.ManifestConfig(*getBaseConfig())
+			config.ImageTypes = []string{"qcow2"}
+			config.TargetImgref = tc.targetImgref
+			manifestJson := serializeTestManifest(t, &config)
+
+			opts := findStageOptions(t, manifestJson, "image", "org.osbuild.bootc.install-to-filesystem")
+			assert.Equal(t, tc.expected, opts["target-imgref"])
+		})
+	}
+}
+
+func TestManifestSerializationKernelCmdlinePerType(t *testing.T) {
+	kernelCmdlineArgs := []string{"quiet", `type=ami:"console=ttyS0,115200"`}
+
+	for _, tc := range []struct {
+		imgType  string
+		expected []string
+	}{
+		{"ami", []string{"rw", "console=tty0", "console=ttyS0", "quiet", "console=ttyS0,115200"}},
+		{"qcow2", []string{"rw", "console=tty0", "console=ttyS0", "quiet"}},
+	} {
+		t.Run(tc.imgType, func(t *testing.T) {
+			config := main.ManifestConfig(*getBaseConfig())
+			config.ImageTypes = []string{tc.imgType}
+			kargs, err := main.KernelCmdlineForTypes(kernelCmdlineArgs, config.ImageTypes)
+			require.NoError(t, err)
+			config.KernelCmdline = kargs
+			manifestJson := serializeTestManifest(t, &config)
+
+			opts := findStageOptions(t, manifestJson, "image", "org.osbuild.bootc.install-to-filesystem")
+			var got []string
+			for _, karg := range opts["kernel-args"].([]interface{}) {
+				got = append(got, karg.(string))
+			}
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestManifestSerializationSerialConsole(t *testing.T) {
+	for _, tc := range []struct {
+		serialConsole string
+		expected      []string
+	}{
+		{"", []string{"rw", "console=tty0", "console=ttyS0"}},
+		{"ttyS1,115200n8", []string{"rw", "console=tty0", "console=ttyS1,115200n8"}},
+	} {
+		t.Run(tc.serialConsole, func(t *testing.T) {
+			config := main.ManifestConfig(*getBaseConfig())
+			config.ImageTypes = []string{"qcow2"}
+			config.SerialConsole = tc.serialConsole
+			manifestJson := serializeTestManifest(t, &config)
+
+			opts := findStageOptions(t, manifestJson, "image", "org.osbuild.bootc.install-to-filesystem")
+			var got []string
+			for _, karg := range opts["kernel-args"].([]interface{}) {
+				got = append(got, karg.(string))
+			}
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestManifestSerializationSkipSELinux(t *testing.T) {
+	var stderr bytes.Buffer
+	restore := main.MockWarnings(&stderr)
+	defer restore()
+
+	for _, skipSELinux := range []bool{false, true} {
+		t.Run(fmt.Sprintf("skip-selinux=%v", skipSELinux), func(t *testing.T) {
+			config := main.ManifestConfig(*getUserConfig())
+			config.ImageTypes = []string{"qcow2"}
+			config.SkipSELinux = skipSELinux
+			manifestJson := serializeTestManifest(t, &config)
+
+			var serialized struct {
+				Pipelines []struct {
+					Name   string `json:"name"`
+					Stages []struct {
+						Type string `json:"type"`
+					} `json:"stages"`
+				} `json:"pipelines"`
+			}
+			require.NoError(t, json.Unmarshal(manifestJson, &serialized))
+			var stages []string
+			for _, pl := range serialized.Pipelines {
+				if pl.Name != "image" {
+					continue
+				}
+				for _, st := range pl.Stages {
+					stages = append(stages, st.Type)
+				}
+			}
+			// the users are still added
+			assert.Contains(t, stages, "org.osbuild.users")
+			assert.Equal(t, !skipSELinux, slices.Contains(stages, "org.osbuild.selinux"))
+		})
+	}
+	require.Len(t, main.Warnings(), 1)
+	assert.Contains(t, stderr.String(), "WARNING: skipping the SELinux relabel")
+}
+
+func TestManifestSerializationHybridBoot(t *testing.T) {
+	for _, tc := range []struct {
+		firmware   string
+		expectBIOS bool
+		expectUEFI bool
+	}{
+		{"", true, true},
+		{"hybrid", true, true},
+		{"uefi", false, true},
+		{"bios", true, false},
+	} {
+		t.Run(tc.firmware, func(t *testing.T) {
+			config := main.ManifestConfig(*getBaseConfig())
+			config.ImageTypes = []string{"raw"}
+			config.Firmware = tc.firmware
+			manifestJson := serializeTestManifest(t, &config)
+
+			var partTypes []string
+			sfdiskOpts := findStageOptions(t, manifestJson, "image", "org.osbuild.sfdisk")
+			for _, part := range sfdiskOpts["partitions"].([]interface{}) {
+				partTypes = append(partTypes, strings.ToUpper(part.(map[string]interface{})["type"].(string)))
+			}
+			assert.Equal(t, tc.expectBIOS, slices.Contains(partTypes, disk.BIOSBootPartitionGUID))
+			assert.Equal(t, tc.expectUEFI, slices.Contains(partTypes, disk.EFISystemPartitionGUID))
+
+			// bootupd (run by bootc install) installs the boot loaders
+			// for all boot partitions of the disk in a single stage:
+			// grub for BIOS into the disk, the UEFI one into the ESP
+			var installStage struct {
+				Devices map[string]interface{} `json:"devices"`
+				Mounts  []struct {
+					Target string `json:"target"`
+				} `json:"mounts"`
+			}
+			var serialized struct {
+				Pipelines []struct {
+					Name   string            `json:"name"`
+					Stages []json.RawMessage `json:"stages"`
+				} `json:"pipelines"`
+			}
+			require.NoError(t, json.Unmarshal(manifestJson, &serialized))
+			for _, pl := range serialized.Pipelines {
+				if pl.Name != "image" {
+					continue
+				}
+				for _, st := range pl.Stages {
+					if strings.Contains(string(st), `"type":"org.osbuild.bootc.install-to-filesystem"`) {
+						require.NoError(t, json.Unmarshal(st, &installStage))
+					}
+				}
+			}
+			assert.Contains(t, installStage.Devices, "disk")
+			var targets []string
+			for _, mnt := range installStage.Mounts {
+				targets = append(targets, mnt.Target)
+			}
+			assert.Equal(t, tc.expectUEFI, slices.Contains(targets, "/boot/efi"))
+		})
+	}
+}
+
+func TestManifestSerializationDracutAddModules(t *testing.T) {
+	containerSpec := container.Spec{
+		Source:  "test-container",
+		Digest:  "sha256:dddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddd",
+		ImageID: "sha256:1111111111111111111111111111111111111111111111111111111111111111",
+	}
+	isoContainers := map[string][]container.Spec{
+		"bootiso-tree": {containerSpec},
+	}
+	pkg := rpmmd.PackageSpec{
+		Name:     "package",
+		Version:  "113",
+		Checksum: "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+	}
+	isoPackages := map[string]dnfjson.DepsolveResult{
+		"build": {
+			Packages: []rpmmd.PackageSpec{pkg},
+		},
+		"anaconda-tree": {
+			Packages: []rpmmd.PackageSpec{
+				{
+					Name:     "kernel",
+					Version:  "10.11",
+					Checksum: "sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc",
+				},
+				pkg,
+			},
+		},
+	}
+
+	config := main.ManifestConfig(*getBaseConfig())
+	config.ImageTypes = []string{"anaconda-iso"}
+	config.DracutAddModules = []string{"nvdimm", "custom-module"}
+	mf, err := main.Manifest(&config)
+	require.NoError(t, err)
+	manifestJson, err := mf.Serialize(isoPackages, isoContainers, nil, nil)
+	require.NoError(t, err)
+
+	opts := findStageOptions(t, manifestJson, "anaconda-tree", "org.osbuild.dracut")
+	assert.Subset(t, opts["modules"], []interface{}{"nvdimm", "custom-module", "anaconda"})
+}
+
+func TestManifestInstallerPackages(t *testing.T) {
+	config := main.ManifestConfig(*getBaseConfig())
+	config.ImageTypes = []string{"anaconda-iso"}
+	config.InstallerPackages = []string{"anaconda-addon-example", "python3-example"}
+	mf, err := main.Manifest(&config)
+	require.NoError(t, err)
+
+	var pkgs []string
+	for _, pkgSet := range mf.GetPackageSetChains()["anaconda-tree"] {
+		pkgs = append(pkgs, pkgSet.Include...)
+	}
+	assert.Subset(t, pkgs, []string{"anaconda-addon-example", "python3-example"})
+	// the packages from the distro definition are still there
+	assert.Contains(t, pkgs, "aajohan-comfortaa-fonts")
+}
+
+func TestDefsPathPreferredOverBuiltin(t *testing.T) {
+	customDefs := t.TempDir()
+	err := os.WriteFile(filepath.Join(customDefs, "fedora-40.yaml"), []byte(`anaconda-iso:
+  packages:
+    - custom-installer-pkg
+`), 0644)
+	require.NoError(t, err)
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.StringArray("defs-path", nil, "")
+	require.NoError(t, flags.Parse([]string{"--defs-path", customDefs}))
+	defsPaths, err := main.DefsPathsFromFlags(flags)
+	require.NoError(t, err)
+	assert.Equal(t, customDefs, defsPaths[0])
+
+	config := main.ManifestConfig(*getBaseConfig())
+	config.ImageTypes = []string{"anaconda-iso"}
+	// the builtin defs (that also have a fedora-40.yaml) come last
+	config.DistroDefPaths = append(defsPaths, "../../data/defs")
+	mf, err := main.Manifest(&config)
+	require.NoError(t, err)
+
+	var pkgs []string
+	for _, pkgSet := range mf.GetPackageSetChains()["anaconda-tree"] {
+		pkgs = append(pkgs, pkgSet.Include...)
+	}
+	assert.Contains(t, pkgs, "custom-installer-pkg")
+	assert.NotContains(t, pkgs, "aajohan-comfortaa-fonts")
+}
+
+func TestDefsPathErrors(t *testing.T) {
+	notADir := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(notADir, nil, 0644))
+
+	for _, tc := range []struct {
+		path   string
+		expErr string
+	}{
+		{"/no/such/dir", "cannot use defs path: stat /no/such/dir: no such file or directory"},
+		{notADir, fmt.Sprintf("cannot use defs path: %s is not a directory", notADir)},
+	} {
+		flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		flags.StringArray("defs-path", nil, "")
+		require.NoError(t, flags.Parse([]string{"--defs-path", tc.path}))
+		_, err := main.DefsPathsFromFlags(flags)
+		assert.EqualError(t, err, tc.expErr)
+	}
+}
+
 // simplified representation of a manifest
 type testManifest struct {
 	Pipelines []pipeline `json:"pipelines"`
@@ -583,6 +1051,184 @@ func TestCobraCmdline(t *testing.T) {
 	}
 }
 
+func TestCobraCmdlineArchIsValidatedEarly(t *testing.T) {
+	for _, tc := range []struct {
+		cmdline     []string
+		expectedErr string
+	}{
+		{
+			[]string{"manifest", "--target-arch", "mips", "quay.io..."},
+			`invalid --target-arch: unsupported architecture "mips", supported: amd64, x86_64, arm64, aarch64, s390x, ppc64le`,
+		},
+		{
+			[]string{"manifest", "--arch", "mips", "quay.io..."},
+			`invalid --target-arch: unsupported architecture "mips", supported: amd64, x86_64, arm64, aarch64, s390x, ppc64le`,
+		},
+		{
+			[]string{"build", "--arch", "x86", "quay.io..."},
+			`invalid --target-arch: unsupported architecture "x86", supported: amd64, x86_64, arm64, aarch64, s390x, ppc64le`,
+		},
+		// --arch is an alias, not a separate flag
+		{
+			[]string{"manifest", "--arch", "arm64", "--platform", "linux/amd64", "quay.io..."},
+			`--platform "linux/amd64" does not match --target-arch "arm64"`,
+		},
+	} {
+		t.Run(strings.Join(tc.cmdline, " "), func(t *testing.T) {
+			restore := mockOsArgs(tc.cmdline)
+			defer restore()
+
+			rootCmd, err := main.BuildCobraCmdline()
+			require.NoError(t, err)
+			rootCmd.SetOut(io.Discard)
+			err = rootCmd.Execute()
+			assert.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestCobraCmdlineNoImplicitBuild(t *testing.T) {
+	for _, tc := range []struct {
+		cmdline      []string
+		expectedCall string
+		expectedErr  string
+	}{
+		// strict mode still works with an explicit command
+		{
+			[]string{"--no-implicit-build", "build", "quay.io..."},
+			"<build>: quay.io...",
+			"",
+		},
+		{
+			[]string{"build", "--no-implicit-build", "quay.io..."},
+			"<build>: quay.io...",
+			"",
+		},
+		// but does not assume the build command
+		{
+			[]string{"--no-implicit-build", "quay.io..."},
+			"",
+			`unknown command "quay.io..." for "bootc-image-builder"`,
+		},
+		{
+			[]string{"--no-implicit-build=true", "localhost/myimage"},
+			"",
+			`unknown command "localhost/myimage" for "bootc-image-builder"`,
+		},
+	} {
+		var runeCall string
+
+		restore := mockOsArgs(tc.cmdline)
+		defer restore()
+
+		rootCmd, err := main.BuildCobraCmdline()
+		assert.NoError(t, err)
+		addRunLog(rootCmd, &runeCall)
+		rootCmd.SetOut(io.Discard)
+		rootCmd.SetErr(io.Discard)
+
+		t.Run(strings.Join(tc.cmdline, " "), func(t *testing.T) {
+			err = rootCmd.Execute()
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedCall, runeCall)
+		})
+	}
+}
+
+func TestCobraCmdlineSubcommandTypo(t *testing.T) {
+	localImages := []string{"bulid"}
+	restore := main.MockLocalImageExists(func(imgref string) bool {
+		return slices.Contains(localImages, imgref)
+	})
+	defer restore()
+
+	for _, tc := range []struct {
+		cmdline      []string
+		expectedCall string
+		expectedErr  string
+	}{
+		{
+			[]string{"buld", "quay.io..."},
+			"",
+			"unknown command \"buld\" for \"bootc-image-builder\"\n\nDid you mean this?\n\tbuild\n",
+		},
+		{
+			[]string{"manifets", "quay.io..."},
+			"",
+			"unknown command \"manifets\" for \"bootc-image-builder\"\n\nDid you mean this?\n\tmanifest\n",
+		},
+		// things that look like image references are still built
+		{
+			[]string{"quay.io/buld", "--type", "raw"},
+			"<build>: quay.io/buld",
+			"",
+		},
+		{
+			[]string{"buld:latest"},
+			"<build>: buld:latest",
+			"",
+		},
+		{
+			[]string{"myimage"},
+			"<build>: myimage",
+			"",
+		},
+		// short image names that are not within an edit distance
+		// of 2 of a subcommand (or only close to "help")
+		{
+			[]string{"helm"},
+			"<build>: helm",
+			"",
+		},
+		{
+			[]string{"b"},
+			"<build>: b",
+			"",
+		},
+		{
+			[]string{"ver"},
+			"<build>: ver",
+			"",
+		},
+		{
+			[]string{"man"},
+			"<build>: man",
+			"",
+		},
+		// close to "build" but a local image
+		{
+			[]string{"bulid"},
+			"<build>: bulid",
+			"",
+		},
+	} {
+		var runeCall string
+
+		restore := mockOsArgs(tc.cmdline)
+		defer restore()
+
+		rootCmd, err := main.BuildCobraCmdline()
+		assert.NoError(t, err)
+		addRunLog(rootCmd, &runeCall)
+		rootCmd.SetOut(io.Discard)
+		rootCmd.SetErr(io.Discard)
+
+		t.Run(strings.Join(tc.cmdline, " "), func(t *testing.T) {
+			err = rootCmd.Execute()
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedCall, runeCall)
+		})
+	}
+}
+
 func TestCobraCmdlineVerbose(t *testing.T) {
 	for _, tc := range []struct {
 		cmdline             []string
@@ -627,3 +1273,508 @@ func TestCobraCmdlineVerbose(t *testing.T) {
 		})
 	}
 }
+
+type fakeDepsolver struct {
+	pkgSets [][]rpmmd.PackageSet
+	// checksum of the returned package, defaults to "sha256:ccc..."
+	checksum string
+}
+
+func (f *fakeDepsolver) Depsolve(pkgSets []rpmmd.PackageSet, sbomType sbom.StandardType) (*dnfjson.DepsolveResult, error) {
+	f.pkgSets = append(f.pkgSets, pkgSets)
+	checksum := f.checksum
+	if checksum == "" {
+		checksum = "sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc"
+	}
+	return &dnfjson.DepsolveResult{
+		Packages: []rpmmd.PackageSpec{
+			{
+				Name:     "kernel",
+				Version:  "10.11",
+				Release:  "1.fc40",
+				Arch:     "x86_64",
+				Checksum: checksum,
+				RepoID:   "baseos",
+			},
+		},
+		Repos: []rpmmd.RepoConfig{
+			{
+				Id:       "baseos",
+				BaseURLs: []string{"https://example.com/baseos"},
+			},
+		},
+	}, nil
+}
+
+func TestMakeManifestWeakDeps(t *testing.T) {
+	restore := main.MockNewContainerResolver(func(architecture arch.Arch, variant, certDir string, concurrency int) main.ContainerResolver {
+		return &fakeContainerResolver{arch: architecture}
+	})
+	defer restore()
+
+	for _, noWeakDeps := range []bool{false, true} {
+		t.Run(fmt.Sprintf("no-weak-deps=%v", noWeakDeps), func(t *testing.T) {
+			config := main.ManifestConfig(*getUserConfig())
+			config.ImageTypes, _ = imagetypes.New("iso")
+			config.NoWeakDeps = noWeakDeps
+
+			solver := &fakeDepsolver{}
+			_, _, err := main.MakeManifest(&config, solver, "")
+			require.NoError(t, err)
+
+			require.NotEmpty(t, solver.pkgSets)
+			for _, chain := range solver.pkgSets {
+				for _, pkgSet := range chain {
+					assert.Equal(t, !noWeakDeps, pkgSet.InstallWeakDeps)
+				}
+			}
+		})
+	}
+}
+
+func TestMakeManifestDepsolveOptions(t *testing.T) {
+	restore := main.MockNewContainerResolver(func(architecture arch.Arch, variant, certDir string, concurrency int) main.ContainerResolver {
+		return &fakeContainerResolver{arch: architecture}
+	})
+	defer restore()
+
+	for _, installWeakDeps := range []bool{false, true} {
+		t.Run(fmt.Sprintf("install_weak_deps=%v", installWeakDeps), func(t *testing.T) {
+			config := main.ManifestConfig(*getUserConfig())
+			config.ImageTypes, _ = imagetypes.New("iso")
+			// the depsolve options override --no-weak-deps
+			config.NoWeakDeps = true
+			config.DepsolveOptions = &main.DepsolveOptions{InstallWeakDeps: &installWeakDeps}
+
+			solver := &fakeDepsolver{}
+			_, _, err := main.MakeManifest(&config, solver, "")
+			require.NoError(t, err)
+
+			require.NotEmpty(t, solver.pkgSets)
+			for _, chain := range solver.pkgSets {
+				for _, pkgSet := range chain {
+					assert.Equal(t, installWeakDeps, pkgSet.InstallWeakDeps)
+				}
+			}
+		})
+	}
+}
+
+func TestMakeManifestSeedIsReproducible(t *testing.T) {
+	restore := main.MockNewContainerResolver(func(architecture arch.Arch, variant, certDir string, concurrency int) main.ContainerResolver {
+		return &fakeContainerResolver{arch: architecture}
+	})
+	defer restore()
+
+	saveManifestWithSeed := func(t *testing.T, imgType string, seed int64) []byte {
+		config := main.ManifestConfig(*getUserConfig())
+		config.ImageTypes, _ = imagetypes.New(imgType)
+		config.Seed = seed
+		// plaintext passwords are hashed with a random salt
+		passwordHash := testPasswordHash
+		config.Config.Customizations.User[0].Password = &passwordHash
+		mf, _, err := main.MakeManifest(&config, &fakeDepsolver{}, "")
+		require.NoError(t, err)
+
+		fpath := filepath.Join(t.TempDir(), "manifest.json")
+		require.NoError(t, main.SaveManifest(&fakeProgressBar{}, mf, fpath))
+		content, err := os.ReadFile(fpath)
+		require.NoError(t, err)
+		return content
+	}
+
+	for _, imgType := range []string{"qcow2", "iso"} {
+		t.Run(imgType, func(t *testing.T) {
+			first := saveManifestWithSeed(t, imgType, 42)
+			second := saveManifestWithSeed(t, imgType, 42)
+			assert.Equal(t, string(first), string(second))
+		})
+	}
+
+	// the seed is what makes the manifest reproducible, without it
+	// the partition UUIDs differ
+	assert.NotEqual(t, string(saveManifestWithSeed(t, "qcow2", 42)), string(saveManifestWithSeed(t, "qcow2", 43)))
+}
+
+func TestMakeManifestVhdx(t *testing.T) {
+	restore := main.MockNewContainerResolver(func(architecture arch.Arch, variant, certDir string, concurrency int) main.ContainerResolver {
+		return &fakeContainerResolver{arch: architecture}
+	})
+	defer restore()
+
+	config := main.ManifestConfig(*getBaseConfig())
+	config.ImageTypes, _ = imagetypes.New("vhdx")
+	mf, _, err := main.MakeManifest(&config, &fakeDepsolver{}, "")
+	require.NoError(t, err)
+
+	pipelines, err := main.ManifestPipelines(mf)
+	require.NoError(t, err)
+	assert.Contains(t, pipelines, "vhdx")
+	opts := findStageOptions(t, mf, "vhdx", "org.osbuild.qemu")
+	assert.Equal(t, "disk.vhdx", opts["filename"])
+	assert.Equal(t, map[string]interface{}{"type": "vhdx"}, opts["format"])
+
+	// other disk image types do not get the vhdx pipeline
+	config.ImageTypes, _ = imagetypes.New("raw")
+	mf, _, err = main.MakeManifest(&config, &fakeDepsolver{}, "")
+	require.NoError(t, err)
+	pipelines, err = main.ManifestPipelines(mf)
+	require.NoError(t, err)
+	assert.NotContains(t, pipelines, "vhdx")
+}
+
+func TestMakeManifestBuildPackages(t *testing.T) {
+	restore := main.MockNewContainerResolver(func(architecture arch.Arch, variant, certDir string, concurrency int) main.ContainerResolver {
+		return &fakeContainerResolver{arch: architecture}
+	})
+	defer restore()
+
+	config := main.ManifestConfig(*getUserConfig())
+	config.ImageTypes, _ = imagetypes.New("iso")
+	config.BuildPackages = []string{"bib-build-tool", "python3-pyyaml"}
+
+	solver := &fakeDepsolver{}
+	_, _, err := main.MakeManifest(&config, solver, "")
+	require.NoError(t, err)
+
+	// only the build root package set chain gets the packages
+	var found int
+	for _, chain := range solver.pkgSets {
+		var pkgs []string
+		for _, pkgSet := range chain {
+			pkgs = append(pkgs, pkgSet.Include...)
+		}
+		if strings.Contains(strings.Join(pkgs, " "), "bib-build-tool") {
+			found++
+			assert.Contains(t, pkgs, "python3-pyyaml")
+			// part of the build root package set of images
+			assert.Contains(t, pkgs, "selinux-policy-targeted")
+		}
+	}
+	assert.Equal(t, 1, found)
+}
+
+func TestMakeManifestRpmDownloader(t *testing.T) {
+	restore := main.MockNewContainerResolver(func(architecture arch.Arch, variant, certDir string, concurrency int) main.ContainerResolver {
+		return &fakeContainerResolver{arch: architecture}
+	})
+	defer restore()
+
+	for _, tc := range []struct {
+		rpmDownloader  osbuild.RpmDownloader
+		expectedSource string
+	}{
+		{osbuild.RpmDownloaderCurl, "org.osbuild.curl"},
+		{osbuild.RpmDownloaderLibrepo, "org.osbuild.librepo"},
+	} {
+		t.Run(tc.expectedSource, func(t *testing.T) {
+			config := main.ManifestConfig(*getUserConfig())
+			config.ImageTypes, _ = imagetypes.New("iso")
+			config.RpmDownloader = tc.rpmDownloader
+
+			mf, _, err := main.MakeManifest(&config, &fakeDepsolver{}, "")
+			require.NoError(t, err)
+
+			var manifest struct {
+				Sources map[string]json.RawMessage `json:"sources"`
+			}
+			require.NoError(t, json.Unmarshal(mf, &manifest))
+			assert.Contains(t, manifest.Sources, tc.expectedSource)
+		})
+	}
+}
+
+func TestMakeManifestPackageList(t *testing.T) {
+	restore := main.MockNewContainerResolver(func(architecture arch.Arch, variant, certDir string, concurrency int) main.ContainerResolver {
+		return &fakeContainerResolver{arch: architecture}
+	})
+	defer restore()
+
+	config := main.ManifestConfig(*getUserConfig())
+	config.ImageTypes, _ = imagetypes.New("iso")
+
+	solver := &fakeDepsolver{}
+	_, depsolvedSets, err := main.MakeManifest(&config, solver, "")
+	require.NoError(t, err)
+	// every package set chain is depsolved
+	require.Len(t, depsolvedSets, len(solver.pkgSets))
+
+	path := filepath.Join(t.TempDir(), "packages.txt")
+	require.NoError(t, main.WritePackageList(path, depsolvedSets))
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "kernel-10.11-1.fc40.x86_64\n", string(content))
+}
+
+func TestMakeManifestBuildContainer(t *testing.T) {
+	restore := main.MockNewContainerResolver(func(architecture arch.Arch, variant, certDir string, concurrency int) main.ContainerResolver {
+		return &fakeContainerResolver{arch: architecture}
+	})
+	defer restore()
+
+	buildChecksum := "sha256:dddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddd"
+	config := main.ManifestConfig(*getUserConfig())
+	config.ImageTypes, _ = imagetypes.New("iso")
+	config.BuildImgref = "quay.io/centos-bootc/centos-bootc:stream10"
+	config.BuildSourceInfo = &source.Info{
+		OSRelease: source.OSRelease{
+			ID:         "centos",
+			VersionID:  "10",
+			PlatformID: "platform:el10",
+		},
+	}
+	buildSolver := &fakeDepsolver{checksum: buildChecksum}
+	config.BuildDepsolver = buildSolver
+	solver := &fakeDepsolver{}
+
+	mf, _, err := main.MakeManifest(&config, solver, "")
+	require.NoError(t, err)
+
+	// only the build root is depsolved with the build container and
+	// lorax runs there so its distro selects the lorax templates
+	require.Len(t, buildSolver.pkgSets, 1)
+	assert.Contains(t, buildSolver.pkgSets[0][0].Include, "lorax-templates-rhel")
+	for _, chain := range solver.pkgSets {
+		for _, pkgSet := range chain {
+			assert.NotContains(t, pkgSet.Include, "lorax-templates-rhel")
+			assert.NotContains(t, pkgSet.Include, "lorax-templates-generic")
+		}
+	}
+
+	var serialized struct {
+		Pipelines []struct {
+			Name   string `json:"name"`
+			Stages []struct {
+				Type   string          `json:"type"`
+				Inputs json.RawMessage `json:"inputs"`
+			} `json:"stages"`
+		} `json:"pipelines"`
+	}
+	require.NoError(t, json.Unmarshal(mf, &serialized))
+	rpmInputs := make(map[string]string)
+	for _, pl := range serialized.Pipelines {
+		for _, st := range pl.Stages {
+			if st.Type == "org.osbuild.rpm" {
+				rpmInputs[pl.Name] = string(st.Inputs)
+			}
+		}
+	}
+	require.Contains(t, rpmInputs, "build")
+	assert.Contains(t, rpmInputs["build"], buildChecksum)
+	require.Contains(t, rpmInputs, "anaconda-tree")
+	assert.NotContains(t, rpmInputs["anaconda-tree"], buildChecksum)
+}
+
+func TestMakeManifestISOStage2FS(t *testing.T) {
+	restore := main.MockNewContainerResolver(func(architecture arch.Arch, variant, certDir string, concurrency int) main.ContainerResolver {
+		return &fakeContainerResolver{arch: architecture}
+	})
+	defer restore()
+
+	for _, tc := range []struct {
+		stage2FS          string
+		expectedStage     string
+		expectRootfsImage bool
+	}{
+		{"", "org.osbuild.squashfs", false},
+		{"squashfs", "org.osbuild.squashfs", false},
+		{"ext4", "org.osbuild.squashfs", true},
+		{"erofs", "org.osbuild.erofs", false},
+	} {
+		t.Run(tc.stage2FS, func(t *testing.T) {
+			config := main.ManifestConfig(*getUserConfig())
+			config.ImageTypes, _ = imagetypes.New("iso")
+			config.ISOStage2FS = tc.stage2FS
+
+			mf, _, err := main.MakeManifest(&config, &fakeDepsolver{}, "")
+			require.NoError(t, err)
+
+			var serialized struct {
+				Pipelines []struct {
+					Name   string `json:"name"`
+					Stages []struct {
+						Type string `json:"type"`
+					} `json:"stages"`
+				} `json:"pipelines"`
+			}
+			require.NoError(t, json.Unmarshal(mf, &serialized))
+			var pipelines, stages []string
+			for _, pl := range serialized.Pipelines {
+				pipelines = append(pipelines, pl.Name)
+				if pl.Name != "bootiso-tree" {
+					continue
+				}
+				for _, st := range pl.Stages {
+					stages = append(stages, st.Type)
+				}
+			}
+			assert.Contains(t, stages, tc.expectedStage)
+			// the ext4 stage2 image is created in its own pipeline
+			assert.Equal(t, tc.expectRootfsImage, slices.Contains(pipelines, "rootfs-image"))
+		})
+	}
+}
+
+func TestGenerateManifestValidatesOptions(t *testing.T) {
+	baseOpts := func() *main.ManifestOptions {
+		return &main.ManifestOptions{
+			Imgref:     "quay.io/example/example:latest",
+			ImageTypes: []string{"qcow2"},
+			Config:     &buildconfig.BuildConfig{},
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		modify func(opts *main.ManifestOptions)
+		expErr string
+	}{
+		{
+			"bad-imgref",
+			func(opts *main.ManifestOptions) { opts.Imgref = "quay.io/example/Example" },
+			"invalid image reference 'quay.io/example/Example': ",
+		},
+		{
+			"unknown-type",
+			func(opts *main.ManifestOptions) { opts.ImageTypes = []string{"floppy"} },
+			"cannot detect build types [floppy]: ",
+		},
+		{
+			"firmware-iso",
+			func(opts *main.ManifestOptions) {
+				opts.ImageTypes = []string{"anaconda-iso"}
+				opts.Firmware = "uefi"
+			},
+			"--firmware is only supported for disk image types",
+		},
+		{
+			"partition-table-iso",
+			func(opts *main.ManifestOptions) {
+				opts.ImageTypes = []string{"anaconda-iso"}
+				opts.PartitionTableType = disk.PT_DOS
+			},
+			"--partition-table is only supported for disk image types",
+		},
+		{
+			"max-image-size-iso",
+			func(opts *main.ManifestOptions) {
+				opts.ImageTypes = []string{"anaconda-iso"}
+				opts.MaxImageSize = 1024
+			},
+			"--max-image-size is only supported for disk image types",
+		},
+		{
+			"serial-console-iso",
+			func(opts *main.ManifestOptions) {
+				opts.ImageTypes = []string{"anaconda-iso"}
+				opts.SerialConsole = "ttyS1"
+			},
+			"--serial-console is only supported for disk image types",
+		},
+		{
+			"skip-selinux-iso",
+			func(opts *main.ManifestOptions) {
+				opts.ImageTypes = []string{"anaconda-iso"}
+				opts.SkipSELinux = true
+			},
+			"--experimental-skip-selinux is only supported for disk image types",
+		},
+		{
+			"package-list-disk",
+			func(opts *main.ManifestOptions) { opts.PackageListPath = "/tmp/packages.txt" },
+			"--package-list is only supported for ISO image types, ",
+		},
+		{
+			"iso-stage2-fs-disk",
+			func(opts *main.ManifestOptions) { opts.ISOStage2FS = "erofs" },
+			"--iso-stage2-fs is only supported for ISO image types",
+		},
+		{
+			"iso-stage2-fs",
+			func(opts *main.ManifestOptions) {
+				opts.ImageTypes = []string{"anaconda-iso"}
+				opts.ISOStage2FS = "xfs"
+			},
+			`unsupported ISO stage2 filesystem "xfs", `,
+		},
+		{
+			"filesystem-customizations-iso",
+			func(opts *main.ManifestOptions) {
+				opts.ImageTypes = []string{"anaconda-iso"}
+				opts.Config = &buildconfig.BuildConfig{
+					Customizations: &blueprint.Customizations{
+						Filesystem: []blueprint.FilesystemCustomization{{Mountpoint: "/var", MinSize: 1024 * 1024 * 1024}},
+					},
+				}
+			},
+			`invalid build config: image type "anaconda-iso" does not support filesystem customizations`,
+		},
+		{
+			"build-container-disk",
+			func(opts *main.ManifestOptions) { opts.BuildImgref = "quay.io/example/build:latest" },
+			"--build-container is only supported for ISO image types, ",
+		},
+		{
+			"depsolve-options-conflict",
+			func(opts *main.ManifestOptions) {
+				installWeakDeps := true
+				opts.NoWeakDeps = true
+				opts.DepsolveOptions = &main.DepsolveOptions{InstallWeakDeps: &installWeakDeps}
+			},
+			"--no-weak-deps conflicts with --depsolve-option install_weak_deps=true",
+		},
+		{
+			"resolve-concurrency",
+			func(opts *main.ManifestOptions) { opts.ResolveConcurrency = 100 },
+			"invalid resolve concurrency 100, ",
+		},
+		{
+			"serial-console",
+			func(opts *main.ManifestOptions) { opts.SerialConsole = "ttyS1 115200" },
+			`invalid serial console "ttyS1 115200", `,
+		},
+		{
+			"partition-order",
+			func(opts *main.ManifestOptions) { opts.PartitionOrder = []string{"/boot"} },
+			`cannot order partition "/boot", only data partitions can be ordered`,
+		},
+		{
+			"kernel-cmdline",
+			func(opts *main.ManifestOptions) {
+				opts.ImageTypes = []string{"qcow2", "raw"}
+				opts.KernelCmdline = []string{"type=qcow2:console=ttyS0"}
+			},
+			`cannot use kernel cmdline "type=qcow2:console=ttyS0" only for qcow2: `,
+		},
+		{
+			"ostree-commit",
+			func(opts *main.ManifestOptions) { opts.OstreeCommit = "abc" },
+			`invalid ostree commit "abc", must be a sha256 checksum`,
+		},
+		{
+			"ca-cert",
+			func(opts *main.ManifestOptions) { opts.CACerts = []string{"/no/such/ca.pem"} },
+			"cannot read CA certificate: open /no/such/ca.pem: ",
+		},
+		{
+			"no-storage",
+			func(opts *main.ManifestOptions) {},
+			"could not access container storage, did you forget -v ",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.name == "no-storage" {
+				if _, err := os.Stat("/var/lib/containers/storage/overlay"); err == nil {
+					t.Skip("the container storage of the host is available")
+				}
+			}
+			opts := baseOpts()
+			tc.modify(opts)
+
+			var pbar fakeProgressBar
+			_, _, _, _, err := main.GenerateManifest(opts, &pbar)
+			require.Error(t, err)
+			assert.ErrorContains(t, err, tc.expErr)
+		})
+	}
+}
@@ -127,3 +127,39 @@ func TestPrepareOsbuildMTLSConfigCleanup(t *testing.T) {
 	cleanup()
 	assert.NoDirExists(t, tmpdir)
 }
+
+func TestPrepareOsbuildMTLSConfigTmpdir(t *testing.T) {
+	// restores TMPDIR after the test
+	t.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	tmpdir := t.TempDir()
+	require.NoError(t, setupTmpdir(tmpdir))
+	assert.Equal(t, tmpdir, os.Getenv("TMPDIR"))
+
+	mTLS := mTLSConfig{
+		key:  []byte("key"),
+		cert: []byte("cert"),
+		ca:   []byte("ca"),
+	}
+	envVars, cleanup, err := prepareOsbuildMTLSConfig(&mTLS)
+	require.NoError(t, err)
+	t.Cleanup(cleanup)
+	for _, envVar := range envVars {
+		fpath := strings.SplitN(envVar, "=", 2)[1]
+		assert.True(t, strings.HasPrefix(fpath, tmpdir+"/osbuild-mtls"), fpath)
+	}
+	// only the mTLS dir is left, the writable check cleans up
+	entries, err := os.ReadDir(tmpdir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestSetupTmpdirErrors(t *testing.T) {
+	t.Setenv("TMPDIR", "/tmp")
+
+	err := setupTmpdir("/does/not/exist")
+	assert.ErrorContains(t, err, `cannot use "/does/not/exist" as temporary directory: `)
+	assert.Equal(t, "/tmp", os.Getenv("TMPDIR"))
+
+	assert.NoError(t, setupTmpdir(""))
+	assert.Equal(t, "/tmp", os.Getenv("TMPDIR"))
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/osbuild/bootc-image-builder/bib/internal/source"
+)
+
+// osReleaseValueRE matches the allowed characters of the os-release ID
+// and VERSION_ID fields, see os-release(5)
+var osReleaseValueRE = regexp.MustCompile(`^[a-z0-9][a-z0-9._~-]*$`)
+
+// overrideOSRelease overrides the ID and VERSION_ID of the os-release
+// from the container. This only changes how bib detects the distro
+// (e.g. for derived distros with an unexpected os-release), the image
+// itself is not modified.
+func overrideOSRelease(osRelease *source.OSRelease, id, versionID string) error {
+	if id != "" {
+		if !osReleaseValueRE.MatchString(id) {
+			return fmt.Errorf("invalid os-release ID %q, must match %s", id, osReleaseValueRE.String())
+		}
+		logrus.Infof("using os-release ID %q instead of %q", id, osRelease.ID)
+		osRelease.ID = id
+	}
+	if versionID != "" {
+		if !osReleaseValueRE.MatchString(versionID) {
+			return fmt.Errorf("invalid os-release VERSION_ID %q, must match %s", versionID, osReleaseValueRE.String())
+		}
+		logrus.Infof("using os-release VERSION_ID %q instead of %q", versionID, osRelease.VersionID)
+		osRelease.VersionID = versionID
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/manifest"
+	"github.com/osbuild/images/pkg/runner"
+
+	bib "github.com/osbuild/bootc-image-builder/bib/cmd/bootc-image-builder"
+	"github.com/osbuild/bootc-image-builder/bib/internal/source"
+)
+
+func TestOverrideOSReleaseDrivesDistroSelection(t *testing.T) {
+	// a derived distro with an os-release bib does not know about
+	osRelease := source.OSRelease{
+		ID:        "myderived",
+		VersionID: "40.20241015",
+		Name:      "My Derived OS",
+	}
+	// unknown distros fall back to the generic runner
+	distro, r, err := bib.GetDistroAndRunner(osRelease)
+	require.NoError(t, err)
+	assert.Equal(t, manifest.Distro(manifest.DISTRO_NULL), distro)
+	assert.Equal(t, &runner.Linux{}, r)
+
+	err = bib.OverrideOSRelease(&osRelease, "fedora", "40")
+	require.NoError(t, err)
+	assert.Equal(t, "fedora", osRelease.ID)
+	assert.Equal(t, "40", osRelease.VersionID)
+	// other fields are not touched
+	assert.Equal(t, "My Derived OS", osRelease.Name)
+
+	distro, r, err = bib.GetDistroAndRunner(osRelease)
+	require.NoError(t, err)
+	assert.Equal(t, manifest.Distro(manifest.DISTRO_FEDORA), distro)
+	assert.Equal(t, &runner.Fedora{Version: 40}, r)
+}
+
+func TestOverrideOSReleaseOnlyVersion(t *testing.T) {
+	osRelease := source.OSRelease{ID: "rhel", VersionID: "9"}
+	_, _, err := bib.GetDistroAndRunner(osRelease)
+	require.EqualError(t, err, "invalid RHEL version format: 9")
+
+	require.NoError(t, bib.OverrideOSRelease(&osRelease, "", "9.4"))
+	assert.Equal(t, "rhel", osRelease.ID)
+	distro, r, err := bib.GetDistroAndRunner(osRelease)
+	require.NoError(t, err)
+	assert.Equal(t, manifest.Distro(manifest.DISTRO_EL9), distro)
+	assert.Equal(t, &runner.RHEL{Major: 9, Minor: 4}, r)
+}
+
+func TestOverrideOSReleaseErrors(t *testing.T) {
+	osRelease := source.OSRelease{ID: "fedora", VersionID: "40"}
+	err := bib.OverrideOSRelease(&osRelease, "Fedora", "")
+	assert.EqualError(t, err, `invalid os-release ID "Fedora", must match ^[a-z0-9][a-z0-9._~-]*$`)
+	err = bib.OverrideOSRelease(&osRelease, "", "40 beta")
+	assert.EqualError(t, err, `invalid os-release VERSION_ID "40 beta", must match ^[a-z0-9][a-z0-9._~-]*$`)
+	assert.Equal(t, source.OSRelease{ID: "fedora", VersionID: "40"}, osRelease)
+}
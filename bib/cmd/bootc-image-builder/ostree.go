@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// ostreeCommitRE matches an ostree commit checksum (sha256)
+var ostreeCommitRE = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ostreeObjectsDir is the object store of the ostree repository that
+// is embedded into bootc containers (relative to the container root)
+const ostreeObjectsDir = "sysroot/ostree/repo/objects"
+
+// validateOstreeCommitArg checks the syntax of the --ostree-commit
+func validateOstreeCommitArg(commit string) error {
+	if commit != "" && !ostreeCommitRE.MatchString(commit) {
+		return fmt.Errorf("invalid ostree commit %q, must be a sha256 checksum", commit)
+	}
+	return nil
+}
+
+// containerOstreeCommits returns the checksums of the ostree commits of
+// the container with the given root. The commit objects are stored as
+// "objects/XX/YYYY.commit" where XXYYYY is the commit checksum.
+func containerOstreeCommits(root string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(root, ostreeObjectsDir, "*", "*.commit"))
+	if err != nil {
+		return nil, err
+	}
+	commits := make([]string, 0, len(paths))
+	for _, p := range paths {
+		commit := filepath.Base(filepath.Dir(p)) + strings.TrimSuffix(filepath.Base(p), ".commit")
+		if ostreeCommitRE.MatchString(commit) {
+			commits = append(commits, commit)
+		}
+	}
+	sort.Strings(commits)
+	return commits, nil
+}
+
+// verifyOstreeCommit ensures that the container with the given root
+// has the --ostree-commit embedded
+func verifyOstreeCommit(root, commit string) error {
+	if commit == "" {
+		return nil
+	}
+	commits, err := containerOstreeCommits(root)
+	if err != nil {
+		return fmt.Errorf("cannot read ostree commits of the container: %w", err)
+	}
+	if len(commits) == 0 {
+		return fmt.Errorf("cannot verify ostree commit %s: the container has no ostree commit", commit)
+	}
+	if !slices.Contains(commits, commit) {
+		return fmt.Errorf("ostree commit mismatch: the container has %s, expected %s", strings.Join(commits, ", "), commit)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testOstreeCommit = "9a4ce1d3f1bb1f2e3e5a3b8fd1a5e0fe0b5e4a2c8d6f7e9b0a1c2d3e4f5a6b7c"
+
+// makeFakeOstreeContainer creates a container root with the given
+// ostree commits in its embedded ostree repository
+func makeFakeOstreeContainer(t *testing.T, commits ...string) string {
+	root := t.TempDir()
+	for _, commit := range commits {
+		dir := filepath.Join(root, ostreeObjectsDir, commit[:2])
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, commit[2:]+".commit"), nil, 0644))
+		// other objects are ignored
+		require.NoError(t, os.WriteFile(filepath.Join(dir, commit[2:]+".dirtree"), nil, 0644))
+	}
+	return root
+}
+
+func TestValidateOstreeCommitArg(t *testing.T) {
+	assert.NoError(t, validateOstreeCommitArg(""))
+	assert.NoError(t, validateOstreeCommitArg(testOstreeCommit))
+	for _, bad := range []string{"abc", testOstreeCommit + "0", "9A4CE1D3F1BB1F2E3E5A3B8FD1A5E0FE0B5E4A2C8D6F7E9B0A1C2D3E4F5A6B7C"} {
+		assert.EqualError(t, validateOstreeCommitArg(bad), `invalid ostree commit "`+bad+`", must be a sha256 checksum`)
+	}
+}
+
+func TestVerifyOstreeCommit(t *testing.T) {
+	otherCommit := "0000000000000000000000000000000000000000000000000000000000000001"
+
+	root := makeFakeOstreeContainer(t, testOstreeCommit)
+	commits, err := containerOstreeCommits(root)
+	require.NoError(t, err)
+	assert.Equal(t, []string{testOstreeCommit}, commits)
+
+	// match
+	assert.NoError(t, verifyOstreeCommit(root, testOstreeCommit))
+	// nothing to verify
+	assert.NoError(t, verifyOstreeCommit(root, ""))
+	// mismatch
+	err = verifyOstreeCommit(root, otherCommit)
+	assert.EqualError(t, err, "ostree commit mismatch: the container has "+testOstreeCommit+", expected "+otherCommit)
+	// no ostree commit at all
+	err = verifyOstreeCommit(t.TempDir(), testOstreeCommit)
+	assert.EqualError(t, err, "cannot verify ostree commit "+testOstreeCommit+": the container has no ostree commit")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// parseOutputMode parses the octal --output-mode permissions
+func parseOutputMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("invalid output directory mode %q, expected octal permissions like 0755", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// prepareOutputDir ensures that the output directory exists. If it
+// does not exist it is created with the given mode unless noCreate is
+// set. An existing directory is used as is.
+func prepareOutputDir(outputDir string, noCreate bool, mode os.FileMode) error {
+	st, err := os.Stat(outputDir)
+	switch {
+	case err == nil:
+		if !st.IsDir() {
+			return fmt.Errorf("output %q is not a directory", outputDir)
+		}
+		return nil
+	case !errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("cannot use output directory: %w", err)
+	case noCreate:
+		return fmt.Errorf("output directory %q does not exist (and --no-create-output is set)", outputDir)
+	}
+
+	if err := os.MkdirAll(outputDir, mode); err != nil {
+		return fmt.Errorf("cannot setup build dir: %w", err)
+	}
+	// MkdirAll() is subject to the umask
+	if err := os.Chmod(outputDir, mode); err != nil {
+		return fmt.Errorf("cannot setup build dir: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOutputMode(t *testing.T) {
+	for _, tc := range []struct {
+		s        string
+		expected os.FileMode
+		expErr   string
+	}{
+		{"0755", 0o755, ""},
+		{"750", 0o750, ""},
+		{"0700", 0o700, ""},
+		{"0888", 0, `invalid output directory mode "0888", expected octal permissions like 0755`},
+		{"01777", 0, `invalid output directory mode "01777", expected octal permissions like 0755`},
+		{"rwx", 0, `invalid output directory mode "rwx", expected octal permissions like 0755`},
+	} {
+		mode, err := parseOutputMode(tc.s)
+		if tc.expErr != "" {
+			assert.EqualError(t, err, tc.expErr)
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, mode)
+		}
+	}
+}
+
+func TestPrepareOutputDirCustomMode(t *testing.T) {
+	outputDir := filepath.Join(t.TempDir(), "output")
+	// the mode is applied even with a restrictive umask
+	err := prepareOutputDir(outputDir, false, 0o770)
+	require.NoError(t, err)
+	st, err := os.Stat(outputDir)
+	require.NoError(t, err)
+	assert.True(t, st.IsDir())
+	assert.Equal(t, os.FileMode(0o770), st.Mode().Perm())
+}
+
+func TestPrepareOutputDirExistingIsUntouched(t *testing.T) {
+	outputDir := t.TempDir()
+	require.NoError(t, os.Chmod(outputDir, 0o700))
+
+	for _, noCreate := range []bool{false, true} {
+		err := prepareOutputDir(outputDir, noCreate, 0o755)
+		require.NoError(t, err)
+		st, err := os.Stat(outputDir)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o700), st.Mode().Perm())
+	}
+}
+
+func TestPrepareOutputDirNoCreate(t *testing.T) {
+	outputDir := filepath.Join(t.TempDir(), "output")
+	err := prepareOutputDir(outputDir, true, 0o755)
+	assert.EqualError(t, err, `output directory "`+outputDir+`" does not exist (and --no-create-output is set)`)
+	assert.NoDirExists(t, outputDir)
+}
+
+func TestPrepareOutputDirNotADir(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(output, nil, 0o644))
+	err := prepareOutputDir(output, false, 0o755)
+	assert.EqualError(t, err, `output "`+output+`" is not a directory`)
+}
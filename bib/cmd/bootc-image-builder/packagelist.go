@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/osbuild/images/pkg/dnfjson"
+)
+
+// packageList returns the sorted and unique NEVRAs of the packages of
+// all depsolved package sets
+func packageList(depsolvedSets map[string]dnfjson.DepsolveResult) []string {
+	seen := make(map[string]bool)
+	var nevras []string
+	for _, res := range depsolvedSets {
+		for _, pkg := range res.Packages {
+			nevra := pkg.GetNEVRA()
+			if seen[nevra] {
+				continue
+			}
+			seen[nevra] = true
+			nevras = append(nevras, nevra)
+		}
+	}
+	sort.Strings(nevras)
+	return nevras
+}
+
+// writePackageList writes the package list, one NEVRA per line
+func writePackageList(path string, depsolvedSets map[string]dnfjson.DepsolveResult) error {
+	var content string
+	if pkgs := packageList(depsolvedSets); len(pkgs) > 0 {
+		content = strings.Join(pkgs, "\n") + "\n"
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("cannot write package list: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/dnfjson"
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+func TestPackageList(t *testing.T) {
+	assert.Nil(t, packageList(nil))
+
+	depsolvedSets := map[string]dnfjson.DepsolveResult{
+		"build": {
+			Packages: []rpmmd.PackageSpec{
+				{Name: "xorriso", Version: "1.5.6", Release: "4.fc40", Arch: "x86_64"},
+				{Name: "bash", Version: "5.2.26", Release: "3.fc40", Arch: "x86_64"},
+			},
+		},
+		"anaconda-tree": {
+			Packages: []rpmmd.PackageSpec{
+				{Name: "bash", Version: "5.2.26", Release: "3.fc40", Arch: "x86_64"},
+				{Name: "shim-x64", Epoch: 1, Version: "15.8", Release: "3", Arch: "x86_64"},
+			},
+		},
+	}
+	assert.Equal(t, []string{
+		"bash-5.2.26-3.fc40.x86_64",
+		"shim-x64-1:15.8-3.x86_64",
+		"xorriso-1.5.6-4.fc40.x86_64",
+	}, packageList(depsolvedSets))
+
+	path := filepath.Join(t.TempDir(), "packages.txt")
+	require.NoError(t, writePackageList(path, depsolvedSets))
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "bash-5.2.26-3.fc40.x86_64\nshim-x64-1:15.8-3.x86_64\nxorriso-1.5.6-4.fc40.x86_64\n", string(content))
+}
+
+func TestWritePackageListBadPath(t *testing.T) {
+	err := writePackageList("/does/not/exist/packages.txt", nil)
+	assert.ErrorContains(t, err, "cannot write package list: ")
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/osbuild/images/pkg/arch"
 	"github.com/osbuild/images/pkg/disk"
 	"github.com/osbuild/images/pkg/distro"
@@ -19,6 +22,9 @@ const (
 	// https://github.com/containers/bootc/pull/417 and
 	// https://github.com/ostreedev/ostree/issues/3193
 	RootOptions = "ro"
+	// RootOptionsRW are the root mount options with --rw-root, this
+	// is only safe for container images that do not use composefs
+	RootOptionsRW = "rw"
 )
 
 // diskUuidOfUnknownOrigin is used by default for disk images,
@@ -128,3 +134,37 @@ var partitionTables = distro.BasePartitionTableMap{
 		},
 	},
 }
+
+// setRootReadWrite changes the fstab options of the root filesystem
+// from read-only to read-write
+func setRootReadWrite(pt *disk.PartitionTable) error {
+	var found bool
+	err := pt.ForEachMountable(func(mnt disk.Mountable, _ []disk.Entity) error {
+		if mnt.GetMountpoint() != "/" {
+			return nil
+		}
+		found = true
+		switch mnt := mnt.(type) {
+		case *disk.Filesystem:
+			var opts []string
+			for _, opt := range strings.Split(mnt.FSTabOptions, ",") {
+				if opt != "" && opt != "ro" && opt != RootOptionsRW {
+					opts = append(opts, opt)
+				}
+			}
+			mnt.FSTabOptions = strings.Join(append([]string{RootOptionsRW}, opts...), ",")
+		case *disk.BtrfsSubvolume:
+			mnt.ReadOnly = false
+		default:
+			return fmt.Errorf("cannot make root read-write: unsupported mount type %T", mnt)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("cannot make root read-write: no root filesystem in the partition table")
+	}
+	return nil
+}
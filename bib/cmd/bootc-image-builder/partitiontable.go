@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/osbuild/images/pkg/disk"
+)
+
+// dosPartitionTypes maps the GPT partition types of the base
+// partition tables to their dos partition type IDs
+var dosPartitionTypes = map[string]string{
+	disk.BIOSBootPartitionGUID:  disk.BIOSBootPartitionDOSID,
+	disk.EFISystemPartitionGUID: disk.EFISystemPartitionDOSID,
+	disk.FilesystemDataGUID:     disk.FilesystemLinuxDOSID,
+	disk.PRePartitionGUID:       disk.PRepPartitionDOSID,
+}
+
+// parsePartitionTableType parses the --partition-table option, an
+// empty string means the default of the architecture
+func parsePartitionTableType(s string) (disk.PartitionTableType, error) {
+	switch s {
+	case "":
+		return disk.PT_NONE, nil
+	case "gpt":
+		return disk.PT_GPT, nil
+	case "dos":
+		return disk.PT_DOS, nil
+	}
+	return disk.PT_NONE, fmt.Errorf("unsupported partition table type %q, supported: gpt, dos", s)
+}
+
+// dosDiskID returns the dos disk identifier for the (GPT) disk UUID
+// of the base partition table, e.g. "0xd209c89e"
+func dosDiskID(gptUUID string) string {
+	return "0x" + strings.ToLower(strings.ReplaceAll(gptUUID, "-", "")[:8])
+}
+
+// partitionTableForType returns the base partition table converted to
+// the given partition table type. The base partition tables are all
+// gpt so only the conversion to dos is needed.
+func partitionTableForType(pt disk.PartitionTable, ptType disk.PartitionTableType) (disk.PartitionTable, error) {
+	if ptType == disk.PT_NONE || ptType == pt.Type {
+		return pt, nil
+	}
+	if pt.Type != disk.PT_GPT || ptType != disk.PT_DOS {
+		return pt, fmt.Errorf("cannot convert %s partition table to %s", pt.Type, ptType)
+	}
+
+	// the partitions are shared with the base partition table
+	partitions := make([]disk.Partition, 0, len(pt.Partitions))
+	for _, part := range pt.Partitions {
+		dosType, ok := dosPartitionTypes[part.Type]
+		if !ok {
+			return pt, fmt.Errorf("cannot use dos partition table: unsupported partition type %s", part.Type)
+		}
+		part.Type = dosType
+		// dos partitions have no UUID
+		part.UUID = ""
+		partitions = append(partitions, part)
+	}
+	pt.Partitions = partitions
+	pt.Type = disk.PT_DOS
+	pt.UUID = dosDiskID(pt.UUID)
+	return pt, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePartitionTableType(t *testing.T) {
+	for _, tc := range []struct {
+		arg    string
+		exp    disk.PartitionTableType
+		expErr string
+	}{
+		{"", disk.PT_NONE, ""},
+		{"gpt", disk.PT_GPT, ""},
+		{"dos", disk.PT_DOS, ""},
+		{"mbr", disk.PT_NONE, `unsupported partition table type "mbr", supported: gpt, dos`},
+	} {
+		ptType, err := parsePartitionTableType(tc.arg)
+		if tc.expErr == "" {
+			assert.NoError(t, err)
+			assert.Equal(t, tc.exp, ptType)
+		} else {
+			assert.EqualError(t, err, tc.expErr)
+		}
+	}
+}
+
+func TestPartitionTableForTypeDos(t *testing.T) {
+	basept := partitionTables["x86_64"]
+
+	pt, err := partitionTableForType(basept, disk.PT_DOS)
+	require.NoError(t, err)
+	assert.Equal(t, disk.PT_DOS, pt.Type)
+	assert.Equal(t, "0xd209c89e", pt.UUID)
+	var types []string
+	for _, part := range pt.Partitions {
+		types = append(types, part.Type)
+		assert.Empty(t, part.UUID)
+	}
+	assert.Equal(t, []string{disk.BIOSBootPartitionDOSID, disk.EFISystemPartitionDOSID, disk.FilesystemLinuxDOSID, disk.FilesystemLinuxDOSID}, types)
+
+	// the base partition table is not modified
+	assert.Equal(t, disk.PT_GPT, partitionTables["x86_64"].Type)
+	assert.Equal(t, disk.BIOSBootPartitionGUID, partitionTables["x86_64"].Partitions[0].Type)
+}
+
+func TestPartitionTableForTypeNoop(t *testing.T) {
+	basept := partitionTables["aarch64"]
+
+	for _, ptType := range []disk.PartitionTableType{disk.PT_NONE, disk.PT_GPT} {
+		pt, err := partitionTableForType(basept, ptType)
+		require.NoError(t, err)
+		assert.Equal(t, basept, pt)
+	}
+}
+
+func TestPartitionTableForTypeUnsupportedPartition(t *testing.T) {
+	basept := disk.PartitionTable{
+		Type:       disk.PT_GPT,
+		Partitions: []disk.Partition{{Type: disk.XBootLDRPartitionGUID}},
+	}
+	_, err := partitionTableForType(basept, disk.PT_DOS)
+	assert.EqualError(t, err, "cannot use dos partition table: unsupported partition type "+disk.XBootLDRPartitionGUID)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/osbuild/images/pkg/disk"
+	"golang.org/x/exp/slices"
+)
+
+// partitionOrderFixedMountpoints are the partitions that are laid out
+// by the base partition table and cannot be moved via --partition-order
+var partitionOrderFixedMountpoints = []string{"/", "/boot", "/boot/efi"}
+
+// validatePartitionOrder checks the --partition-order mountpoints, the
+// position of a mountpoint in the list is its index on the disk so
+// every mountpoint can only be given once
+func validatePartitionOrder(order []string) error {
+	for idx, mnt := range order {
+		if slices.Contains(partitionOrderFixedMountpoints, mnt) {
+			return fmt.Errorf("cannot order partition %q, only data partitions can be ordered", mnt)
+		}
+		if slices.Contains(order[:idx], mnt) {
+			return fmt.Errorf("partition %q is given multiple times in the partition order", mnt)
+		}
+	}
+	return nil
+}
+
+// orderPartitions moves the partitions that contain the given
+// mountpoints so that they appear on the disk in the given order. The
+// reordered partitions take the place of the partitions they replace,
+// all other partitions keep their position.
+func orderPartitions(pt *disk.PartitionTable, order []string) error {
+	if len(order) == 0 {
+		return nil
+	}
+
+	partForMnt := make(map[string]*disk.Partition, len(order))
+	err := pt.ForEachMountable(func(mnt disk.Mountable, path []disk.Entity) error {
+		if !slices.Contains(order, mnt.GetMountpoint()) {
+			return nil
+		}
+		for _, ent := range path {
+			if part, ok := ent.(*disk.Partition); ok {
+				partForMnt[mnt.GetMountpoint()] = part
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	reordered := make(map[*disk.Partition]bool, len(order))
+	ordered := make([]disk.Partition, 0, len(order))
+	for _, mnt := range order {
+		part, ok := partForMnt[mnt]
+		if !ok {
+			return fmt.Errorf("cannot order partition %q: no such mountpoint in the partition table", mnt)
+		}
+		// e.g. two logical volumes of the same LVM partition
+		for _, other := range order[:len(ordered)] {
+			if partForMnt[other] == part {
+				return fmt.Errorf("cannot order partition %q: it is on the same partition as %q", mnt, other)
+			}
+		}
+		reordered[part] = true
+		ordered = append(ordered, *part)
+	}
+
+	// the partitions are not necessarily ordered by their offset, e.g.
+	// the root partition is always placed last
+	parts := make([]*disk.Partition, 0, len(pt.Partitions))
+	for idx := range pt.Partitions {
+		parts = append(parts, &pt.Partitions[idx])
+	}
+	sort.SliceStable(parts, func(i, j int) bool {
+		return parts[i].Start < parts[j].Start
+	})
+
+	// the new on-disk sequence, the ordered partitions fill the slots
+	// of the partitions that get reordered
+	seq := make([]disk.Partition, 0, len(parts))
+	first := -1
+	for idx, part := range parts {
+		if !reordered[part] {
+			seq = append(seq, *part)
+			continue
+		}
+		if first < 0 {
+			first = idx
+			ordered[0].Start = part.Start
+		}
+		seq = append(seq, ordered[0])
+		ordered = ordered[1:]
+	}
+	// everything after the first moved partition is laid out again
+	for idx := first + 1; idx < len(seq); idx++ {
+		prev := seq[idx-1]
+		seq[idx].Start = pt.AlignUp(prev.Start + prev.Size)
+	}
+	for idx, part := range parts {
+		*part = seq[idx]
+	}
+
+	// the GPT header is also at the end of the partition table
+	footer := pt.ExtraPadding
+	if pt.Type == disk.PT_GPT {
+		footer += pt.HeaderSize()
+	}
+	last := parts[len(parts)-1]
+	pt.Size = max(pt.Size, pt.AlignUp(last.Start+last.Size+footer))
+	return nil
+}
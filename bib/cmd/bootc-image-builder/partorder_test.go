@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePartitionOrder(t *testing.T) {
+	for _, tc := range []struct {
+		order  []string
+		expErr string
+	}{
+		{nil, ""},
+		{[]string{"/var/log", "/var/data"}, ""},
+		{[]string{"/var/log", "/var/data", "/var/log"}, `partition "/var/log" is given multiple times in the partition order`},
+		{[]string{"/var/log", "/"}, `cannot order partition "/", only data partitions can be ordered`},
+		{[]string{"/boot/efi"}, `cannot order partition "/boot/efi", only data partitions can be ordered`},
+	} {
+		err := validatePartitionOrder(tc.order)
+		if tc.expErr == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tc.expErr)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/spf13/pflag"
+
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/container"
+)
+
+// supportedArches are the architecture names (go/OCI and rpm style)
+// that can be given via --target-arch (or its --arch alias) or --platform
+var supportedArches = []string{"amd64", "x86_64", "arm64", "aarch64", "s390x", "ppc64le"}
+
+func archFromString(s string) (arch.Arch, error) {
+	for _, name := range supportedArches {
+		if s == name {
+			return arch.FromString(s), nil
+		}
+	}
+	return arch.ARCH_UNSET, fmt.Errorf("unsupported architecture %q, supported: %s", s, strings.Join(supportedArches, ", "))
+}
+
+// normalizeArchAlias makes --arch an alias of --target-arch
+func normalizeArchAlias(_ *pflag.FlagSet, name string) pflag.NormalizedName {
+	if name == "arch" {
+		name = "target-arch"
+	}
+	return pflag.NormalizedName(name)
+}
+
+// parsePlatform parses an OCI platform string of the form
+// "os/arch[/variant]", e.g. "linux/arm64/v8" and returns the
+// arch and variant.
+func parsePlatform(platform string) (archStr, variant string, err error) {
+	l := strings.Split(platform, "/")
+	if len(l) < 2 || len(l) > 3 {
+		return "", "", fmt.Errorf("invalid platform %q, expected os/arch[/variant]", platform)
+	}
+	if l[0] != "linux" {
+		return "", "", fmt.Errorf("unsupported platform os %q in %q, only linux is supported", l[0], platform)
+	}
+	if _, err := archFromString(l[1]); err != nil {
+		return "", "", fmt.Errorf("invalid platform %q: %w", platform, err)
+	}
+	if len(l) == 3 {
+		if l[2] == "" {
+			return "", "", fmt.Errorf("invalid platform %q, empty variant", platform)
+		}
+		variant = l[2]
+	}
+	return l[1], variant, nil
+}
+
+// targetArchAndVariant returns the target architecture and the
+// platform variant from the --target-arch and --platform flags. The
+// architecture from --platform takes precedence but if both flags are
+// given they must agree.
+func targetArchAndVariant(flags *pflag.FlagSet) (targetArch, variant string, err error) {
+	targetArch, err = flags.GetString("target-arch")
+	if err != nil {
+		return "", "", err
+	}
+	// fail early, arch.FromString() panics on unknown architectures
+	var ta arch.Arch
+	if targetArch != "" {
+		ta, err = archFromString(targetArch)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid --target-arch: %w", err)
+		}
+	}
+	platform, err := flags.GetString("platform")
+	if err != nil {
+		return "", "", err
+	}
+	if platform == "" {
+		return targetArch, "", nil
+	}
+
+	platformArch, variant, err := parsePlatform(platform)
+	if err != nil {
+		return "", "", err
+	}
+	if targetArch != "" {
+		if pa, _ := archFromString(platformArch); pa != ta {
+			return "", "", fmt.Errorf("--platform %q does not match --target-arch %q", platform, targetArch)
+		}
+	}
+	return platformArch, variant, nil
+}
+
+// containerResolver is the subset of the container.Resolver API that
+// is used when generating the manifest
+type containerResolver interface {
+	Add(spec container.SourceSpec)
+	Finish() ([]container.Spec, error)
+}
+
+// maxResolveConcurrency bounds the --resolve-concurrency, every
+// resolve talks to the registry (or the container storage)
+const maxResolveConcurrency = 32
+
+func validateResolveConcurrency(concurrency int) error {
+	if concurrency < 0 || concurrency > maxResolveConcurrency {
+		return fmt.Errorf("invalid resolve concurrency %d, must be between 0 (no limit) and %d", concurrency, maxResolveConcurrency)
+	}
+	return nil
+}
+
+// variantResolver resolves containers just like container.Resolver
+// but also selects the platform variant, trusts the CA certificates
+// in certDir and limits the number of concurrent resolves
+// (container.Resolver only knows about the architecture)
+type variantResolver struct {
+	arch    string
+	variant string
+	certDir string
+
+	// resolve is a field so that it can be mocked in tests
+	resolve func(src container.SourceSpec) (container.Spec, error)
+	// sem limits the number of concurrent resolves, nil means no limit
+	sem chan struct{}
+
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	results []resolveResult
+}
+
+type resolveResult struct {
+	spec container.Spec
+	err  error
+}
+
+func newVariantResolver(architecture, variant, certDir string, concurrency int) *variantResolver {
+	r := &variantResolver{arch: architecture, variant: variant, certDir: certDir}
+	r.resolve = r.resolveWithClient
+	if concurrency > 0 {
+		r.sem = make(chan struct{}, concurrency)
+	}
+	return r
+}
+
+func (r *variantResolver) resolveWithClient(src container.SourceSpec) (container.Spec, error) {
+	client, err := container.NewClient(src.Source)
+	if err != nil {
+		return container.Spec{}, err
+	}
+	client.SetTLSVerify(src.TLSVerify)
+	client.SetArchitectureChoice(r.arch)
+	client.SetVariantChoice(r.variant)
+	if r.certDir != "" {
+		client.SetDockerCertPath(r.certDir)
+	}
+
+	spec, err := client.Resolve(context.Background(), src.Name, src.Local)
+	if err != nil {
+		return spec, fmt.Errorf("'%s': %w", src.Source, err)
+	}
+	return spec, nil
+}
+
+func (r *variantResolver) Add(src container.SourceSpec) {
+	r.mu.Lock()
+	idx := len(r.results)
+	r.results = append(r.results, resolveResult{})
+	r.mu.Unlock()
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		if r.sem != nil {
+			r.sem <- struct{}{}
+			defer func() { <-r.sem }()
+		}
+		spec, err := r.resolve(src)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.results[idx] = resolveResult{spec: spec, err: err}
+	}()
+}
+
+// Finish waits for all added containers and returns their specs in
+// the order they were added
+func (r *variantResolver) Finish() ([]container.Spec, error) {
+	r.wg.Wait()
+
+	r.mu.Lock()
+	results := r.results
+	r.results = nil
+	r.mu.Unlock()
+
+	var specs []container.Spec
+	var errs []error
+	for _, res := range results {
+		if res.err != nil {
+			errs = append(errs, res.err)
+			continue
+		}
+		specs = append(specs, res.spec)
+	}
+	if len(errs) > 0 {
+		return specs, fmt.Errorf("failed to resolve container: %w", errors.Join(errs...))
+	}
+	return specs, nil
+}
+
+// newContainerResolver is a variable so that it can be mocked in tests
+var newContainerResolver = func(architecture arch.Arch, variant, certDir string, concurrency int) containerResolver {
+	// XXX: should NewResolver() take "arch.Arch"?
+	if variant == "" && certDir == "" && concurrency == 0 {
+		return container.NewResolver(architecture.String())
+	}
+	return newVariantResolver(architecture.String(), variant, certDir, concurrency)
+}
@@ -0,0 +1,117 @@
+package main_test
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/container"
+
+	main "github.com/osbuild/bootc-image-builder/bib/cmd/bootc-image-builder"
+)
+
+func TestTargetArchAndVariant(t *testing.T) {
+	for _, tc := range []struct {
+		targetArch      string
+		platform        string
+		expectedArch    string
+		expectedVariant string
+		expectedErr     string
+	}{
+		{"", "", "", "", ""},
+		{"arm64", "", "arm64", "", ""},
+		{"", "linux/arm64/v8", "arm64", "v8", ""},
+		{"", "linux/amd64", "amd64", "", ""},
+		{"aarch64", "linux/arm64/v8", "arm64", "v8", ""},
+		{"amd64", "linux/arm64/v8", "", "", `--platform "linux/arm64/v8" does not match --target-arch "amd64"`},
+		{"", "arm64", "", "", `invalid platform "arm64", expected os/arch[/variant]`},
+		{"", "linux/arm64/v8/extra", "", "", `invalid platform "linux/arm64/v8/extra", expected os/arch[/variant]`},
+		{"", "windows/amd64", "", "", `unsupported platform os "windows" in "windows/amd64", only linux is supported`},
+		{"", "linux/mips", "", "", `invalid platform "linux/mips": unsupported architecture "mips"`},
+		{"", "linux/arm64/", "", "", `invalid platform "linux/arm64/", empty variant`},
+		{"mips", "", "", "", `invalid --target-arch: unsupported architecture "mips", supported: amd64, x86_64, arm64, aarch64, s390x, ppc64le`},
+	} {
+		t.Run(tc.targetArch+"_"+tc.platform, func(t *testing.T) {
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			flags.String("target-arch", tc.targetArch, "")
+			flags.String("platform", tc.platform, "")
+
+			targetArch, variant, err := main.TargetArchAndVariant(flags)
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedArch, targetArch)
+			assert.Equal(t, tc.expectedVariant, variant)
+		})
+	}
+}
+
+type fakeContainerResolver struct {
+	added []container.SourceSpec
+	arch  arch.Arch
+}
+
+func (f *fakeContainerResolver) Add(spec container.SourceSpec) {
+	f.added = append(f.added, spec)
+}
+
+func (f *fakeContainerResolver) Finish() ([]container.Spec, error) {
+	specs := make([]container.Spec, 0, len(f.added))
+	for _, src := range f.added {
+		specs = append(specs, container.Spec{
+			Source:  src.Source,
+			Digest:  "sha256:dddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddd",
+			ImageID: "sha256:1111111111111111111111111111111111111111111111111111111111111111",
+			Arch:    f.arch,
+		})
+	}
+	f.added = nil
+	return specs, nil
+}
+
+func TestMakeManifestPassesPlatformToResolver(t *testing.T) {
+	var resolverArch arch.Arch
+	var resolverVariant, resolverCertDir string
+	var resolverConcurrency int
+	restore := main.MockNewContainerResolver(func(architecture arch.Arch, variant, certDir string, concurrency int) main.ContainerResolver {
+		resolverArch = architecture
+		resolverVariant = variant
+		resolverCertDir = certDir
+		resolverConcurrency = concurrency
+		return &fakeContainerResolver{arch: architecture}
+	})
+	defer restore()
+
+	config := main.ManifestConfig(*getBaseConfig())
+	config.ImageTypes = []string{"qcow2"}
+	config.Architecture = arch.ARCH_AARCH64
+	config.PlatformVariant = "v8"
+	config.CACertDir = "/run/bib-ca-certs"
+	config.ResolveConcurrency = 4
+
+	_, _, err := main.MakeManifest(&config, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, arch.ARCH_AARCH64, resolverArch)
+	assert.Equal(t, "v8", resolverVariant)
+	assert.Equal(t, "/run/bib-ca-certs", resolverCertDir)
+	assert.Equal(t, 4, resolverConcurrency)
+}
+
+func TestMakeManifestResolverArchMismatch(t *testing.T) {
+	restore := main.MockNewContainerResolver(func(architecture arch.Arch, variant, certDir string, concurrency int) main.ContainerResolver {
+		return &fakeContainerResolver{arch: arch.ARCH_AARCH64}
+	})
+	defer restore()
+
+	config := main.ManifestConfig(*getBaseConfig())
+	config.ImageTypes = []string{"qcow2"}
+	config.ResolveConcurrency = 2
+
+	_, _, err := main.MakeManifest(&config, nil, "")
+	assert.ErrorContains(t, err, `image found is for unexpected architecture "aarch64" (expected "x86_64")`)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/osbuild/bootc-image-builder/bib/pkg/progress"
+)
+
+// findArtifacts returns the files that osbuild exported into the
+// output directory for the given exports
+func findArtifacts(outputDir string, exports []string) ([]string, error) {
+	var artifacts []string
+	for _, export := range exports {
+		matches, err := filepath.Glob(filepath.Join(outputDir, export, "*"))
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, matches...)
+	}
+	sort.Strings(artifacts)
+	return artifacts, nil
+}
+
+// runPostBuild runs the given post-build script. The output directory
+// is passed as the first argument followed by the built artifacts. The
+// same information is also available via the BIB_OUTPUT_DIR and
+// BIB_ARTIFACTS (newline separated) environment variables.
+func runPostBuild(pbar progress.ProgressBar, script, outputDir string, artifacts []string) error {
+	pbar.SetMessagef("Running post-build script %s", script)
+
+	cmd := exec.Command(script, append([]string{outputDir}, artifacts...)...)
+	cmd.Env = append(os.Environ(),
+		"BIB_OUTPUT_DIR="+outputDir,
+		"BIB_ARTIFACTS="+strings.Join(artifacts, "\n"),
+	)
+	output, err := cmd.CombinedOutput()
+	for _, line := range strings.Split(strings.TrimRight(string(output), "\n"), "\n") {
+		if line != "" {
+			pbar.SetMessagef("post-build: %s", line)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("post-build script %s failed: %w\noutput:\n%s", script, err, output)
+	}
+	return nil
+}
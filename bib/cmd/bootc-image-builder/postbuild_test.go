@@ -0,0 +1,74 @@
+package main_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	main "github.com/osbuild/bootc-image-builder/bib/cmd/bootc-image-builder"
+)
+
+func makeFakeBuildOutput(t *testing.T) (outputDir string, artifacts []string) {
+	outputDir = t.TempDir()
+	for _, p := range []string{"qcow2/disk.qcow2", "image/disk.raw"} {
+		path := filepath.Join(outputDir, p)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, nil, 0644))
+	}
+	artifacts, err := main.FindArtifacts(outputDir, []string{"qcow2", "image"})
+	require.NoError(t, err)
+	return outputDir, artifacts
+}
+
+func TestFindArtifacts(t *testing.T) {
+	outputDir, artifacts := makeFakeBuildOutput(t)
+	assert.Equal(t, []string{
+		filepath.Join(outputDir, "image/disk.raw"),
+		filepath.Join(outputDir, "qcow2/disk.qcow2"),
+	}, artifacts)
+}
+
+func TestRunPostBuildHappy(t *testing.T) {
+	outputDir, artifacts := makeFakeBuildOutput(t)
+
+	marker := filepath.Join(t.TempDir(), "marker")
+	script := filepath.Join(t.TempDir(), "post-build.sh")
+	err := os.WriteFile(script, []byte(fmt.Sprintf(`#!/bin/sh -e
+echo "args: $@" > '%[1]s'
+echo "outdir: $BIB_OUTPUT_DIR" >> '%[1]s'
+echo "artifacts: $BIB_ARTIFACTS" >> '%[1]s'
+echo "signed"
+`, marker)), 0755)
+	require.NoError(t, err)
+
+	pbar := &fakeProgressBar{}
+	err = main.RunPostBuild(pbar, script, outputDir, artifacts)
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(marker)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf(`args: %[1]s %[1]s/image/disk.raw %[1]s/qcow2/disk.qcow2
+outdir: %[1]s
+artifacts: %[1]s/image/disk.raw
+%[1]s/qcow2/disk.qcow2
+`, outputDir), string(content))
+	assert.Equal(t, []string{
+		"Running post-build script " + script,
+		"post-build: signed",
+	}, pbar.msgs)
+}
+
+func TestRunPostBuildFails(t *testing.T) {
+	outputDir, artifacts := makeFakeBuildOutput(t)
+
+	script := filepath.Join(t.TempDir(), "post-build.sh")
+	err := os.WriteFile(script, []byte("#!/bin/sh\necho some-error\nexit 3\n"), 0755)
+	require.NoError(t, err)
+
+	err = main.RunPostBuild(&fakeProgressBar{}, script, outputDir, artifacts)
+	assert.ErrorContains(t, err, fmt.Sprintf("post-build script %s failed: exit status 3\noutput:\nsome-error\n", script))
+}
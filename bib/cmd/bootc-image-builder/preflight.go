@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+
+	"golang.org/x/exp/slices"
+)
+
+// qemuImgExports are the exports that are converted from the raw disk
+// image with qemu-img on the host. Their osbuild qemu pipelines have no
+// build root, so this is not a build root dependency but one of bib
+// itself.
+var qemuImgExports = []string{"qcow2", "vmdk", "vpc", "vhdx"}
+
+// checkQemuImg ensures that qemu-img is available in the PATH of bib if
+// any of the exports needs it for the host-side post-processing,
+// without it the build fails late with a hard to understand error
+func checkQemuImg(exports []string) error {
+	var what string
+	for _, export := range exports {
+		if slices.Contains(qemuImgExports, export) {
+			what = fmt.Sprintf("%q export", export)
+			break
+		}
+	}
+	if what == "" {
+		return nil
+	}
+	if _, err := exec.LookPath("qemu-img"); err != nil {
+		return fmt.Errorf("cannot build the %s: qemu-img is not available on the host, it is needed for the conversion of the raw disk after it is built: install it (e.g. the qemu-img package) or build the raw image type instead", what)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckQemuImgMissing(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	err := checkQemuImg([]string{"image", "qcow2"})
+	assert.EqualError(t, err, `cannot build the "qcow2" export: qemu-img is not available on the host, it is needed for the conversion of the raw disk after it is built: install it (e.g. the qemu-img package) or build the raw image type instead`)
+	err = checkQemuImg([]string{"vpc"})
+	assert.ErrorContains(t, err, `cannot build the "vpc" export: qemu-img is not available`)
+	err = checkQemuImg([]string{"vhdx"})
+	assert.ErrorContains(t, err, `cannot build the "vhdx" export: qemu-img is not available`)
+
+	// raw images and ISOs do not need qemu-img
+	assert.NoError(t, checkQemuImg([]string{"image"}))
+	assert.NoError(t, checkQemuImg([]string{"bootiso"}))
+}
+
+func TestCheckQemuImgAvailable(t *testing.T) {
+	tmpdir := t.TempDir()
+	err := os.WriteFile(filepath.Join(tmpdir, "qemu-img"), []byte("#!/bin/sh\n"), 0755)
+	require.NoError(t, err)
+	t.Setenv("PATH", tmpdir)
+
+	assert.NoError(t, checkQemuImg([]string{"qcow2", "vmdk", "vhdx"}))
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/cobra"
+
+	"github.com/osbuild/bootc-image-builder/bib/internal/buildconfig"
+)
+
+var osStdout io.Writer = os.Stdout
+
+// effectiveConfig is the configuration a build would use, i.e. the
+// build config combined with the relevant commandline options
+type effectiveConfig struct {
+	Imgref       string   `json:"imgref" toml:"imgref"`
+	TargetImgref string   `json:"target_imgref" toml:"target_imgref"`
+	ImageTypes   []string `json:"types" toml:"types"`
+	TargetArch   string   `json:"target_arch,omitempty" toml:"target_arch,omitempty"`
+	Variant      string   `json:"variant,omitempty" toml:"variant,omitempty"`
+	RootFSType   string   `json:"rootfs,omitempty" toml:"rootfs,omitempty"`
+
+	FSLabels map[string]string `json:"fs_labels,omitempty" toml:"fs_labels,omitempty"`
+	FSUUIDs  map[string]string `json:"fs_uuids,omitempty" toml:"fs_uuids,omitempty"`
+
+	Config *buildconfig.BuildConfig `json:"config" toml:"config"`
+}
+
+func effectiveConfigFromCobra(cmd *cobra.Command, args []string) (*effectiveConfig, error) {
+	imgref := args[0]
+	userConfigFile, _ := cmd.Flags().GetString("config")
+	configSha256, _ := cmd.Flags().GetString("config-sha256")
+	imgTypes, _ := cmd.Flags().GetStringArray("type")
+	rootFs, _ := cmd.Flags().GetString("rootfs")
+	targetImgref, _ := cmd.Flags().GetString("target-imgref")
+	fsLabelArgs, _ := cmd.Flags().GetStringArray("fs-label")
+	fsUUIDArgs, _ := cmd.Flags().GetStringArray("fs-uuid")
+	proxy, _ := cmd.Flags().GetString("proxy")
+	noProxy, _ := cmd.Flags().GetString("no-proxy")
+
+	targetArch, variant, err := targetArchAndVariant(cmd.Flags())
+	if err != nil {
+		return nil, err
+	}
+	fsLabels, err := parseFSLabels(fsLabelArgs)
+	if err != nil {
+		return nil, err
+	}
+	fsUUIDs, err := parseFSUUIDs(fsUUIDArgs)
+	if err != nil {
+		return nil, err
+	}
+	cliUser, err := userFromFlags(cmd.Flags())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := proxyEnv(proxy, noProxy); err != nil {
+		return nil, err
+	}
+	config, err := readUserConfig(userConfigFile, configSha256, httpProxy(proxy, noProxy))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config: %w", err)
+	}
+	addUser(config, cliUser)
+	if err := validateUserSSHKeys(config); err != nil {
+		return nil, err
+	}
+	if targetImgref == "" {
+		targetImgref = imgref
+	}
+
+	return &effectiveConfig{
+		Imgref:       imgref,
+		TargetImgref: targetImgref,
+		ImageTypes:   imgTypes,
+		TargetArch:   targetArch,
+		Variant:      variant,
+		RootFSType:   rootFs,
+		FSLabels:     fsLabels,
+		FSUUIDs:      fsUUIDs,
+		Config:       config,
+	}, nil
+}
+
+// printConfig writes the effective configuration in the given format
+// ("json" or "toml") to stdout
+func printConfig(cmd *cobra.Command, args []string, format string) error {
+	cfg, err := effectiveConfigFromCobra(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(osStdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(cfg)
+	case "toml":
+		return toml.NewEncoder(osStdout).Encode(cfg)
+	default:
+		return fmt.Errorf("unsupported config format %q, supported: json, toml", format)
+	}
+}
@@ -0,0 +1,81 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	main "github.com/osbuild/bootc-image-builder/bib/cmd/bootc-image-builder"
+)
+
+func runPrintConfig(t *testing.T, cmdline []string) string {
+	var stdout bytes.Buffer
+	restore := main.MockOsStdout(&stdout)
+	defer restore()
+	restore = mockOsArgs(cmdline)
+	defer restore()
+
+	rootCmd, err := main.BuildCobraCmdline()
+	require.NoError(t, err)
+	require.NoError(t, rootCmd.Execute())
+	return stdout.String()
+}
+
+func TestPrintConfigJSON(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	err := os.WriteFile(configPath, []byte(`[customizations.kernel]
+append = "debug"
+`), 0644)
+	require.NoError(t, err)
+
+	for _, subcmd := range []string{"build", "manifest"} {
+		t.Run(subcmd, func(t *testing.T) {
+			output := runPrintConfig(t, []string{
+				subcmd, "--print-config",
+				"--config", configPath,
+				"--type", "raw",
+				"--rootfs", "xfs",
+				"--target-imgref", "mirror.example.com/os:latest",
+				"quay.io/example/os:latest",
+			})
+
+			var cfg map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(output), &cfg))
+			assert.Equal(t, "quay.io/example/os:latest", cfg["imgref"])
+			assert.Equal(t, "mirror.example.com/os:latest", cfg["target_imgref"])
+			assert.Equal(t, []interface{}{"raw"}, cfg["types"])
+			assert.Equal(t, "xfs", cfg["rootfs"])
+			assert.Equal(t, "debug", cfg["config"].(map[string]interface{})["customizations"].(map[string]interface{})["kernel"].(map[string]interface{})["append"])
+		})
+	}
+}
+
+func TestPrintConfigTOML(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(configPath, []byte(`{"customizations": {"kernel": {"append": "debug"}}}`), 0644)
+	require.NoError(t, err)
+
+	output := runPrintConfig(t, []string{
+		"manifest", "--print-config=toml", "--config", configPath, "quay.io/example/os:latest",
+	})
+	assert.Contains(t, output, `imgref = "quay.io/example/os:latest"`)
+	assert.Contains(t, output, `target_imgref = "quay.io/example/os:latest"`)
+	assert.Contains(t, output, `types = ["qcow2"]`)
+	assert.Contains(t, output, "[config.customizations.kernel]\n")
+	assert.Contains(t, output, `append = "debug"`)
+}
+
+func TestPrintConfigBadFormat(t *testing.T) {
+	restore := mockOsArgs([]string{"manifest", "--print-config=yaml", "quay.io/example/os:latest"})
+	defer restore()
+
+	rootCmd, err := main.BuildCobraCmdline()
+	require.NoError(t, err)
+	err = rootCmd.Execute()
+	assert.EqualError(t, err, `unsupported config format "yaml", supported: json, toml`)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/osbuild/images/pkg/osbuild"
+
+	"github.com/osbuild/bootc-image-builder/bib/internal/util"
+)
+
+const (
+	inTotoStatementType = "https://in-toto.io/Statement/v1"
+	slsaProvenanceType  = "https://slsa.dev/provenance/v1"
+	bibBuildType        = "https://github.com/osbuild/bootc-image-builder/build@v1"
+	bibBuilderID        = "https://github.com/osbuild/bootc-image-builder"
+)
+
+// provenanceStatement is an in-toto statement with a SLSA provenance
+// predicate, see https://slsa.dev/spec/v1.0/provenance
+type provenanceStatement struct {
+	Type          string               `json:"_type"`
+	Subject       []resourceDescriptor `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     provenancePredicate  `json:"predicate"`
+}
+
+type resourceDescriptor struct {
+	Name        string            `json:"name,omitempty"`
+	Digest      map[string]string `json:"digest"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type provenancePredicate struct {
+	BuildDefinition struct {
+		BuildType            string               `json:"buildType"`
+		ExternalParameters   map[string]string    `json:"externalParameters"`
+		ResolvedDependencies []resourceDescriptor `json:"resolvedDependencies"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID      string            `json:"id"`
+			Version map[string]string `json:"version"`
+		} `json:"builder"`
+		Metadata struct {
+			StartedOn  time.Time `json:"startedOn"`
+			FinishedOn time.Time `json:"finishedOn"`
+		} `json:"metadata"`
+	} `json:"runDetails"`
+}
+
+// osbuildVersion returns the version of the osbuild that runs the
+// build, "unknown" is returned if it cannot be determined
+var osbuildVersion = func() string {
+	output, err := exec.Command("osbuild", "--version").Output()
+	if err != nil {
+		logrus.Warnf("cannot get osbuild version: %v", util.OutputErr(err))
+		return "unknown"
+	}
+	// e.g. "osbuild 130"
+	return strings.TrimSpace(strings.TrimPrefix(string(output), "osbuild "))
+}
+
+// getContainerDigest returns the digest of the container image, the
+// manifest only references local containers by their image id
+func getContainerDigest(imgref string) (string, error) {
+	output, err := exec.Command("podman", "image", "inspect", imgref, "--format", "{{.Digest}}").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed inspect image: %w", util.OutputErr(err))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// digestSet converts an "ALGO:HEX" digest into an in-toto digest set
+func digestSet(digest string) (map[string]string, error) {
+	algo, hex, ok := strings.Cut(digest, ":")
+	if !ok || algo == "" || hex == "" {
+		return nil, fmt.Errorf("invalid digest %q", digest)
+	}
+	return map[string]string{algo: hex}, nil
+}
+
+func fileSha256(fpath string) (string, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// manifestSources returns the image ids of the containers and a hash
+// over the package sources of the manifest, the latter identifies the
+// exact set of depsolved packages
+func manifestSources(mf []byte) (imageIDs []string, packagesHash string, err error) {
+	var m struct {
+		Sources map[string]json.RawMessage `json:"sources"`
+	}
+	if err := json.Unmarshal(mf, &m); err != nil {
+		return nil, "", fmt.Errorf("cannot parse manifest: %w", err)
+	}
+	for _, name := range []string{osbuild.SourceNameContainersStorage, osbuild.SourceNameSkopeo} {
+		var src struct {
+			Items map[string]json.RawMessage `json:"items"`
+		}
+		if data, ok := m.Sources[name]; ok {
+			if err := json.Unmarshal(data, &src); err != nil {
+				return nil, "", fmt.Errorf("cannot parse manifest source %s: %w", name, err)
+			}
+		}
+		for id := range src.Items {
+			imageIDs = append(imageIDs, id)
+		}
+	}
+
+	sort.Strings(imageIDs)
+
+	h := sha256.New()
+	for _, name := range []string{"org.osbuild.curl", "org.osbuild.librepo"} {
+		h.Write(m.Sources[name])
+	}
+	return imageIDs, fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// provenanceParameters returns the image reference and all command
+// line options that were set for the build, the credentials of a
+// --config URL are redacted
+func provenanceParameters(cmd *cobra.Command, imgref string) map[string]string {
+	params := map[string]string{"imgref": imgref}
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		params[f.Name] = f.Value.String()
+	})
+	if config := params["config"]; isConfigURL(config) {
+		if u, err := url.Parse(config); err == nil {
+			params["config"] = u.Redacted()
+		} else {
+			params["config"] = "<invalid url>"
+		}
+	}
+	return params
+}
+
+// newProvenance creates the provenance statement for the given build
+// result, the build parameters are the command line options that were
+// set for the build
+func newProvenance(res *buildResult, outputDir, containerDigest string, mf []byte, params map[string]string, startedOn time.Time) (*provenanceStatement, error) {
+	version, err := versionFromBuildInfo()
+	if err != nil {
+		return nil, err
+	}
+	imageIDs, packagesHash, err := manifestSources(mf)
+	if err != nil {
+		return nil, err
+	}
+	cntDigest, err := digestSet(containerDigest)
+	if err != nil {
+		return nil, fmt.Errorf("cannot use container digest: %w", err)
+	}
+
+	st := &provenanceStatement{
+		Type:          inTotoStatementType,
+		Subject:       make([]resourceDescriptor, 0, len(res.Artifacts)),
+		PredicateType: slsaProvenanceType,
+	}
+	for _, artifact := range res.Artifacts {
+		sum, err := fileSha256(filepath.Join(outputDir, artifact))
+		if err != nil {
+			return nil, fmt.Errorf("cannot hash artifact %q: %w", artifact, err)
+		}
+		st.Subject = append(st.Subject, resourceDescriptor{
+			Name:   artifact,
+			Digest: map[string]string{"sha256": sum},
+		})
+	}
+
+	bd := &st.Predicate.BuildDefinition
+	bd.BuildType = bibBuildType
+	bd.ExternalParameters = params
+	container := resourceDescriptor{
+		Name:   res.Imgref,
+		Digest: cntDigest,
+	}
+	if len(imageIDs) > 0 {
+		container.Annotations = map[string]string{"image-id": strings.Join(imageIDs, ",")}
+	}
+	bd.ResolvedDependencies = []resourceDescriptor{
+		container,
+		{
+			Name:   "packages",
+			Digest: map[string]string{"sha256": packagesHash},
+		},
+	}
+	if res.InputHash != "" {
+		inputs, err := digestSet(res.InputHash)
+		if err != nil {
+			return nil, err
+		}
+		bd.ResolvedDependencies = append(bd.ResolvedDependencies, resourceDescriptor{
+			Name:   "inputs",
+			Digest: inputs,
+		})
+	}
+
+	rd := &st.Predicate.RunDetails
+	rd.Builder.ID = bibBuilderID
+	rd.Builder.Version = map[string]string{
+		"bootc-image-builder": strings.TrimSpace(version),
+		"osbuild":             osbuildVersion(),
+	}
+	rd.Metadata.StartedOn = startedOn.UTC()
+	rd.Metadata.FinishedOn = time.Now().UTC()
+	return st, nil
+}
+
+// writeProvenance writes the provenance statement of the build to fpath
+func writeProvenance(fpath string, res *buildResult, outputDir, containerDigest string, mf []byte, params map[string]string, startedOn time.Time) error {
+	st, err := newProvenance(res, outputDir, containerDigest, mf, params, startedOn)
+	if err != nil {
+		return fmt.Errorf("cannot create provenance: %w", err)
+	}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(fpath, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("cannot write provenance %q: %w", fpath, err)
+	}
+	return nil
+}
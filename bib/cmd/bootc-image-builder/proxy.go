@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// proxyEnv returns the proxy environment for the --proxy and --no-proxy
+// options or nil if no --proxy was given
+func proxyEnv(proxy, noProxy string) ([]string, error) {
+	if proxy == "" {
+		if noProxy != "" {
+			return nil, errors.New("--no-proxy requires --proxy")
+		}
+		return nil, nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url %q: %w", proxy, err)
+	}
+	switch {
+	case u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5":
+		return nil, fmt.Errorf("invalid proxy url %q, expected a http, https or socks5 url", proxy)
+	case u.Host == "":
+		return nil, fmt.Errorf("invalid proxy url %q: missing host", proxy)
+	}
+
+	var env []string
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY"} {
+		env = append(env, name+"="+proxy, strings.ToLower(name)+"="+proxy)
+	}
+	if noProxy != "" {
+		env = append(env, "NO_PROXY="+noProxy, "no_proxy="+noProxy)
+	}
+	return env, nil
+}
+
+// httpProxy returns the proxy function for the http requests of bib
+// itself (e.g. a --config URL) for the --proxy and --no-proxy options,
+// they are made before setupProxy runs. Without --proxy it returns nil
+// and the proxy environment is used.
+func httpProxy(proxy, noProxy string) func(*http.Request) (*url.URL, error) {
+	if proxy == "" {
+		return nil
+	}
+	cfg := &httpproxy.Config{HTTPProxy: proxy, HTTPSProxy: proxy, NoProxy: noProxy}
+	proxyFunc := cfg.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+}
+
+// setupProxy sets the given proxy environment (see proxyEnv) for the
+// bib process. The podman calls, the container resolver and osbuild
+// (including its curl sources) all inherit it.
+func setupProxy(env []string) error {
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		if err := os.Setenv(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/bootc-image-builder/bib/pkg/progress"
+)
+
+func TestProxyEnv(t *testing.T) {
+	env, err := proxyEnv("", "")
+	require.NoError(t, err)
+	assert.Nil(t, env)
+
+	env, err = proxyEnv("http://proxy.example.com:3128", "localhost,.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"HTTP_PROXY=http://proxy.example.com:3128",
+		"http_proxy=http://proxy.example.com:3128",
+		"HTTPS_PROXY=http://proxy.example.com:3128",
+		"https_proxy=http://proxy.example.com:3128",
+		"NO_PROXY=localhost,.example.com",
+		"no_proxy=localhost,.example.com",
+	}, env)
+
+	for _, tc := range []struct {
+		proxy, noProxy string
+		expErr         string
+	}{
+		{"", "localhost", "--no-proxy requires --proxy"},
+		{"proxy.example.com:3128", "", `invalid proxy url "proxy.example.com:3128", expected a http, https or socks5 url`},
+		{"ftp://proxy.example.com", "", `invalid proxy url "ftp://proxy.example.com", expected a http, https or socks5 url`},
+		{"http://", "", `invalid proxy url "http://": missing host`},
+		{"http://proxy:port", "", `invalid proxy url "http://proxy:port": parse "http://proxy:port": invalid port ":port" after host`},
+	} {
+		_, err := proxyEnv(tc.proxy, tc.noProxy)
+		assert.EqualError(t, err, tc.expErr)
+	}
+}
+
+func TestSetupProxyReachesOsbuild(t *testing.T) {
+	// restore the environment after the test
+	for _, name := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy", "NO_PROXY", "no_proxy"} {
+		t.Setenv(name, "")
+	}
+
+	proxyVars, err := proxyEnv("http://proxy.example.com:3128", "localhost")
+	require.NoError(t, err)
+	require.NoError(t, setupProxy(proxyVars))
+
+	tmpdir := t.TempDir()
+	envFile := filepath.Join(tmpdir, "env")
+	err = os.WriteFile(filepath.Join(tmpdir, "osbuild"), []byte(fmt.Sprintf("#!/bin/sh\ncat > /dev/null\nenv > %s\n", envFile)), 0755)
+	require.NoError(t, err)
+	t.Setenv("PATH", tmpdir+":"+os.Getenv("PATH"))
+
+	pbar, err := progress.New("debug")
+	require.NoError(t, err)
+	err = progress.RunOSBuild(pbar, []byte(`{"fake":"manifest"}`), "", "", nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	env, err := os.ReadFile(envFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(env), "HTTPS_PROXY=http://proxy.example.com:3128\n")
+	assert.Contains(t, string(env), "https_proxy=http://proxy.example.com:3128\n")
+	assert.Contains(t, string(env), "NO_PROXY=localhost\n")
+}
+
+func TestManifestOptionsFromCobraDoesNotSetProxy(t *testing.T) {
+	t.Setenv("HTTPS_PROXY", "")
+	savedArgs := os.Args
+	os.Args = []string{"argv0", "manifest"}
+	defer func() { os.Args = savedArgs }()
+
+	rootCmd, err := buildCobraCmdline()
+	require.NoError(t, err)
+	manifestCmd, _, err := rootCmd.Find([]string{"manifest"})
+	require.NoError(t, err)
+	require.NoError(t, manifestCmd.ParseFlags([]string{"--proxy", "http://proxy.example.com:3128"}))
+
+	opts, err := manifestOptionsFromCobra(manifestCmd, []string{"quay.io/example/example:latest"})
+	require.NoError(t, err)
+	assert.Contains(t, opts.ProxyEnv, "HTTPS_PROXY=http://proxy.example.com:3128")
+	// parsing the options does not change the environment, only
+	// generateManifest applies the proxy
+	assert.Equal(t, "", os.Getenv("HTTPS_PROXY"))
+}
+
+func TestHTTPProxy(t *testing.T) {
+	assert.Nil(t, httpProxy("", ""))
+
+	proxy := httpProxy("http://proxy.example.com:3128", "internal.example.com")
+	req := httptest.NewRequest("GET", "https://registry.example.com/config.json", nil)
+	u, err := proxy(req)
+	require.NoError(t, err)
+	assert.Equal(t, "http://proxy.example.com:3128", u.String())
+
+	req = httptest.NewRequest("GET", "https://internal.example.com/config.json", nil)
+	u, err = proxy(req)
+	require.NoError(t, err)
+	assert.Nil(t, u)
+}
+
+func TestReadUserConfigURLUsesProxy(t *testing.T) {
+	var requested string
+	proxySrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+		_, _ = w.Write([]byte(fakeRemoteConfig))
+	}))
+	defer proxySrv.Close()
+
+	conf, err := readUserConfig("http://config.example.com/config.json", "", httpProxy(proxySrv.URL, ""))
+	require.NoError(t, err)
+	require.Len(t, conf.Customizations.User, 1)
+	assert.Equal(t, "http://config.example.com/config.json", requested)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/osbuild/images/pkg/datasizes"
+
+	"github.com/osbuild/bootc-image-builder/bib/internal/buildconfig"
+)
+
+// configFetchTimeout limits the download of a --config URL, it is only
+// overriden in tests
+var configFetchTimeout = 60 * time.Second
+
+// maxConfigSize limits the size of a downloaded --config, a build
+// config is a few KiB at most
+const maxConfigSize = 1 * datasizes.MiB
+
+// urlErrorCause returns the cause of an *url.Error, the error itself
+// contains the full URL which may have credentials in it
+func urlErrorCause(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// isConfigURL returns true if the --config argument is a http(s) URL
+func isConfigURL(config string) bool {
+	return strings.HasPrefix(config, "http://") || strings.HasPrefix(config, "https://")
+}
+
+// configExtFromURL infers the config format of a downloaded config from
+// the extension of the URL path or from the Content-Type of the response
+func configExtFromURL(u *url.URL, contentType string) (string, error) {
+	switch ext := path.Ext(u.Path); ext {
+	case ".json", ".toml":
+		return ext, nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/json":
+		return ".json", nil
+	case "application/toml", "text/toml", "text/x-toml":
+		return ".toml", nil
+	}
+	return "", fmt.Errorf("cannot infer the format of the config %q from its extension or content type %q", u.Redacted(), contentType)
+}
+
+// downloadConfig downloads the config at the given URL to a file in
+// dir and returns its path, if expectedSha256 is set the checksum of
+// the content must match it. A nil proxy uses the proxy environment.
+func downloadConfig(configURL, expectedSha256, dir string, proxy func(*http.Request) (*url.URL, error)) (string, error) {
+	u, err := url.Parse(configURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid config url: %w", urlErrorCause(err))
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != nil {
+		transport.Proxy = proxy
+	}
+	client := &http.Client{Timeout: configFetchTimeout, Transport: transport}
+	resp, err := client.Get(configURL)
+	if err != nil {
+		return "", fmt.Errorf("cannot download config %q: %w", u.Redacted(), urlErrorCause(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cannot download config %q: %s", u.Redacted(), resp.Status)
+	}
+	ext, err := configExtFromURL(u, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return "", err
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxConfigSize)+1))
+	if err != nil {
+		return "", fmt.Errorf("cannot download config %q: %w", u.Redacted(), urlErrorCause(err))
+	}
+	if uint64(len(content)) > maxConfigSize {
+		return "", fmt.Errorf("cannot download config %q: larger than %d bytes", u.Redacted(), maxConfigSize)
+	}
+	if expectedSha256 != "" {
+		sum := sha256.Sum256(content)
+		if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, expectedSha256) {
+			return "", fmt.Errorf("checksum mismatch for config %q: expected sha256 %s, got %s", u.Redacted(), expectedSha256, got)
+		}
+	}
+
+	configPath := filepath.Join(dir, "config"+ext)
+	if err := os.WriteFile(configPath, content, 0600); err != nil {
+		return "", err
+	}
+	return configPath, nil
+}
+
+// readUserConfig reads the --config, a http(s) URL is downloaded to a
+// temporary file first (through the given proxy, see httpProxy)
+func readUserConfig(userConfig, configSha256 string, proxy func(*http.Request) (*url.URL, error)) (*buildconfig.BuildConfig, error) {
+	if !isConfigURL(userConfig) {
+		if configSha256 != "" {
+			return nil, errors.New("--config-sha256 requires a http(s) --config url")
+		}
+		return buildconfig.ReadWithFallback(userConfig)
+	}
+
+	tmpdir, err := os.MkdirTemp("", "bib-config-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpdir)
+
+	configPath, err := downloadConfig(userConfig, configSha256, tmpdir, proxy)
+	if err != nil {
+		return nil, err
+	}
+	return buildconfig.ReadWithFallback(configPath)
+}
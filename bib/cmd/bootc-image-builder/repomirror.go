@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/osbuild/images/pkg/dnfjson"
+)
+
+// parseRepoMirrors parses the "from=to" --repo-mirror arguments into a
+// map of url prefixes and their replacements.
+func parseRepoMirrors(args []string) (map[string]string, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	mirrors := make(map[string]string, len(args))
+	for _, arg := range args {
+		from, to, ok := strings.Cut(arg, "=")
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("invalid repo mirror %q, expected from=to", arg)
+		}
+		if _, ok := mirrors[from]; ok {
+			return nil, fmt.Errorf("repo mirror for %q given multiple times", from)
+		}
+		mirrors[from] = to
+	}
+	return mirrors, nil
+}
+
+// mirrorURL rewrites the given url using the longest matching prefix
+// from mirrors
+func mirrorURL(url string, mirrors map[string]string) string {
+	var bestFrom string
+	for from := range mirrors {
+		if strings.HasPrefix(url, from) && len(from) > len(bestFrom) {
+			bestFrom = from
+		}
+	}
+	if bestFrom == "" {
+		return url
+	}
+	return mirrors[bestFrom] + strings.TrimPrefix(url, bestFrom)
+}
+
+// applyRepoMirrors rewrites the base URLs of the depsolved repositories
+// and the download locations of the depsolved packages. Everything else
+// (like the TLS client keys) is left untouched.
+func applyRepoMirrors(res *dnfjson.DepsolveResult, mirrors map[string]string) {
+	if len(mirrors) == 0 {
+		return
+	}
+	for i := range res.Repos {
+		repo := &res.Repos[i]
+		baseURLs := make([]string, 0, len(repo.BaseURLs))
+		for _, url := range repo.BaseURLs {
+			baseURLs = append(baseURLs, mirrorURL(url, mirrors))
+		}
+		repo.BaseURLs = baseURLs
+	}
+	for i := range res.Packages {
+		pkg := &res.Packages[i]
+		pkg.RemoteLocation = mirrorURL(pkg.RemoteLocation, mirrors)
+	}
+}
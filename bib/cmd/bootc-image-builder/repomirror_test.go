@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/osbuild/images/pkg/dnfjson"
+	"github.com/osbuild/images/pkg/rpmmd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRepoMirrors(t *testing.T) {
+	mirrors, err := parseRepoMirrors(nil)
+	require.NoError(t, err)
+	assert.Nil(t, mirrors)
+
+	mirrors, err = parseRepoMirrors([]string{
+		"https://cdn.redhat.com/=https://satellite.example.com/pulp/",
+		"https://cdn.redhat.com/content/dist/=https://mirror.example.com/dist/",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"https://cdn.redhat.com/":              "https://satellite.example.com/pulp/",
+		"https://cdn.redhat.com/content/dist/": "https://mirror.example.com/dist/",
+	}, mirrors)
+
+	for _, bad := range []string{"no-equal-sign", "=https://to", "https://from="} {
+		_, err := parseRepoMirrors([]string{bad})
+		assert.EqualError(t, err, `invalid repo mirror "`+bad+`", expected from=to`)
+	}
+	_, err = parseRepoMirrors([]string{"https://a=https://b", "https://a=https://c"})
+	assert.EqualError(t, err, `repo mirror for "https://a" given multiple times`)
+}
+
+func TestApplyRepoMirrorsKeepsTLS(t *testing.T) {
+	res := &dnfjson.DepsolveResult{
+		Repos: []rpmmd.RepoConfig{
+			{
+				Id:            "baseos",
+				BaseURLs:      []string{"https://cdn.redhat.com/content/dist/rhel9/baseos", "https://other.example.com/baseos"},
+				SSLCACert:     "/ca",
+				SSLClientCert: "/cert",
+				SSLClientKey:  "/key",
+			},
+		},
+		Packages: []rpmmd.PackageSpec{
+			{Name: "pkg1", RemoteLocation: "https://cdn.redhat.com/content/dist/rhel9/baseos/Packages/pkg1.rpm"},
+			{Name: "pkg2", RemoteLocation: "https://cdn.redhat.com/other/pkg2.rpm"},
+		},
+	}
+	mirrors := map[string]string{
+		"https://cdn.redhat.com/":              "https://satellite.example.com/",
+		"https://cdn.redhat.com/content/dist/": "https://mirror.example.com/dist/",
+	}
+
+	applyRepoMirrors(res, mirrors)
+	assert.Equal(t, []string{"https://mirror.example.com/dist/rhel9/baseos", "https://other.example.com/baseos"}, res.Repos[0].BaseURLs)
+	assert.Equal(t, "https://mirror.example.com/dist/rhel9/baseos/Packages/pkg1.rpm", res.Packages[0].RemoteLocation)
+	assert.Equal(t, "https://satellite.example.com/other/pkg2.rpm", res.Packages[1].RemoteLocation)
+
+	fakeReader := &fakeFileReader{}
+	mTLS, err := extractTLSKeys(fakeReader, map[string][]rpmmd.RepoConfig{"build": res.Repos})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/key", "/cert", "/ca"}, fakeReader.readPaths)
+	assert.Equal(t, []byte("content of /key"), mTLS.key)
+}
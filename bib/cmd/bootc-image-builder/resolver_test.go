@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/container"
+)
+
+func TestValidateResolveConcurrency(t *testing.T) {
+	for _, good := range []int{0, 1, 4, 32} {
+		assert.NoError(t, validateResolveConcurrency(good))
+	}
+	for _, bad := range []int{-1, 33} {
+		assert.EqualError(t, validateResolveConcurrency(bad), fmt.Sprintf("invalid resolve concurrency %d, must be between 0 (no limit) and 32", bad))
+	}
+}
+
+func TestNewContainerResolverConcurrency(t *testing.T) {
+	assert.IsType(t, &container.Resolver{}, newContainerResolver(arch.ARCH_X86_64, "", "", 0))
+
+	resolver := newContainerResolver(arch.ARCH_X86_64, "", "", 3)
+	require.IsType(t, &variantResolver{}, resolver)
+	assert.Equal(t, 3, cap(resolver.(*variantResolver).sem))
+}
+
+func TestVariantResolverConcurrency(t *testing.T) {
+	for _, concurrency := range []int{0, 1, 3} {
+		t.Run(fmt.Sprintf("concurrency=%d", concurrency), func(t *testing.T) {
+			var running, maxRunning int32
+			resolver := newVariantResolver("x86_64", "", "", concurrency)
+			resolver.resolve = func(src container.SourceSpec) (container.Spec, error) {
+				n := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				for {
+					max := atomic.LoadInt32(&maxRunning)
+					if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				return container.Spec{Source: src.Source, Arch: arch.ARCH_X86_64}, nil
+			}
+
+			var expected []string
+			for i := 0; i < 8; i++ {
+				src := fmt.Sprintf("registry.example.com/img%d", i)
+				resolver.Add(container.SourceSpec{Source: src})
+				expected = append(expected, src)
+			}
+			specs, err := resolver.Finish()
+			require.NoError(t, err)
+
+			var got []string
+			for _, spec := range specs {
+				got = append(got, spec.Source)
+			}
+			// all containers are resolved, in the order they were added
+			assert.Equal(t, expected, got)
+			if concurrency > 0 {
+				assert.LessOrEqual(t, atomic.LoadInt32(&maxRunning), int32(concurrency))
+			}
+			assert.GreaterOrEqual(t, atomic.LoadInt32(&maxRunning), int32(1))
+		})
+	}
+}
+
+func TestVariantResolverErrors(t *testing.T) {
+	resolver := newVariantResolver("x86_64", "", "", 2)
+	resolver.resolve = func(src container.SourceSpec) (container.Spec, error) {
+		if src.Source == "bad" {
+			return container.Spec{}, fmt.Errorf("'%s': not found", src.Source)
+		}
+		return container.Spec{Source: src.Source}, nil
+	}
+	resolver.Add(container.SourceSpec{Source: "good"})
+	resolver.Add(container.SourceSpec{Source: "bad"})
+
+	specs, err := resolver.Finish()
+	assert.EqualError(t, err, "failed to resolve container: 'bad': not found")
+	require.Len(t, specs, 1)
+	assert.Equal(t, "good", specs[0].Source)
+
+	// the resolver can be reused after Finish()
+	resolver.Add(container.SourceSpec{Source: "good"})
+	specs, err = resolver.Finish()
+	require.NoError(t, err)
+	assert.Len(t, specs, 1)
+}
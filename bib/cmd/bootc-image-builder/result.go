@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// buildResultFilename is the name of the build result summary in the
+// output directory
+const buildResultFilename = "build-result.json"
+
+var annotationKeyRE = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+
+// parseAnnotations parses the "KEY=VALUE" --annotation arguments
+func parseAnnotations(args []string) (map[string]string, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	annotations := make(map[string]string, len(args))
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || !annotationKeyRE.MatchString(key) {
+			return nil, fmt.Errorf("invalid annotation %q, expected KEY=VALUE", arg)
+		}
+		if _, ok := annotations[key]; ok {
+			return nil, fmt.Errorf("annotation %q given multiple times", key)
+		}
+		annotations[key] = value
+	}
+	return annotations, nil
+}
+
+// buildResult is the summary of a successful build that is written
+// into the output directory
+type buildResult struct {
+	Imgref     string   `json:"imgref"`
+	ImageTypes []string `json:"types"`
+	// Artifacts relative to the output directory
+	Artifacts   []string          `json:"artifacts"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Warnings that were shown during the build
+	Warnings []string `json:"warnings,omitempty"`
+	// Hash of the resolved build inputs, see inputHash()
+	InputHash string `json:"input-hash,omitempty"`
+	// The verified --ostree-commit of the container
+	OstreeCommit string `json:"ostree-commit,omitempty"`
+}
+
+// writeBuildResult writes the build result summary for the given
+// artifacts into the output directory
+func writeBuildResult(outputDir, imgref string, imgTypes, artifacts []string, annotations map[string]string, inputHash, ostreeCommit string) (*buildResult, error) {
+	res := buildResult{
+		Imgref:       imgref,
+		ImageTypes:   imgTypes,
+		Artifacts:    make([]string, 0, len(artifacts)),
+		Annotations:  annotations,
+		Warnings:     warnings.Warnings(),
+		InputHash:    inputHash,
+		OstreeCommit: ostreeCommit,
+	}
+	for _, artifact := range artifacts {
+		rel, err := filepath.Rel(outputDir, artifact)
+		if err != nil {
+			return nil, err
+		}
+		res.Artifacts = append(res.Artifacts, rel)
+	}
+
+	data, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	fpath := filepath.Join(outputDir, buildResultFilename)
+	if err := os.WriteFile(fpath, append(data, '\n'), 0o644); err != nil {
+		return nil, fmt.Errorf("cannot write build result %q: %w", fpath, err)
+	}
+	return &res, nil
+}
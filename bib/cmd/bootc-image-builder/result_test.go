@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAnnotations(t *testing.T) {
+	annotations, err := parseAnnotations(nil)
+	require.NoError(t, err)
+	assert.Nil(t, annotations)
+
+	annotations, err = parseAnnotations([]string{"org.opencontainers.image.source=https://example.com/os", "build-id=42", "empty="})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"org.opencontainers.image.source": "https://example.com/os",
+		"build-id":                        "42",
+		"empty":                           "",
+	}, annotations)
+
+	for _, bad := range []string{"no-equal-sign", "=value", "with space=value", ".hidden=value"} {
+		_, err := parseAnnotations([]string{bad})
+		assert.EqualError(t, err, `invalid annotation "`+bad+`", expected KEY=VALUE`)
+	}
+	_, err = parseAnnotations([]string{"a=1", "a=2"})
+	assert.EqualError(t, err, `annotation "a" given multiple times`)
+}
+
+func TestWriteBuildResult(t *testing.T) {
+	outputDir := t.TempDir()
+	artifacts := []string{
+		filepath.Join(outputDir, "image/disk.raw"),
+		filepath.Join(outputDir, "qcow2/disk.qcow2"),
+	}
+	annotations := map[string]string{"build-id": "42"}
+
+	res, err := writeBuildResult(outputDir, "quay.io/example/os:latest", []string{"qcow2", "raw"}, artifacts, annotations, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"image/disk.raw", "qcow2/disk.qcow2"}, res.Artifacts)
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "build-result.json"))
+	require.NoError(t, err)
+	var written map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &written))
+	assert.Equal(t, map[string]interface{}{
+		"imgref":      "quay.io/example/os:latest",
+		"types":       []interface{}{"qcow2", "raw"},
+		"artifacts":   []interface{}{"image/disk.raw", "qcow2/disk.qcow2"},
+		"annotations": map[string]interface{}{"build-id": "42"},
+	}, written)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+// rpmDownloaders maps the --rpm-downloader names to the osbuild
+// source that downloads the rpms
+var rpmDownloaders = map[string]osbuild.RpmDownloader{
+	"curl":    osbuild.RpmDownloaderCurl,
+	"librepo": osbuild.RpmDownloaderLibrepo,
+}
+
+func parseRpmDownloader(s string) (osbuild.RpmDownloader, error) {
+	downloader, ok := rpmDownloaders[s]
+	if !ok {
+		names := make([]string, 0, len(rpmDownloaders))
+		for name := range rpmDownloaders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return 0, fmt.Errorf("invalid rpm downloader %q, must be one of: %s", s, strings.Join(names, ", "))
+	}
+	return downloader, nil
+}
+
+// rpmDownloaderFromFlags returns the rpm downloader of the
+// --rpm-downloader option, the deprecated --use-librepo is still
+// supported as an alias for --rpm-downloader=librepo
+func rpmDownloaderFromFlags(flags *pflag.FlagSet) (osbuild.RpmDownloader, error) {
+	name, err := flags.GetString("rpm-downloader")
+	if err != nil {
+		return 0, err
+	}
+	downloader, err := parseRpmDownloader(name)
+	if err != nil {
+		return 0, err
+	}
+	if flags.Changed("use-librepo") {
+		useLibrepo, err := flags.GetBool("use-librepo")
+		if err != nil {
+			return 0, err
+		}
+		if flags.Changed("rpm-downloader") {
+			return 0, fmt.Errorf("cannot use --use-librepo together with --rpm-downloader")
+		}
+		if useLibrepo {
+			downloader = osbuild.RpmDownloaderLibrepo
+		}
+	}
+	return downloader, nil
+}
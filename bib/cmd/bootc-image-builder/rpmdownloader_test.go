@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+func TestParseRpmDownloader(t *testing.T) {
+	downloader, err := parseRpmDownloader("curl")
+	require.NoError(t, err)
+	assert.EqualValues(t, osbuild.RpmDownloaderCurl, downloader)
+
+	downloader, err = parseRpmDownloader("librepo")
+	require.NoError(t, err)
+	assert.EqualValues(t, osbuild.RpmDownloaderLibrepo, downloader)
+
+	_, err = parseRpmDownloader("wget")
+	assert.EqualError(t, err, `invalid rpm downloader "wget", must be one of: curl, librepo`)
+}
+
+func TestRpmDownloaderFromFlags(t *testing.T) {
+	for _, tc := range []struct {
+		args        []string
+		expected    int
+		expectedErr string
+	}{
+		{nil, osbuild.RpmDownloaderCurl, ""},
+		{[]string{"--rpm-downloader=librepo"}, osbuild.RpmDownloaderLibrepo, ""},
+		{[]string{"--rpm-downloader=curl"}, osbuild.RpmDownloaderCurl, ""},
+		{[]string{"--use-librepo"}, osbuild.RpmDownloaderLibrepo, ""},
+		{[]string{"--use-librepo=false"}, osbuild.RpmDownloaderCurl, ""},
+		{[]string{"--rpm-downloader=foo"}, 0, `invalid rpm downloader "foo", must be one of: curl, librepo`},
+		{[]string{"--use-librepo", "--rpm-downloader=curl"}, 0, "cannot use --use-librepo together with --rpm-downloader"},
+	} {
+		flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		flags.String("rpm-downloader", "curl", "")
+		flags.Bool("use-librepo", false, "")
+		require.NoError(t, flags.Parse(tc.args))
+
+		downloader, err := rpmDownloaderFromFlags(flags)
+		if tc.expectedErr != "" {
+			assert.EqualError(t, err, tc.expectedErr, tc.args)
+		} else {
+			assert.NoError(t, err, tc.args)
+			assert.EqualValues(t, tc.expected, downloader, tc.args)
+		}
+	}
+}
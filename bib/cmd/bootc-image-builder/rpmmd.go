@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/osbuild/images/pkg/dnfjson"
+	"github.com/sirupsen/logrus"
+)
+
+// refreshRpmmdCache removes the cached repository metadata of the
+// solver so that it is downloaded again. Only the directory of the
+// solver's distro is removed, caches of other distros in the same
+// --rpmmd directory are kept.
+func refreshRpmmdCache(solver *dnfjson.Solver) error {
+	cacheDir := solver.GetCacheDir()
+	logrus.Infof("removing rpm metadata cache %s", cacheDir)
+	if err := os.RemoveAll(cacheDir); err != nil {
+		return fmt.Errorf("cannot refresh rpm metadata cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/osbuild/images/pkg/dnfjson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshRpmmdCache(t *testing.T) {
+	cacheRoot := t.TempDir()
+	solver := dnfjson.NewSolver("platform:f40", "40", "x86_64", "fedora-40", cacheRoot)
+	cacheDir := solver.GetCacheDir()
+	assert.Equal(t, cacheRoot, filepath.Dir(cacheDir))
+	require.NoError(t, os.MkdirAll(filepath.Join(cacheDir, "fedora-abc", "repodata"), 0755))
+	otherDistro := filepath.Join(cacheRoot, "platform:el9-9-x86_64")
+	require.NoError(t, os.MkdirAll(otherDistro, 0755))
+
+	err := refreshRpmmdCache(solver)
+	require.NoError(t, err)
+	assert.NoDirExists(t, cacheDir)
+	assert.DirExists(t, otherDistro)
+
+	// refreshing an empty cache is fine
+	assert.NoError(t, refreshRpmmdCache(solver))
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/osbuild/bootc-image-builder/bib/internal/util"
+)
+
+// network filesystem magics from statfs(2)
+var networkFSMagics = map[int64]string{
+	0x6969:     "nfs",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x517b:     "smb",
+	0x00c36400: "ceph",
+	0x01021997: "9p",
+	0x5346414f: "afs",
+	0x47504653: "gpfs",
+}
+
+var scratchOutputModes = []string{"auto", "always", "never"}
+
+// statfsType is only overriden in tests
+var statfsType = func(path string) (int64, error) {
+	var buf unix.Statfs_t
+	if err := unix.Statfs(path, &buf); err != nil {
+		return 0, err
+	}
+	return int64(buf.Type), nil
+}
+
+// osRename is only overriden in tests
+var osRename = os.Rename
+
+// useScratchOutput returns true if osbuild should write the artifacts
+// to a local scratch directory instead of the output directory for the
+// given --scratch-output mode. In "auto" mode this is done for output
+// directories on network filesystems.
+func useScratchOutput(mode, outputDir string) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		fsType, err := statfsType(outputDir)
+		if err != nil {
+			return false, fmt.Errorf("cannot detect the filesystem of %q: %w", outputDir, err)
+		}
+		_, ok := networkFSMagics[fsType]
+		return ok, nil
+	default:
+		return false, fmt.Errorf("invalid scratch output mode %q, must be one of %v", mode, scratchOutputModes)
+	}
+}
+
+// copyTree copies src to dst (which must not exist), cp keeps the
+// disk images sparse. It is only overriden in tests.
+var copyTree = func(src, dst string) error {
+	if _, err := exec.Command("cp", "-a", "--sparse=auto", src, dst).Output(); err != nil {
+		return util.OutputErr(err)
+	}
+	return nil
+}
+
+// moveTree moves src to dst (which must not exist), it falls back to
+// a copy if they are on different filesystems
+func moveTree(src, dst string) error {
+	err := osRename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err := copyTree(src, dst); err != nil {
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// moveArtifacts moves the osbuild exports from the scratch directory
+// to the output directory, an existing export directory of an earlier
+// build is replaced. Each export is moved to a temporary name first so
+// that a failed move (e.g. a full disk) keeps the earlier artifacts.
+func moveArtifacts(scratchDir, outputDir string) error {
+	entries, err := os.ReadDir(scratchDir)
+	if err != nil {
+		return err
+	}
+	for _, ent := range entries {
+		src := filepath.Join(scratchDir, ent.Name())
+		dst := filepath.Join(outputDir, ent.Name())
+		tmp := dst + ".tmp"
+		if err := os.RemoveAll(tmp); err != nil {
+			return err
+		}
+		if err := moveTree(src, tmp); err != nil {
+			os.RemoveAll(tmp)
+			return fmt.Errorf("cannot move %q to the output directory: %w", ent.Name(), err)
+		}
+		if err := os.RemoveAll(dst); err != nil {
+			return fmt.Errorf("cannot replace %q: %w", dst, err)
+		}
+		if err := os.Rename(tmp, dst); err != nil {
+			return fmt.Errorf("cannot replace %q: %w", dst, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mockStatfsType(t *testing.T, fsType int64, err error) {
+	saved := statfsType
+	statfsType = func(string) (int64, error) {
+		return fsType, err
+	}
+	t.Cleanup(func() { statfsType = saved })
+}
+
+func TestUseScratchOutput(t *testing.T) {
+	for _, tc := range []struct {
+		mode     string
+		fsType   int64
+		expected bool
+	}{
+		{"auto", 0x6969, true},
+		{"auto", 0xff534d42, true},
+		// xfs
+		{"auto", 0x58465342, false},
+		{"always", 0x58465342, true},
+		{"never", 0x6969, false},
+	} {
+		mockStatfsType(t, tc.fsType, nil)
+		scratch, err := useScratchOutput(tc.mode, "/output")
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, scratch, "%s %x", tc.mode, tc.fsType)
+	}
+}
+
+func TestUseScratchOutputErrors(t *testing.T) {
+	mockStatfsType(t, 0, syscall.ENOENT)
+	_, err := useScratchOutput("auto", "/output")
+	assert.EqualError(t, err, `cannot detect the filesystem of "/output": no such file or directory`)
+
+	_, err = useScratchOutput("sometimes", "/output")
+	assert.EqualError(t, err, `invalid scratch output mode "sometimes", must be one of [auto always never]`)
+}
+
+func makeFakeScratchOutput(t *testing.T) string {
+	scratchDir := t.TempDir()
+	for _, p := range []string{"qcow2/disk.qcow2", "image/disk.raw"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(scratchDir, filepath.Dir(p)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(scratchDir, p), []byte(p), 0644))
+	}
+	return scratchDir
+}
+
+func assertArtifactsMoved(t *testing.T, scratchDir, outputDir string) {
+	for _, p := range []string{"qcow2/disk.qcow2", "image/disk.raw"} {
+		content, err := os.ReadFile(filepath.Join(outputDir, p))
+		require.NoError(t, err)
+		assert.Equal(t, p, string(content))
+	}
+	entries, err := os.ReadDir(scratchDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestMoveArtifacts(t *testing.T) {
+	scratchDir := makeFakeScratchOutput(t)
+	outputDir := t.TempDir()
+	// leftovers of an earlier build are replaced
+	require.NoError(t, os.MkdirAll(filepath.Join(outputDir, "qcow2"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(outputDir, "qcow2", "old.qcow2"), nil, 0644))
+	// unrelated files are kept
+	require.NoError(t, os.WriteFile(filepath.Join(outputDir, "manifest-qcow2.json"), nil, 0644))
+
+	err := moveArtifacts(scratchDir, outputDir)
+	require.NoError(t, err)
+	assertArtifactsMoved(t, scratchDir, outputDir)
+	assert.NoFileExists(t, filepath.Join(outputDir, "qcow2", "old.qcow2"))
+	assert.FileExists(t, filepath.Join(outputDir, "manifest-qcow2.json"))
+}
+
+func TestMoveArtifactsCrossDevice(t *testing.T) {
+	saved := osRename
+	osRename = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	}
+	defer func() { osRename = saved }()
+
+	scratchDir := makeFakeScratchOutput(t)
+	outputDir := t.TempDir()
+
+	err := moveArtifacts(scratchDir, outputDir)
+	require.NoError(t, err)
+	assertArtifactsMoved(t, scratchDir, outputDir)
+}
+
+func TestMoveArtifactsError(t *testing.T) {
+	saved := osRename
+	osRename = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: errors.New("boom")}
+	}
+	defer func() { osRename = saved }()
+
+	err := moveArtifacts(makeFakeScratchOutput(t), t.TempDir())
+	assert.ErrorContains(t, err, `cannot move "image" to the output directory: rename `)
+}
+
+func TestMoveArtifactsFailedCopyKeepsEarlierArtifacts(t *testing.T) {
+	savedRename, savedCopy := osRename, copyTree
+	osRename = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	}
+	copyTree = func(src, dst string) error {
+		// a partial copy
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return err
+		}
+		return errors.New("no space left on device")
+	}
+	defer func() { osRename, copyTree = savedRename, savedCopy }()
+
+	outputDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(outputDir, "image"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(outputDir, "image", "disk.raw"), []byte("earlier build"), 0644))
+
+	err := moveArtifacts(makeFakeScratchOutput(t), outputDir)
+	assert.EqualError(t, err, `cannot move "image" to the output directory: no space left on device`)
+	content, err := os.ReadFile(filepath.Join(outputDir, "image", "disk.raw"))
+	require.NoError(t, err)
+	assert.Equal(t, "earlier build", string(content))
+	assert.NoDirExists(t, filepath.Join(outputDir, "image.tmp"))
+}
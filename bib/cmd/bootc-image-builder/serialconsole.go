@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// defaultSerialConsole is the serial console of the disk images if no
+// --serial-console is given
+const defaultSerialConsole = "ttyS0"
+
+// serialConsoleRE matches the "PORT[,BAUD[PARITY[BITS[FLOW]]]]" console
+// kernel argument of a serial port, e.g. "ttyS1,115200n8"
+var serialConsoleRE = regexp.MustCompile(`^(ttyS|ttyAMA|hvc)[0-9]+(,[1-9][0-9]*([noe]([5-8]r?)?)?)?$`)
+
+// validateSerialConsole checks the syntax of the --serial-console
+func validateSerialConsole(console string) error {
+	if console != "" && !serialConsoleRE.MatchString(console) {
+		return fmt.Errorf("invalid serial console %q, expected PORT[,BAUD[PARITY[BITS]]], e.g. ttyS1,115200n8", console)
+	}
+	return nil
+}
+
+// consoleKernelOptions returns the console kernel arguments of the disk
+// images, the serial console replaces the default ttyS0
+func consoleKernelOptions(serialConsole string) []string {
+	if serialConsole == "" {
+		serialConsole = defaultSerialConsole
+	}
+	return []string{
+		"console=tty0",
+		"console=" + serialConsole,
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSerialConsole(t *testing.T) {
+	for _, good := range []string{"", "ttyS0", "ttyS1,115200", "ttyS1,115200n8", "ttyS0,9600e7r", "ttyAMA0,115200", "hvc0"} {
+		assert.NoError(t, validateSerialConsole(good), good)
+	}
+	for _, bad := range []string{"ttyS", "tty0", "console=ttyS0", "ttyS1,", "ttyS1,0", "ttyS1,115200x8", "ttyS1,115200n9", "ttyS1 115200"} {
+		assert.EqualError(t, validateSerialConsole(bad), `invalid serial console "`+bad+`", expected PORT[,BAUD[PARITY[BITS]]], e.g. ttyS1,115200n8`)
+	}
+}
+
+func TestConsoleKernelOptions(t *testing.T) {
+	assert.Equal(t, []string{"console=tty0", "console=ttyS0"}, consoleKernelOptions(""))
+	assert.Equal(t, []string{"console=tty0", "console=ttyS1,115200n8"}, consoleKernelOptions("ttyS1,115200n8"))
+}
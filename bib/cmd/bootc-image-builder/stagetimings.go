@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/osbuild/bootc-image-builder/bib/pkg/progress"
+)
+
+// stageTiming is the --stage-timings representation of a single stage
+type stageTiming struct {
+	Pipeline string    `json:"pipeline"`
+	Stage    string    `json:"stage"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	// Duration is in seconds
+	Duration float64 `json:"duration"`
+}
+
+// writeStageTimings writes the osbuild stage timings as CSV if the
+// path has a ".csv" extension, as JSON otherwise
+func writeStageTimings(path string, timings []progress.StageTiming) error {
+	stages := make([]stageTiming, 0, len(timings))
+	for _, st := range timings {
+		stages = append(stages, stageTiming{
+			Pipeline: st.Pipeline,
+			Stage:    st.Stage,
+			Start:    st.Start.UTC(),
+			End:      st.End.UTC(),
+			Duration: st.Duration().Seconds(),
+		})
+	}
+
+	var buf bytes.Buffer
+	if filepath.Ext(path) == ".csv" {
+		w := csv.NewWriter(&buf)
+		records := [][]string{{"pipeline", "stage", "start", "end", "duration"}}
+		for _, st := range stages {
+			records = append(records, []string{
+				st.Pipeline,
+				st.Stage,
+				st.Start.Format(time.RFC3339Nano),
+				st.End.Format(time.RFC3339Nano),
+				strconv.FormatFloat(st.Duration, 'f', 3, 64),
+			})
+		}
+		if err := w.WriteAll(records); err != nil {
+			return fmt.Errorf("cannot write stage timings: %w", err)
+		}
+	} else {
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(stages); err != nil {
+			return fmt.Errorf("cannot write stage timings: %w", err)
+		}
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("cannot write stage timings: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/bootc-image-builder/bib/pkg/progress"
+)
+
+var fakeStageTimings = []progress.StageTiming{
+	{
+		Pipeline: "build",
+		Stage:    "org.osbuild.rpm",
+		Start:    time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		End:      time.Date(2024, 5, 1, 10, 1, 30, 500_000_000, time.UTC),
+	},
+	{
+		Pipeline: "image",
+		Stage:    "org.osbuild.truncate",
+		Start:    time.Date(2024, 5, 1, 10, 1, 30, 500_000_000, time.UTC),
+		End:      time.Date(2024, 5, 1, 10, 1, 31, 0, time.UTC),
+	},
+}
+
+func TestWriteStageTimingsJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timings.json")
+	require.NoError(t, writeStageTimings(path, fakeStageTimings))
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+  {"pipeline": "build", "stage": "org.osbuild.rpm", "start": "2024-05-01T10:00:00Z", "end": "2024-05-01T10:01:30.5Z", "duration": 90.5},
+  {"pipeline": "image", "stage": "org.osbuild.truncate", "start": "2024-05-01T10:01:30.5Z", "end": "2024-05-01T10:01:31Z", "duration": 0.5}
+]`, string(content))
+}
+
+func TestWriteStageTimingsCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timings.csv")
+	require.NoError(t, writeStageTimings(path, fakeStageTimings))
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `pipeline,stage,start,end,duration
+build,org.osbuild.rpm,2024-05-01T10:00:00Z,2024-05-01T10:01:30.5Z,90.500
+image,org.osbuild.truncate,2024-05-01T10:01:30.5Z,2024-05-01T10:01:31Z,0.500
+`, string(content))
+}
+
+func TestWriteStageTimingsEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timings.json")
+	require.NoError(t, writeStageTimings(path, nil))
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "[]\n", string(content))
+}
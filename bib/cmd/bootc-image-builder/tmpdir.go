@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// setupTmpdir makes the given directory the temporary directory of
+// bib and of all the tools it runs (e.g. osbuild) by setting TMPDIR
+func setupTmpdir(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	fp, err := os.CreateTemp(abs, ".bib-tmpdir-check-")
+	if err != nil {
+		return fmt.Errorf("cannot use %q as temporary directory: %w", dir, err)
+	}
+	fp.Close()
+	if err := os.Remove(fp.Name()); err != nil {
+		return err
+	}
+	return os.Setenv("TMPDIR", abs)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/osbuild/images/pkg/blueprint"
+	"github.com/osbuild/images/pkg/crypt"
+
+	"github.com/osbuild/bootc-image-builder/bib/internal/buildconfig"
+)
+
+// passwordHashRE matches crypt(3) style hashes, e.g. "$6$salt$hash" or
+// "$y$j9T$salt$hash" (yescrypt)
+var passwordHashRE = regexp.MustCompile(`^\$(1|2[abxy]|5|6|7|y|gy)\$[^$:\s]+(\$[^$:\s]+)+$`)
+
+func validatePasswordHash(hash string) error {
+	if !passwordHashRE.MatchString(hash) {
+		return fmt.Errorf("invalid password hash %q, expected a crypt(3) hash like the output of 'mkpasswd --method=sha-512'", hash)
+	}
+	return nil
+}
+
+// validateSSHKeys ensures that the given (newline separated)
+// authorized_keys content can be parsed so that a typo does not
+// silently create an image that cannot be logged into
+func validateSSHKeys(keys string) error {
+	for i, line := range strings.Split(keys, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line)); err != nil {
+			return fmt.Errorf("invalid ssh key on line %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// validateUserSSHKeys validates the ssh keys of all users in the config
+func validateUserSSHKeys(config *buildconfig.BuildConfig) error {
+	if config.Customizations == nil {
+		return nil
+	}
+	for _, user := range config.Customizations.User {
+		if user.Key == nil {
+			continue
+		}
+		if err := validateSSHKeys(*user.Key); err != nil {
+			return fmt.Errorf("user %q: %w", user.Name, err)
+		}
+	}
+	return nil
+}
+
+// plaintextPasswordUsers returns the names of the users with a
+// plaintext password, osbuild hashes those with a random salt
+func plaintextPasswordUsers(config *buildconfig.BuildConfig) []string {
+	if config.Customizations == nil {
+		return nil
+	}
+	var names []string
+	for _, user := range config.Customizations.User {
+		if user.Password != nil && *user.Password != "" && !crypt.PasswordIsCrypted(*user.Password) {
+			names = append(names, user.Name)
+		}
+	}
+	return names
+}
+
+// userFromFlags returns the user customization for the --user,
+// --password-hash and --ssh-key options or nil if no --user was given
+func userFromFlags(flags *pflag.FlagSet) (*blueprint.UserCustomization, error) {
+	name, _ := flags.GetString("user")
+	passwordHash, _ := flags.GetString("password-hash")
+	sshKey, _ := flags.GetString("ssh-key")
+
+	if name == "" {
+		if passwordHash != "" || sshKey != "" {
+			return nil, errors.New("--password-hash and --ssh-key require --user")
+		}
+		return nil, nil
+	}
+
+	user := &blueprint.UserCustomization{
+		Name: name,
+	}
+	if passwordHash != "" {
+		if err := validatePasswordHash(passwordHash); err != nil {
+			return nil, err
+		}
+		user.Password = &passwordHash
+	}
+	if sshKey != "" {
+		if err := validateSSHKeys(sshKey); err != nil {
+			return nil, err
+		}
+		user.Key = &sshKey
+	}
+	return user, nil
+}
+
+// addUser adds the given user to the config unless the config already
+// defines a user with the same name, the config always takes precedence
+func addUser(config *buildconfig.BuildConfig, user *blueprint.UserCustomization) {
+	if user == nil {
+		return
+	}
+	if config.Customizations == nil {
+		config.Customizations = &blueprint.Customizations{}
+	}
+	for _, u := range config.Customizations.User {
+		if u.Name == user.Name {
+			return
+		}
+	}
+	config.Customizations.User = append(config.Customizations.User, *user)
+}
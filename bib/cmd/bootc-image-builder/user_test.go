@@ -0,0 +1,169 @@
+package main_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/blueprint"
+
+	main "github.com/osbuild/bootc-image-builder/bib/cmd/bootc-image-builder"
+	"github.com/osbuild/bootc-image-builder/bib/internal/buildconfig"
+)
+
+const testPasswordHash = "$6$saltsalt$qFmFH.bQmmtXzyBY0s9v7Oicd2z4XSIecDzlB5KiA2/jctKu9YterLp8wwnSq.qc.eoxqOmSuNp2xS0ktL3nh/"
+
+const (
+	testSSHKeyEd25519 = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIKldrROPU+ejDVEIgxPvaFe4bQehul+tkAFwrwQTixje alice@example.com"
+	testSSHKeyECDSA   = "ecdsa-sha2-nistp256 AAAAE2VjZHNhLXNoYTItbmlzdHAyNTYAAAAIbmlzdHAyNTYAAABBBIg41TAlXPo5Qi1CLb4mufkkdkXQ/65A14EePMKDnDiNmU/6XNJuSi0AKSz6Uqz+REBN3QNq3035mSSjHKRd6Jg="
+	testSSHKeyRSA     = "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAAAgQC4t6a/Ii57RLLSPmph3Qo/xOgo4GTk0kEhjg4vp8oz7cb83LadXKSmemxml1fXxhCeucHC56124J8I9VQcTVlnVx3yNpQ1YWm0tufPXzdFlFO91R62plZWNbAorJ+w4VZGvjbqrYB7Fd9GtZ4F6crkPyLdmh1MJdfNfRRb2VqW0Q=="
+)
+
+func TestUserFlagsReachPrintConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	err := os.WriteFile(configPath, []byte(`[[customizations.user]]
+name = "tester"
+key = "`+testSSHKeyECDSA+`"
+`), 0644)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name    string
+		expKeys map[string]string
+	}{
+		// new user is added next to the config users
+		{"alice", map[string]string{"tester": testSSHKeyECDSA, "alice": testSSHKeyEd25519}},
+		// the config takes precedence over the commandline
+		{"tester", map[string]string{"tester": testSSHKeyECDSA}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			output := runPrintConfig(t, []string{
+				"manifest", "--print-config",
+				"--config", configPath,
+				"--user", tc.name,
+				"--password-hash", testPasswordHash,
+				"--ssh-key", testSSHKeyEd25519,
+				"quay.io/example/os:latest",
+			})
+
+			var cfg struct {
+				Config buildconfig.BuildConfig `json:"config"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(output), &cfg))
+			keys := map[string]string{}
+			for _, u := range cfg.Config.Customizations.User {
+				keys[u.Name] = *u.Key
+			}
+			assert.Equal(t, tc.expKeys, keys)
+		})
+	}
+}
+
+func TestUserFlagsErrors(t *testing.T) {
+	for _, tc := range []struct {
+		args   []string
+		expErr string
+	}{
+		{[]string{"--ssh-key", "ssh-ed25519 key"}, "--password-hash and --ssh-key require --user"},
+		{[]string{"--user", "alice", "--password-hash", "secret"}, `invalid password hash "secret", expected a crypt(3) hash like the output of 'mkpasswd --method=sha-512'`},
+		{[]string{"--user", "alice", "--password-hash", "$6$"}, `invalid password hash "$6$", expected a crypt(3) hash like the output of 'mkpasswd --method=sha-512'`},
+		{[]string{"--user", "alice", "--ssh-key", "ssh-ed25519 cli-key"}, "invalid ssh key on line 1: ssh: no key found"},
+	} {
+		t.Run(tc.expErr, func(t *testing.T) {
+			cmdline := append([]string{"manifest", "--print-config"}, tc.args...)
+			restore := mockOsArgs(append(cmdline, "quay.io/example/os:latest"))
+			defer restore()
+
+			rootCmd, err := main.BuildCobraCmdline()
+			require.NoError(t, err)
+			err = rootCmd.Execute()
+			assert.EqualError(t, err, tc.expErr)
+		})
+	}
+}
+
+func TestValidateSSHKeys(t *testing.T) {
+	for _, tc := range []struct {
+		keys   string
+		expErr string
+	}{
+		{testSSHKeyEd25519, ""},
+		{testSSHKeyECDSA, ""},
+		{testSSHKeyRSA, ""},
+		{`no-pty ` + testSSHKeyEd25519, ""},
+		// multiple keys, comments and empty lines
+		{"# admins\n" + testSSHKeyEd25519 + "\n\n" + testSSHKeyRSA + "\n", ""},
+		// typo in the key data
+		{strings.Replace(testSSHKeyEd25519, "AAAAC3", "AAAAX3", 1), "invalid ssh key on line 1: ssh: no key found"},
+		// truncated key
+		{testSSHKeyECDSA[:60], "invalid ssh key on line 1: ssh: no key found"},
+		{testSSHKeyRSA + "\nssh-ed25519", "invalid ssh key on line 2: ssh: no key found"},
+		{"not a key", "invalid ssh key on line 1: ssh: no key found"},
+	} {
+		err := main.ValidateSSHKeys(tc.keys)
+		if tc.expErr == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tc.expErr)
+		}
+	}
+}
+
+func TestUserSSHKeysFromConfigAreValidated(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	err := os.WriteFile(configPath, []byte(`[[customizations.user]]
+name = "tester"
+key = "ssh-ed25519 config-key"
+`), 0644)
+	require.NoError(t, err)
+
+	restore := mockOsArgs([]string{"manifest", "--print-config", "--config", configPath, "quay.io/example/os:latest"})
+	defer restore()
+	rootCmd, err := main.BuildCobraCmdline()
+	require.NoError(t, err)
+	err = rootCmd.Execute()
+	assert.EqualError(t, err, `user "tester": invalid ssh key on line 1: ssh: no key found`)
+}
+
+func TestAddUserReachesManifest(t *testing.T) {
+	passwordHash := testPasswordHash
+	key := testSSHKeyEd25519
+	config := main.ManifestConfig(*getBaseConfig())
+	config.ImageTypes = []string{"qcow2"}
+	config.Config = &buildconfig.BuildConfig{}
+	main.AddUser(config.Config, &blueprint.UserCustomization{
+		Name:     "alice",
+		Password: &passwordHash,
+		Key:      &key,
+	})
+
+	manifestJson := serializeTestManifest(t, &config)
+
+	opts := findStageOptions(t, manifestJson, "image", "org.osbuild.users")
+	alice := opts["users"].(map[string]interface{})["alice"].(map[string]interface{})
+	assert.Equal(t, testPasswordHash, alice["password"])
+	assert.Equal(t, key, alice["key"])
+}
+
+func TestPlaintextPasswordUsers(t *testing.T) {
+	plain := "secret"
+	hash := testPasswordHash
+	empty := ""
+	config := &buildconfig.BuildConfig{
+		Customizations: &blueprint.Customizations{
+			User: []blueprint.UserCustomization{
+				{Name: "alice", Password: &plain},
+				{Name: "bob", Password: &hash},
+				{Name: "carol", Password: &empty},
+				{Name: "dave"},
+			},
+		},
+	}
+	assert.Equal(t, []string{"alice"}, main.PlaintextPasswordUsers(config))
+	assert.Nil(t, main.PlaintextPasswordUsers(&buildconfig.BuildConfig{}))
+}
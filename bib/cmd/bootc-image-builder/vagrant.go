@@ -0,0 +1,113 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// vagrantLibvirtDir is the directory in the output directory that
+// contains the vagrant box for the libvirt provider
+const vagrantLibvirtDir = "vagrant-libvirt"
+
+const vagrantLibvirtVagrantfile = `Vagrant.configure("2") do |config|
+  config.vm.provider :libvirt do |libvirt|
+    libvirt.driver = "kvm"
+  end
+end
+`
+
+// qcow2VirtualSize returns the virtual disk size of the qcow2 image
+// from its header
+func qcow2VirtualSize(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	// magic (4 bytes), version (4), backing file offset (8),
+	// backing file size (4), cluster bits (4), size (8)
+	var header [32]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		return 0, fmt.Errorf("cannot read qcow2 header of %s: %w", path, err)
+	}
+	if !bytes.Equal(header[:4], []byte{'Q', 'F', 'I', 0xfb}) {
+		return 0, fmt.Errorf("%s is not a qcow2 image", path)
+	}
+	return binary.BigEndian.Uint64(header[24:32]), nil
+}
+
+// makeVagrantLibvirtBox packages the qcow2 disk into a vagrant box
+// for the libvirt provider
+func makeVagrantLibvirtBox(qcow2Path, boxPath string) (err error) {
+	size, err := qcow2VirtualSize(qcow2Path)
+	if err != nil {
+		return err
+	}
+	metadata, err := json.Marshal(map[string]interface{}{
+		"provider": "libvirt",
+		"format":   "qcow2",
+		// in GiB, rounded up
+		"virtual_size": (size + GibiByte - 1) / GibiByte,
+	})
+	if err != nil {
+		return err
+	}
+	disk, err := os.Open(qcow2Path)
+	if err != nil {
+		return err
+	}
+	defer disk.Close()
+	st, err := disk.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(boxPath), 0755); err != nil {
+		return err
+	}
+	fp, err := os.Create(boxPath)
+	if err != nil {
+		return fmt.Errorf("cannot create vagrant box: %w", err)
+	}
+	defer func() {
+		if cerr := fp.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("cannot create vagrant box: %w", cerr)
+		}
+	}()
+	gz := gzip.NewWriter(fp)
+	tw := tar.NewWriter(gz)
+
+	for _, f := range []struct {
+		name    string
+		content []byte
+	}{
+		{"metadata.json", append(metadata, '\n')},
+		{"Vagrantfile", []byte(vagrantLibvirtVagrantfile)},
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.content)), ModTime: st.ModTime()}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.content); err != nil {
+			return err
+		}
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "box.img", Mode: 0644, Size: st.Size(), ModTime: st.ModTime()}); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, disk); err != nil {
+		return fmt.Errorf("cannot add disk to vagrant box: %w", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeFakeQcow2 writes a file with a qcow2 header for the given
+// virtual size
+func makeFakeQcow2(t *testing.T, path string, size uint64) []byte {
+	content := make([]byte, 512)
+	copy(content, []byte{'Q', 'F', 'I', 0xfb})
+	binary.BigEndian.PutUint32(content[4:8], 3)
+	binary.BigEndian.PutUint64(content[24:32], size)
+	copy(content[256:], []byte("fake-disk-content"))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, content, 0644))
+	return content
+}
+
+func TestQcow2VirtualSize(t *testing.T) {
+	tmpdir := t.TempDir()
+	qcow2Path := filepath.Join(tmpdir, "disk.qcow2")
+	makeFakeQcow2(t, qcow2Path, 10*GibiByte)
+
+	size, err := qcow2VirtualSize(qcow2Path)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10*GibiByte), size)
+
+	rawPath := filepath.Join(tmpdir, "disk.raw")
+	require.NoError(t, os.WriteFile(rawPath, make([]byte, 512), 0644))
+	_, err = qcow2VirtualSize(rawPath)
+	assert.EqualError(t, err, rawPath+" is not a qcow2 image")
+}
+
+func TestMakeVagrantLibvirtBox(t *testing.T) {
+	outputDir := t.TempDir()
+	qcow2Path := filepath.Join(outputDir, "qcow2/disk.qcow2")
+	disk := makeFakeQcow2(t, qcow2Path, 10*GibiByte+1)
+
+	boxPath := filepath.Join(outputDir, vagrantLibvirtDir, "disk.box")
+	err := makeVagrantLibvirtBox(qcow2Path, boxPath)
+	require.NoError(t, err)
+
+	f, err := os.Open(boxPath)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+
+	content := make(map[string]string)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		names = append(names, hdr.Name)
+		content[hdr.Name] = string(data)
+	}
+	assert.Equal(t, []string{"metadata.json", "Vagrantfile", "box.img"}, names)
+	// the virtual size is rounded up to full GiB
+	assert.Equal(t, `{"format":"qcow2","provider":"libvirt","virtual_size":11}`+"\n", content["metadata.json"])
+	assert.Contains(t, content["Vagrantfile"], "config.vm.provider :libvirt do |libvirt|")
+	assert.Equal(t, string(disk), content["box.img"])
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/osbuild/bootc-image-builder/bib/internal/util"
+)
+
+// bootEntriesDir is the directory of the boot loader specification
+// entries relative to the root of the boot filesystem
+const bootEntriesDir = "loader/entries"
+
+// verifyBootEntries checks that the boot filesystem at bootRoot has at
+// least one boot loader entry and that the kernel and initramfs files
+// referenced by the entries exist.
+func verifyBootEntries(bootRoot string) error {
+	entries, err := filepath.Glob(filepath.Join(bootRoot, bootEntriesDir, "*.conf"))
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no boot loader entries found in %s", bootEntriesDir)
+	}
+	for _, entry := range entries {
+		if err := verifyBootEntry(bootRoot, entry); err != nil {
+			return fmt.Errorf("invalid boot loader entry %s: %w", filepath.Base(entry), err)
+		}
+	}
+	return nil
+}
+
+func verifyBootEntry(bootRoot, entryPath string) error {
+	f, err := os.Open(entryPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var haveKernel bool
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "linux":
+			haveKernel = true
+		case "initrd":
+		default:
+			continue
+		}
+		for _, p := range fields[1:] {
+			if !bootFileExists(bootRoot, p) {
+				return fmt.Errorf("%s %s does not exist", fields[0], p)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if !haveKernel {
+		return fmt.Errorf("no kernel (linux) set")
+	}
+	return nil
+}
+
+// bootFileExists checks if the path of a boot loader entry exists, the
+// path is relative to the boot filesystem which is either a separate
+// /boot partition or the root filesystem
+func bootFileExists(bootRoot, p string) bool {
+	candidates := []string{filepath.Join(bootRoot, p)}
+	if rel, ok := strings.CutPrefix(p, "/boot/"); ok {
+		candidates = append(candidates, filepath.Join(bootRoot, rel))
+	}
+	for _, candidate := range candidates {
+		if st, err := os.Stat(candidate); err == nil && st.Mode().IsRegular() {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyDiskImageBoots attaches the raw disk image as a read-only loop
+// device and checks the boot loader entries of the partition that
+// contains them
+func verifyDiskImageBoots(diskPath string) error {
+	output, err := exec.Command("losetup", "--find", "--show", "--read-only", "--partscan", diskPath).Output()
+	if err != nil {
+		return fmt.Errorf("cannot attach %s: %w", diskPath, util.OutputErr(err))
+	}
+	loopDev := strings.TrimSpace(string(output))
+	defer func() {
+		if output, err := exec.Command("losetup", "--detach", loopDev).CombinedOutput(); err != nil {
+			logrus.Warnf("cannot detach %s: %v, output:\n%s", loopDev, err, output)
+		}
+	}()
+
+	partitions, err := filepath.Glob(loopDev + "p*")
+	if err != nil {
+		return err
+	}
+	for _, partition := range partitions {
+		found, err := verifyPartitionBoots(partition)
+		if err != nil {
+			return err
+		}
+		if found {
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot find a partition with boot loader entries in %s", diskPath)
+}
+
+// verifyPartitionBoots mounts the partition read-only and verifies
+// its boot loader entries, partitions without entries are skipped
+func verifyPartitionBoots(partition string) (bool, error) {
+	mnt, err := os.MkdirTemp("", "bib-verify-boot-")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(mnt)
+
+	if output, err := exec.Command("mount", "-o", "ro", partition, mnt).CombinedOutput(); err != nil {
+		// e.g. the BIOS boot partition has no filesystem
+		logrus.Debugf("cannot mount %s: %v, output:\n%s", partition, err, output)
+		return false, nil
+	}
+	defer func() {
+		if output, err := exec.Command("umount", mnt).CombinedOutput(); err != nil {
+			logrus.Warnf("cannot unmount %s: %v, output:\n%s", mnt, err, output)
+		}
+	}()
+
+	if _, err := os.Stat(filepath.Join(mnt, bootEntriesDir)); errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err := verifyBootEntries(mnt); err != nil {
+		return true, fmt.Errorf("boot verification failed for %s: %w", partition, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBootEntry = `title Fedora Linux 40 (ostree:0)
+version 1
+options root=UUID=6be5fb36-6ee6-4bd6-a3ea-da4d6f3a4d2b rw boot=UUID=f6c3a6b6-3f3b-4ad8-b9f0-3cd3bf0e3c8f ostree=/ostree/boot.1/default/abc/0
+linux /ostree/default-abc/vmlinuz-6.11.3-200.fc40.x86_64
+initrd /ostree/default-abc/initramfs-6.11.3-200.fc40.x86_64.img
+`
+
+// makeBootFixture creates a boot filesystem like the one of a bootc
+// disk image with a separate /boot partition
+func makeBootFixture(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	}
+	// ostree uses a "loader" symlink to the current loader.N dir
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "loader.1/entries"), 0755))
+	require.NoError(t, os.Symlink("loader.1", filepath.Join(root, "loader")))
+	return root
+}
+
+func TestVerifyBootEntriesValid(t *testing.T) {
+	root := makeBootFixture(t, map[string]string{
+		"loader.1/entries/ostree-1.conf":                          testBootEntry,
+		"ostree/default-abc/vmlinuz-6.11.3-200.fc40.x86_64":       "kernel",
+		"ostree/default-abc/initramfs-6.11.3-200.fc40.x86_64.img": "initramfs",
+	})
+	assert.NoError(t, verifyBootEntries(root))
+}
+
+func TestVerifyBootEntriesBootPrefix(t *testing.T) {
+	// without a separate /boot partition the paths in the entry
+	// are prefixed with /boot
+	root := makeBootFixture(t, map[string]string{
+		"loader.1/entries/ostree-1.conf":   "linux /boot/ostree/default-abc/vmlinuz\ninitrd /boot/ostree/default-abc/initramfs.img\n",
+		"ostree/default-abc/vmlinuz":       "kernel",
+		"ostree/default-abc/initramfs.img": "initramfs",
+	})
+	assert.NoError(t, verifyBootEntries(root))
+}
+
+func TestVerifyBootEntriesInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		files  map[string]string
+		expErr string
+	}{
+		{
+			"no-entries",
+			map[string]string{
+				"ostree/default-abc/vmlinuz-6.11.3-200.fc40.x86_64": "kernel",
+			},
+			"no boot loader entries found in loader/entries",
+		},
+		{
+			"missing-kernel",
+			map[string]string{
+				"loader.1/entries/ostree-1.conf":                          testBootEntry,
+				"ostree/default-abc/initramfs-6.11.3-200.fc40.x86_64.img": "initramfs",
+			},
+			"invalid boot loader entry ostree-1.conf: linux /ostree/default-abc/vmlinuz-6.11.3-200.fc40.x86_64 does not exist",
+		},
+		{
+			"missing-initramfs",
+			map[string]string{
+				"loader.1/entries/ostree-1.conf":                    testBootEntry,
+				"ostree/default-abc/vmlinuz-6.11.3-200.fc40.x86_64": "kernel",
+			},
+			"invalid boot loader entry ostree-1.conf: initrd /ostree/default-abc/initramfs-6.11.3-200.fc40.x86_64.img does not exist",
+		},
+		{
+			"no-linux-key",
+			map[string]string{
+				"loader.1/entries/ostree-1.conf": "title Fedora Linux 40\noptions rw\n",
+			},
+			"invalid boot loader entry ostree-1.conf: no kernel (linux) set",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			root := makeBootFixture(t, tc.files)
+			assert.EqualError(t, verifyBootEntries(root), tc.expErr)
+		})
+	}
+}
+
+const sectorSize = 512
+
+// makeTestDiskImage creates a raw disk image with an MBR partition
+// table, a first partition without a filesystem (like the BIOS boot
+// partition) and an ext4 boot partition with the given files
+func makeTestDiskImage(t *testing.T, bootFiles map[string]string) string {
+	tmpdir := t.TempDir()
+	bootImg := filepath.Join(tmpdir, "boot.img")
+	bootSectors := uint32(32 * 1024 * 1024 / sectorSize)
+	require.NoError(t, os.WriteFile(bootImg, nil, 0644))
+	require.NoError(t, os.Truncate(bootImg, int64(bootSectors)*sectorSize))
+	output, err := exec.Command("mkfs.ext4", "-q", "-d", makeBootFixture(t, bootFiles), bootImg).CombinedOutput()
+	require.NoError(t, err, string(output))
+	bootContent, err := os.ReadFile(bootImg)
+	require.NoError(t, err)
+
+	mbr := make([]byte, sectorSize)
+	for i, part := range []struct{ start, size uint32 }{
+		{2048, 2048},
+		{4096, bootSectors},
+	} {
+		entry := mbr[446+16*i:]
+		// "Linux" partition type
+		entry[4] = 0x83
+		binary.LittleEndian.PutUint32(entry[8:], part.start)
+		binary.LittleEndian.PutUint32(entry[12:], part.size)
+	}
+	mbr[510], mbr[511] = 0x55, 0xaa
+
+	diskPath := filepath.Join(tmpdir, "disk.raw")
+	f, err := os.Create(diskPath)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, f.Truncate(int64(4096+bootSectors)*sectorSize))
+	_, err = f.WriteAt(mbr, 0)
+	require.NoError(t, err)
+	_, err = f.WriteAt(bootContent, 4096*sectorSize)
+	require.NoError(t, err)
+	return diskPath
+}
+
+// requireLoopPartitions skips the test unless loop devices with
+// partitions can be used, this needs root and the partition devices
+// of "losetup --partscan" (e.g. not in all containers)
+func requireLoopPartitions(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("loop devices need root")
+	}
+	for _, tool := range []string{"losetup", "mkfs.ext4", "mount"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not available", tool)
+		}
+	}
+	output, err := exec.Command("losetup", "--find", "--show", "--read-only", "--partscan", makeTestDiskImage(t, nil)).Output()
+	if err != nil {
+		t.Skipf("cannot attach loop device: %v", err)
+	}
+	loopDev := strings.TrimSpace(string(output))
+	defer exec.Command("losetup", "--detach", loopDev).Run()
+	if partitions, _ := filepath.Glob(loopDev + "p*"); len(partitions) == 0 {
+		t.Skipf("no partition devices for %s", loopDev)
+	}
+}
+
+func TestVerifyDiskImageBoots(t *testing.T) {
+	requireLoopPartitions(t)
+
+	diskPath := makeTestDiskImage(t, map[string]string{
+		"loader.1/entries/ostree-1.conf":                          testBootEntry,
+		"ostree/default-abc/vmlinuz-6.11.3-200.fc40.x86_64":       "kernel",
+		"ostree/default-abc/initramfs-6.11.3-200.fc40.x86_64.img": "initramfs",
+	})
+	// the first partition has no filesystem and is skipped
+	assert.NoError(t, verifyDiskImageBoots(diskPath))
+}
+
+func TestVerifyDiskImageBootsInvalid(t *testing.T) {
+	requireLoopPartitions(t)
+
+	diskPath := makeTestDiskImage(t, map[string]string{
+		"loader.1/entries/ostree-1.conf":                          testBootEntry,
+		"ostree/default-abc/initramfs-6.11.3-200.fc40.x86_64.img": "initramfs",
+	})
+	err := verifyDiskImageBoots(diskPath)
+	assert.ErrorContains(t, err, "boot verification failed for /dev/loop")
+	assert.ErrorContains(t, err, "invalid boot loader entry ostree-1.conf: linux /ostree/default-abc/vmlinuz-6.11.3-200.fc40.x86_64 does not exist")
+
+	diskPath = makeTestDiskImage(t, nil)
+	err = verifyDiskImageBoots(diskPath)
+	assert.ErrorContains(t, err, "no boot loader entries found in loader/entries")
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/osbuild/images/pkg/manifest"
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+// addVhdxPipeline adds a "vhdx" pipeline to the serialized manifest
+// that converts the raw disk image into a vhdx image as preferred by
+// Hyper-V. The images library has no vhdx pipeline for bootc disk
+// images yet so it is added here, like the "vpc" pipeline it runs the
+// osbuild qemu stage outside of the build root.
+func addVhdxPipeline(mf manifest.OSBuildManifest) (manifest.OSBuildManifest, error) {
+	var m struct {
+		Version   string            `json:"version"`
+		Pipelines []json.RawMessage `json:"pipelines"`
+		Sources   json.RawMessage   `json:"sources"`
+	}
+	if err := json.Unmarshal(mf, &m); err != nil {
+		return nil, fmt.Errorf("cannot parse manifest: %w", err)
+	}
+
+	pipeline := osbuild.Pipeline{Name: "vhdx"}
+	pipeline.AddStage(osbuild.NewQEMUStage(
+		osbuild.NewQEMUStageOptions("disk.vhdx", osbuild.QEMUFormatVHDX, osbuild.VHDXOptions{}),
+		osbuild.NewQemuStagePipelineFilesInputs("image", "disk.raw"),
+	))
+	data, err := json.Marshal(pipeline)
+	if err != nil {
+		return nil, err
+	}
+	m.Pipelines = append(m.Pipelines, data)
+
+	return json.Marshal(m)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddVhdxPipeline(t *testing.T) {
+	mf := []byte(`{"version":"2","pipelines":[{"name":"build"},{"name":"image"}],"sources":{"org.osbuild.curl":{}}}`)
+
+	newMf, err := addVhdxPipeline(mf)
+	require.NoError(t, err)
+
+	var m struct {
+		Version   string            `json:"version"`
+		Pipelines []json.RawMessage `json:"pipelines"`
+		Sources   json.RawMessage   `json:"sources"`
+	}
+	require.NoError(t, json.Unmarshal(newMf, &m))
+	assert.Equal(t, "2", m.Version)
+	assert.Equal(t, `{"org.osbuild.curl":{}}`, string(m.Sources))
+	require.Len(t, m.Pipelines, 3)
+	assert.Equal(t, `{"name":"build"}`, string(m.Pipelines[0]))
+	assert.JSONEq(t, `{
+		"name": "vhdx",
+		"stages": [{
+			"type": "org.osbuild.qemu",
+			"inputs": {"image": {"type": "org.osbuild.files", "origin": "org.osbuild.pipeline", "references": {"name:image": {"file": "disk.raw"}}}},
+			"options": {"filename": "disk.vhdx", "format": {"type": "vhdx"}}
+		}]
+	}`, string(m.Pipelines[2]))
+}
+
+func TestAddVhdxPipelineBadManifest(t *testing.T) {
+	_, err := addVhdxPipeline([]byte("not-json"))
+	assert.ErrorContains(t, err, "cannot parse manifest: ")
+}
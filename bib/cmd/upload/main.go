@@ -26,15 +26,24 @@ func uploadAMI(cmd *cobra.Command, args []string) {
 
 	region, err := flags.GetString("region")
 	check(err)
-	client, err := awscloud.NewDefault(region)
-	check(err)
 	bucketName, err := flags.GetString("bucket")
 	check(err)
 	imageName, err := flags.GetString("ami-name")
 	check(err)
 	targetArch, err := flags.GetString("target-arch")
 	check(err)
+	resume, err := flags.GetBool("resume")
+	check(err)
 
+	if resume {
+		client, err := uploader.NewResumableAWS(region)
+		check(err)
+		check(uploader.UploadAndRegisterResumable(client, filename, bucketName, imageName, targetArch, nil))
+		return
+	}
+
+	client, err := awscloud.NewDefault(region)
+	check(err)
 	check(uploader.UploadAndRegister(client, filename, bucketName, imageName, targetArch, nil))
 }
 
@@ -55,6 +64,7 @@ func setupCLI() *cobra.Command {
 	awsCmd.Flags().String("region", "", "target region")
 	awsCmd.Flags().String("bucket", "", "target S3 bucket name")
 	awsCmd.Flags().String("ami-name", "", "AMI name")
+	awsCmd.Flags().Bool("resume", false, "upload in parts and resume an interrupted upload of the same file")
 
 	check(awsCmd.MarkFlagRequired("region"))
 	check(awsCmd.MarkFlagRequired("bucket"))
@@ -164,3 +164,18 @@ func (c *Container) DefaultRootfsType() (string, error) {
 
 	return fsType, nil
 }
+
+// BootcVersion returns the version of the bootc binary in the
+// container as reported by "bootc --version" (e.g. "1.1.4").
+func (c *Container) BootcVersion() (string, error) {
+	output, err := exec.Command("podman", "exec", c.id, "bootc", "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run bootc --version: %w", util.OutputErr(err))
+	}
+	// the output is of the form "bootc 1.1.4"
+	fields := strings.Fields(string(output))
+	if len(fields) != 2 || fields[0] != "bootc" {
+		return "", fmt.Errorf("cannot parse bootc version from %q", strings.TrimSpace(string(output)))
+	}
+	return fields[1], nil
+}
@@ -171,3 +171,30 @@ echo '%s'
 		assert.ErrorContains(t, err, "unsupported root filesystem type: ext1, supported: ")
 	}
 }
+
+func TestBootcVersionHappy(t *testing.T) {
+	makeFakePodman(t, `#!/bin/sh
+echo "bootc 1.1.4"
+`)
+	cnt := Container{}
+	version, err := cnt.BootcVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, "1.1.4", version)
+}
+
+func TestBootcVersionSad(t *testing.T) {
+	makeFakePodman(t, `#!/bin/sh
+echo "something else"
+`)
+	cnt := Container{}
+	_, err := cnt.BootcVersion()
+	assert.EqualError(t, err, `cannot parse bootc version from "something else"`)
+
+	makeFakePodman(t, `#!/bin/sh
+>&2 echo "executable file not found in \$PATH"
+exit 127
+`)
+	_, err = cnt.BootcVersion()
+	assert.ErrorContains(t, err, "failed to run bootc --version: ")
+	assert.ErrorContains(t, err, "executable file not found in $PATH")
+}
@@ -21,6 +21,11 @@ var supportedImageTypes = map[string]imageType{
 	"gce":          imageType{Export: "gce"},
 	"anaconda-iso": imageType{Export: "bootiso", ISO: true},
 	"iso":          imageType{Export: "bootiso", ISO: true},
+
+	// the vagrant box is packaged from the qcow2 disk after the build
+	"vagrant-libvirt": imageType{Export: "qcow2"},
+	// the vhdx pipeline is added to the manifest by bib itself
+	"vhdx": imageType{Export: "vhdx"},
 }
 
 // Available() returns a comma-separated list of supported image types
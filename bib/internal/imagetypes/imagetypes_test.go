@@ -43,6 +43,34 @@ func TestImageTypes(t *testing.T) {
 			expectedExports: []string{"image", "vmdk", "qcow2"},
 			expectISO:       false,
 		},
+		"vagrant-libvirt": {
+			imageTypes:      []string{"vagrant-libvirt"},
+			expectedExports: []string{"qcow2"},
+			expectISO:       false,
+		},
+		"qcow-vagrant-libvirt": {
+			imageTypes:      []string{"qcow2", "vagrant-libvirt"},
+			expectedExports: []string{"qcow2"},
+			expectISO:       false,
+		},
+		"vhdx": {
+			imageTypes:      []string{"vhdx"},
+			expectedExports: []string{"vhdx"},
+			expectISO:       false,
+		},
+		"raw-vhdx": {
+			imageTypes:      []string{"raw", "vhdx"},
+			expectedExports: []string{"image", "vhdx"},
+			expectISO:       false,
+		},
+		"bad-mix-vhdx": {
+			imageTypes:  []string{"vhdx", "anaconda-iso"},
+			expectedErr: errors.New("cannot mix ISO/disk images in request [vhdx anaconda-iso]"),
+		},
+		"bad-mix-vagrant": {
+			imageTypes:  []string{"vagrant-libvirt", "iso"},
+			expectedErr: errors.New("cannot mix ISO/disk images in request [vagrant-libvirt iso]"),
+		},
 		"iso": {
 			imageTypes:      []string{"iso"},
 			expectedExports: []string{"bootiso"},
@@ -63,15 +91,15 @@ func TestImageTypes(t *testing.T) {
 		},
 		"bad-image-type": {
 			imageTypes:  []string{"bad"},
-			expectedErr: errors.New(`unsupported image type "bad", valid types are ami, anaconda-iso, gce, iso, qcow2, raw, vhd, vmdk`),
+			expectedErr: errors.New(`unsupported image type "bad", valid types are ami, anaconda-iso, gce, iso, qcow2, raw, vagrant-libvirt, vhd, vhdx, vmdk`),
 		},
 		"bad-in-good": {
 			imageTypes:  []string{"ami", "raw", "vmdk", "qcow2", "something-else-what-is-this"},
-			expectedErr: errors.New(`unsupported image type "something-else-what-is-this", valid types are ami, anaconda-iso, gce, iso, qcow2, raw, vhd, vmdk`),
+			expectedErr: errors.New(`unsupported image type "something-else-what-is-this", valid types are ami, anaconda-iso, gce, iso, qcow2, raw, vagrant-libvirt, vhd, vhdx, vmdk`),
 		},
 		"all-bad": {
 			imageTypes:  []string{"bad1", "bad2", "bad3", "bad4", "bad5", "bad42"},
-			expectedErr: errors.New(`unsupported image type "bad1", valid types are ami, anaconda-iso, gce, iso, qcow2, raw, vhd, vmdk`),
+			expectedErr: errors.New(`unsupported image type "bad1", valid types are ami, anaconda-iso, gce, iso, qcow2, raw, vagrant-libvirt, vhd, vhdx, vmdk`),
 		},
 	}
 
@@ -1,3 +1,17 @@
 package setup
 
 var ValidateCanRunTargetArch = validateCanRunTargetArch
+
+var MountFSType = mountFSType
+
+func MockEnvironment(mountpoint func(string) bool, run func(string, ...string) error, mountinfo, osbuild, tmp string) (restore func()) {
+	savedIsMountpoint, savedRunCmdSync, savedProcMountinfo, savedOsbuildPath, savedRunTmp := isMountpoint, runCmdSync, procMountinfo, osbuildPath, runTmp
+	isMountpoint, runCmdSync, procMountinfo, osbuildPath, runTmp = mountpoint, run, mountinfo, osbuild, tmp
+	return func() {
+		isMountpoint, runCmdSync, procMountinfo, osbuildPath, runTmp = savedIsMountpoint, savedRunCmdSync, savedProcMountinfo, savedOsbuildPath, savedRunTmp
+	}
+}
+
+func RunTmp() string {
+	return runTmp
+}
@@ -8,6 +8,8 @@ import (
 	"runtime"
 	"strings"
 
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/hashicorp/go-version"
 	"golang.org/x/sys/unix"
 
 	"github.com/sirupsen/logrus"
@@ -16,11 +18,50 @@ import (
 	"github.com/osbuild/bootc-image-builder/bib/internal/util"
 )
 
+var (
+	// these are variables so that they can be mocked in tests
+	isMountpoint  = util.IsMountpoint
+	runCmdSync    = util.RunCmdSync
+	procMountinfo = "/proc/self/mountinfo"
+
+	osbuildPath = "/usr/bin/osbuild"
+	// Where we dump temporary files; this must be an overlayfs as we cannot
+	// write security contexts on overlayfs.
+	runTmp = "/run/osbuild/"
+)
+
+// mountFSType returns the filesystem type of the mount at the given
+// mountpoint according to the mountinfo (an empty string if nothing is
+// mounted there). The last entry wins as later mounts shadow earlier
+// ones.
+func mountFSType(mountinfo, mountpoint string) (string, error) {
+	content, err := os.ReadFile(mountinfo)
+	if err != nil {
+		return "", err
+	}
+	var fsType string
+	for _, line := range strings.Split(string(content), "\n") {
+		// e.g. "22 1 0:5 / /dev rw,nosuid shared:2 - devtmpfs devtmpfs rw,size=4k"
+		fields, after, ok := strings.Cut(line, " - ")
+		if !ok {
+			continue
+		}
+		pre := strings.Fields(fields)
+		post := strings.Fields(after)
+		if len(pre) < 5 || len(post) < 1 {
+			continue
+		}
+		if pre[4] == mountpoint {
+			fsType = post[0]
+		}
+	}
+	return fsType, nil
+}
+
 // EnsureEnvironment mutates external filesystem state as necessary
 // to run in a container environment.  This function is idempotent.
 func EnsureEnvironment(storePath string) error {
-	osbuildPath := "/usr/bin/osbuild"
-	if util.IsMountpoint(osbuildPath) {
+	if isMountpoint(osbuildPath) {
 		return nil
 	}
 
@@ -28,7 +69,7 @@ func EnsureEnvironment(storePath string) error {
 	rootType := "system_u:object_r:root_t:s0"
 	// This papers over the lack of ensuring correct labels for the /ostree root
 	// in the existing pipeline
-	if err := util.RunCmdSync("chcon", rootType, storePath); err != nil {
+	if err := runCmdSync("chcon", rootType, storePath); err != nil {
 		return err
 	}
 
@@ -43,35 +84,40 @@ func EnsureEnvironment(storePath string) error {
 	// a nosuid, no_new_privs environment. In such an environment, we cannot transition from `unconfined_t` to `install_t`,
 	// because we would get more privileges.
 	installType := "system_u:object_r:install_exec_t:s0"
-	// Where we dump temporary files; this must be an overlayfs as we cannot
-	// write security contexts on overlayfs.
-	runTmp := "/run/osbuild/"
 
 	if err := os.MkdirAll(runTmp, 0o755); err != nil {
 		return err
 	}
-	if !util.IsMountpoint(runTmp) {
-		if err := util.RunCmdSync("mount", "-t", "tmpfs", "tmpfs", runTmp); err != nil {
+	if !isMountpoint(runTmp) {
+		if err := runCmdSync("mount", "-t", "tmpfs", "tmpfs", runTmp); err != nil {
 			return err
 		}
 	}
 	destPath := filepath.Join(runTmp, "osbuild")
-	if err := util.RunCmdSync("cp", "-p", "/usr/bin/osbuild", destPath); err != nil {
+	if err := runCmdSync("cp", "-p", osbuildPath, destPath); err != nil {
 		return err
 	}
-	if err := util.RunCmdSync("chcon", installType, destPath); err != nil {
+	if err := runCmdSync("chcon", installType, destPath); err != nil {
 		return err
 	}
 
 	// Ensure we have devfs inside the container to get dynamic loop
-	// loop devices inside the container.
-	if err := util.RunCmdSync("mount", "-t", "devtmpfs", "devtmpfs", "/dev"); err != nil {
-		return err
+	// loop devices inside the container. Privileged containers usually
+	// have a tmpfs on /dev so only mount it if it's not a devtmpfs
+	// already.
+	devFSType, err := mountFSType(procMountinfo, "/dev")
+	if err != nil {
+		return fmt.Errorf("cannot check the /dev mount: %w", err)
+	}
+	if devFSType != "devtmpfs" {
+		if err := runCmdSync("mount", "-t", "devtmpfs", "devtmpfs", "/dev"); err != nil {
+			return err
+		}
 	}
 
 	// Create a bind mount into our target location; we can't copy it because
 	// again we have to perserve the SELinux label.
-	if err := util.RunCmdSync("mount", "--bind", destPath, osbuildPath); err != nil {
+	if err := runCmdSync("mount", "--bind", destPath, osbuildPath); err != nil {
 		return err
 	}
 	// NOTE: Don't add new code here, do it before the bind mount which acts as the final success indicator
@@ -150,6 +196,61 @@ func validateCanRunTargetArch(targetArch string) error {
 	return nil
 }
 
+// CanRunTargetArch reports whether binaries for the given target arch
+// (in GOARCH notation) can be run on this host, either natively or via
+// qemu-user. Unlike validateCanRunTargetArch() it does not assume that
+// an arch without a canary binary works.
+func CanRunTargetArch(targetArch string) bool {
+	if targetArch == runtime.GOARCH {
+		return true
+	}
+	if _, err := exec.LookPath(fmt.Sprintf("bib-canary-%s", targetArch)); err != nil {
+		return false
+	}
+	return validateCanRunTargetArch(targetArch) == nil
+}
+
+// ValidateImgref checks that the given image reference is well formed
+// so that a typo is reported before any container work is done
+func ValidateImgref(imgref string) error {
+	// podman also accepts full image IDs
+	if reference.IsFullIdentifier(strings.TrimPrefix(imgref, "sha256:")) {
+		return nil
+	}
+	if _, err := reference.ParseNormalizedNamed(imgref); err != nil {
+		return fmt.Errorf("invalid image reference '%s': %w", imgref, err)
+	}
+	return nil
+}
+
+// notBootcHints explain what an image that is not a bootc image likely
+// is, they are checked in order against its labels
+var notBootcHints = []struct {
+	label string
+	hint  string
+}{
+	{"ostree.bootable:true", `it looks like an ostree native container without the bootc label, add "LABEL containers.bootc=1" to its Containerfile`},
+	{"org.label-schema.name:CentOS Stream", "it looks like a plain CentOS Stream image, did you mean quay.io/centos-bootc/centos-bootc?"},
+	{"vendor:Fedora Project", "it looks like a plain Fedora image, did you mean quay.io/fedora/fedora-bootc?"},
+	{"com.redhat.component:ubi", "it looks like a UBI image, did you mean registry.redhat.io/rhel9/rhel-bootc?"},
+}
+
+// notBootcImageError returns an error for an image that has no bootc
+// label with a hint how to fix it based on the labels it has
+func notBootcImageError(imgref, labels string) error {
+	hint := "make sure the image is built FROM a bootc image, e.g. quay.io/centos-bootc/centos-bootc:stream9"
+	if strings.TrimSpace(labels) == "map[]" {
+		hint = "the image has no labels, " + hint
+	}
+	for _, h := range notBootcHints {
+		if strings.Contains(labels, h.label) {
+			hint = h.hint
+			break
+		}
+	}
+	return fmt.Errorf("image %s is not a bootc image (missing the containers.bootc=1 label)\n%s", imgref, hint)
+}
+
 func ValidateHasContainerTags(imgref string) error {
 	output, err := exec.Command("podman", "image", "inspect", imgref, "--format", "{{.Labels}}").Output()
 	if err != nil {
@@ -160,8 +261,38 @@ bootc-image-builder no longer pulls images, make sure to pull it before running
 
 	tags := string(output)
 	if !strings.Contains(tags, "containers.bootc:1") {
-		return fmt.Errorf("image %s is not a bootc image", imgref)
+		return notBootcImageError(imgref, tags)
 	}
 
 	return nil
 }
+
+// MinBootcVersion is the oldest bootc version in the container that
+// bootc-image-builder supports, older versions lack parts of the
+// "bootc install" interface that the generated manifests rely on.
+const MinBootcVersion = "1.0.0"
+
+// BootcVersioner is implemented by containers that can report the
+// version of the bootc binary they ship
+type BootcVersioner interface {
+	BootcVersion() (string, error)
+}
+
+// ValidateBootcVersion checks that the container ships a bootc that is
+// new enough to be installed by bootc-image-builder
+func ValidateBootcVersion(imgref string, cnt BootcVersioner) error {
+	bootcVersion, err := cnt.BootcVersion()
+	if err != nil {
+		return fmt.Errorf(`cannot find bootc in image %s: %w
+make sure the image is built from a bootc base image that includes bootc %s or newer`, imgref, err, MinBootcVersion)
+	}
+	have, err := version.NewVersion(bootcVersion)
+	if err != nil {
+		return fmt.Errorf("cannot parse bootc version %q of image %s: %w", bootcVersion, imgref, err)
+	}
+	if have.LessThan(version.Must(version.NewVersion(MinBootcVersion))) {
+		return fmt.Errorf(`bootc version %s in image %s is too old, need %s or newer
+rebuild the image from an updated bootc base image`, bootcVersion, imgref, MinBootcVersion)
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/sirupsen/logrus"
@@ -67,11 +68,26 @@ func TestValidateCanRunTargetArchUnexpectedOutput(t *testing.T) {
 	assert.ErrorContains(t, err, `internal error: unexpected output`)
 }
 
+func TestCanRunTargetArch(t *testing.T) {
+	assert.True(t, setup.CanRunTargetArch(runtime.GOARCH))
+	assert.False(t, setup.CanRunTargetArch("fakearch"))
+
+	makeFakeCanary(t, "#!/bin/sh\necho ok")
+	assert.True(t, setup.CanRunTargetArch("fakearch"))
+
+	makeFakeCanary(t, "")
+	assert.False(t, setup.CanRunTargetArch("fakearch"))
+}
+
 var (
 	fakePodmanOutputCentosBootc = `map[containers.bootc:1 io.buildah.version:1.29.1 org.opencontainers.image.version:stream9.20240319.0 ostree.bootable:true ostree.commit:97d619eae2a5474a9c363c78e3ad6caec14acba54a0b077c7cb69d00a4f800a5 ostree.final-diffid:sha256:12787d84fa137cd5649a9005efe98ec9d05ea46245fdc50aecb7dd007f2035b1 ostree.linux:5.14.0-430.el9.x86_64 redhat.compose-id:CentOS-Stream-9-20240304.d.0 redhat.id:centos redhat.version-id:9 rpmostree.inputhash:a5c67fd4e9465e47e01922171c6ab8edf261d2d381e590b5cd7fed81ea8d4dbe]`
 
 	fakePodmanOutputCentos = `map[io.buildah.version:1.33.7 org.label-schema.build-date:20240618 org.label-schema.license:GPLv2 org.label-schema.name:CentOS Stream 9 Base Image org.label-schema.schema-version:1.0 org.label-schema.vendor:CentOS]`
 
+	fakePodmanOutputFedora = `map[license:MIT name:fedora vendor:Fedora Project version:40]`
+
+	fakePodmanOutputUBI = `map[architecture:x86_64 com.redhat.component:ubi9-container-container name:ubi9 vendor:Red Hat, Inc. version:9.4]`
+
 	emptyPodmanOutput = `map[]`
 )
 
@@ -89,12 +105,32 @@ func TestValidateTags(t *testing.T) {
 		{
 			"quay.io/centos/centos:stream9",
 			fakePodmanOutputCentos,
-			"image quay.io/centos/centos:stream9 is not a bootc image",
+			"image quay.io/centos/centos:stream9 is not a bootc image (missing the containers.bootc=1 label)\nit looks like a plain CentOS Stream image, did you mean quay.io/centos-bootc/centos-bootc?",
 		},
 		{
 			"fake/image",
 			emptyPodmanOutput,
-			"image fake/image is not a bootc image",
+			"image fake/image is not a bootc image (missing the containers.bootc=1 label)\nthe image has no labels, make sure the image is built FROM a bootc image, e.g. quay.io/centos-bootc/centos-bootc:stream9",
+		},
+		{
+			"localhost/ostree-native",
+			strings.Replace(fakePodmanOutputCentosBootc, "containers.bootc:1 ", "", 1),
+			"image localhost/ostree-native is not a bootc image (missing the containers.bootc=1 label)\nit looks like an ostree native container without the bootc label, add \"LABEL containers.bootc=1\" to its Containerfile",
+		},
+		{
+			"registry.fedoraproject.org/fedora:40",
+			fakePodmanOutputFedora,
+			"image registry.fedoraproject.org/fedora:40 is not a bootc image (missing the containers.bootc=1 label)\nit looks like a plain Fedora image, did you mean quay.io/fedora/fedora-bootc?",
+		},
+		{
+			"registry.access.redhat.com/ubi9",
+			fakePodmanOutputUBI,
+			"image registry.access.redhat.com/ubi9 is not a bootc image (missing the containers.bootc=1 label)\nit looks like a UBI image, did you mean registry.redhat.io/rhel9/rhel-bootc?",
+		},
+		{
+			"localhost/app",
+			`map[maintainer:me@example.com]`,
+			"image localhost/app is not a bootc image (missing the containers.bootc=1 label)\nmake sure the image is built FROM a bootc image, e.g. quay.io/centos-bootc/centos-bootc:stream9",
 		},
 	} {
 		podmanArgsFile := filepath.Join(t.TempDir(), "args.txt")
@@ -111,3 +147,144 @@ echo '%s'
 		}
 	}
 }
+
+func TestValidateImgref(t *testing.T) {
+	for _, tc := range []struct {
+		imgref      string
+		expectedErr string
+	}{
+		{"quay.io/centos-bootc/centos-bootc:stream9", ""},
+		{"localhost/my-bootc", ""},
+		{"fedora-bootc@sha256:dddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddd", ""},
+		{"sha256:1111111111111111111111111111111111111111111111111111111111111111", ""},
+		{"quay.io/foo::", "invalid image reference 'quay.io/foo::': invalid reference format"},
+		{"quay.io/foo:bad~tag", "invalid image reference 'quay.io/foo:bad~tag': invalid reference format"},
+		{"docker://quay.io/foo", "invalid image reference 'docker://quay.io/foo': invalid reference format"},
+		{"Quay.io/Foo", "invalid image reference 'Quay.io/Foo': invalid reference format: repository name must be lowercase"},
+		{"", "invalid image reference '': invalid reference format"},
+	} {
+		t.Run(tc.imgref, func(t *testing.T) {
+			err := setup.ValidateImgref(tc.imgref)
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+type fakeBootcContainer struct {
+	version string
+	err     error
+}
+
+func (f *fakeBootcContainer) BootcVersion() (string, error) {
+	return f.version, f.err
+}
+
+func TestValidateBootcVersion(t *testing.T) {
+	for _, tc := range []struct {
+		cnt         *fakeBootcContainer
+		expectedErr string
+	}{
+		{&fakeBootcContainer{version: "1.0.0"}, ""},
+		{&fakeBootcContainer{version: "1.1.4"}, ""},
+		{&fakeBootcContainer{version: "0.1.9"}, "bootc version 0.1.9 in image quay.io/example/os is too old, need 1.0.0 or newer\nrebuild the image from an updated bootc base image"},
+		{&fakeBootcContainer{version: "x.y"}, `cannot parse bootc version "x.y" of image quay.io/example/os: Malformed version: x.y`},
+		{&fakeBootcContainer{err: fmt.Errorf("exit status 127")}, "cannot find bootc in image quay.io/example/os: exit status 127\nmake sure the image is built from a bootc base image that includes bootc 1.0.0 or newer"},
+	} {
+		err := setup.ValidateBootcVersion("quay.io/example/os", tc.cnt)
+		if tc.expectedErr == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tc.expectedErr)
+		}
+	}
+}
+
+const fakeMountinfo = `1 0 0:30 / / rw,relatime - overlay overlay rw
+22 1 0:5 / /dev rw,nosuid - tmpfs tmpfs rw,size=64k
+`
+
+func writeMountinfo(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "mountinfo")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestMountFSType(t *testing.T) {
+	mountinfo := writeMountinfo(t, fakeMountinfo+"40 22 0:6 / /dev rw,nosuid shared:2 - devtmpfs devtmpfs rw,size=4k\n")
+
+	fsType, err := setup.MountFSType(mountinfo, "/dev")
+	assert.NoError(t, err)
+	assert.Equal(t, "devtmpfs", fsType)
+	fsType, err = setup.MountFSType(mountinfo, "/")
+	assert.NoError(t, err)
+	assert.Equal(t, "overlay", fsType)
+	fsType, err = setup.MountFSType(mountinfo, "/run")
+	assert.NoError(t, err)
+	assert.Equal(t, "", fsType)
+
+	_, err = setup.MountFSType("/no/such/mountinfo", "/dev")
+	assert.Error(t, err)
+}
+
+type fakeEnvironment struct {
+	mountpoints map[string]bool
+	calls       []string
+}
+
+func (f *fakeEnvironment) isMountpoint(path string) bool {
+	return f.mountpoints[path]
+}
+
+func (f *fakeEnvironment) run(name string, args ...string) error {
+	f.calls = append(f.calls, strings.Join(append([]string{name}, args...), " "))
+	return nil
+}
+
+func mockEnvironment(t *testing.T, mountinfo string, mountpoints ...string) *fakeEnvironment {
+	tmp := filepath.Join(t.TempDir(), "run-osbuild")
+	env := &fakeEnvironment{mountpoints: make(map[string]bool)}
+	for _, mnt := range mountpoints {
+		if mnt == "run-osbuild" {
+			mnt = tmp
+		}
+		env.mountpoints[mnt] = true
+	}
+	restore := setup.MockEnvironment(env.isMountpoint, env.run, writeMountinfo(t, mountinfo), "/usr/bin/osbuild", tmp)
+	t.Cleanup(restore)
+	return env
+}
+
+func TestEnsureEnvironmentAlreadySetUp(t *testing.T) {
+	env := mockEnvironment(t, fakeMountinfo, "/usr/bin/osbuild")
+
+	assert.NoError(t, setup.EnsureEnvironment("/store"))
+	assert.Empty(t, env.calls)
+}
+
+func TestEnsureEnvironmentMounts(t *testing.T) {
+	env := mockEnvironment(t, fakeMountinfo)
+
+	assert.NoError(t, setup.EnsureEnvironment("/store"))
+	assert.Equal(t, []string{
+		"chcon system_u:object_r:root_t:s0 /store",
+		"mount -t tmpfs tmpfs " + setup.RunTmp(),
+		"cp -p /usr/bin/osbuild " + filepath.Join(setup.RunTmp(), "osbuild"),
+		"chcon system_u:object_r:install_exec_t:s0 " + filepath.Join(setup.RunTmp(), "osbuild"),
+		"mount -t devtmpfs devtmpfs /dev",
+		"mount --bind " + filepath.Join(setup.RunTmp(), "osbuild") + " /usr/bin/osbuild",
+	}, env.calls)
+}
+
+func TestEnsureEnvironmentAlreadyMounted(t *testing.T) {
+	env := mockEnvironment(t, fakeMountinfo+"40 22 0:6 / /dev rw,nosuid - devtmpfs devtmpfs rw\n", "run-osbuild")
+
+	assert.NoError(t, setup.EnsureEnvironment("/store"))
+	for _, call := range env.calls {
+		assert.NotContains(t, call, "tmpfs")
+	}
+	assert.Len(t, env.calls, 4)
+}
@@ -33,8 +33,10 @@ func validateOSRelease(osrelease map[string]string) error {
 	return nil
 }
 
+const bootupdEfiDir = "usr/lib/bootupd/updates/EFI"
+
 func uefiVendor(root string) (string, error) {
-	bootupdEfiDir := path.Join(root, "usr/lib/bootupd/updates/EFI")
+	bootupdEfiDir := path.Join(root, bootupdEfiDir)
 	l, err := os.ReadDir(bootupdEfiDir)
 	if err != nil {
 		return "", fmt.Errorf("cannot read bootupd EFI directory %s: %w", bootupdEfiDir, err)
@@ -56,6 +58,25 @@ func uefiVendor(root string) (string, error) {
 	return "", fmt.Errorf("cannot find UEFI vendor in %s", bootupdEfiDir)
 }
 
+// SetUEFIVendor overrides the detected UEFI vendor, this is useful if
+// the bootupd EFI directory contains multiple vendor directories. The
+// vendor directory must exist in the given root.
+func (i *Info) SetUEFIVendor(root, vendor string) error {
+	if vendor == "" || vendor == "BOOT" || path.Base(vendor) != vendor || vendor == "." || vendor == ".." {
+		return fmt.Errorf("invalid UEFI vendor %q", vendor)
+	}
+	vendorDir := path.Join(root, bootupdEfiDir, vendor)
+	st, err := os.Stat(vendorDir)
+	if err != nil {
+		return fmt.Errorf("cannot use UEFI vendor %q: %w", vendor, err)
+	}
+	if !st.IsDir() {
+		return fmt.Errorf("cannot use UEFI vendor %q: %s is not a directory", vendor, vendorDir)
+	}
+	i.UEFIVendor = vendor
+	return nil
+}
+
 func LoadInfo(root string) (*Info, error) {
 	osrelease, err := distro.ReadOSReleaseFromTree(root)
 	if err != nil {
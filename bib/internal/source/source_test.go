@@ -89,3 +89,40 @@ func TestLoadInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestSetUEFIVendorOverridesDetection(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, writeOSRelease(root, "fedora", "40", "Fedora Linux", "platform:f40", ""))
+	require.NoError(t, createBootupdEFI(root, "centos"))
+	require.NoError(t, createBootupdEFI(root, "fedora"))
+
+	info, err := LoadInfo(root)
+	require.NoError(t, err)
+	// detection picks the first vendor directory
+	assert.Equal(t, "centos", info.UEFIVendor)
+
+	require.NoError(t, info.SetUEFIVendor(root, "fedora"))
+	assert.Equal(t, "fedora", info.UEFIVendor)
+}
+
+func TestSetUEFIVendorErrors(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, createBootupdEFI(root, "fedora"))
+	require.NoError(t, os.WriteFile(path.Join(root, "usr/lib/bootupd/updates/EFI/file"), nil, 0644))
+
+	for _, tc := range []struct {
+		vendor string
+		expErr string
+	}{
+		{"BOOT", `invalid UEFI vendor "BOOT"`},
+		{"..", `invalid UEFI vendor ".."`},
+		{"fedora/../centos", `invalid UEFI vendor "fedora/../centos"`},
+		{"centos", `cannot use UEFI vendor "centos": stat ` + root + `/usr/lib/bootupd/updates/EFI/centos: no such file or directory`},
+		{"file", `cannot use UEFI vendor "file": ` + root + `/usr/lib/bootupd/updates/EFI/file is not a directory`},
+	} {
+		info := &Info{UEFIVendor: "fedora"}
+		err := info.SetUEFIVendor(root, tc.vendor)
+		assert.EqualError(t, err, tc.expErr)
+		assert.Equal(t, "fedora", info.UEFIVendor)
+	}
+}
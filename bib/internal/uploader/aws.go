@@ -1,18 +1,27 @@
 package uploader
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/cheggaaa/pb/v3"
 	"github.com/google/uuid"
 
 	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/cloud/awscloud"
 )
 
 var osStdout io.Writer = os.Stdout
@@ -58,6 +67,10 @@ func UploadAndRegister(a AwsUploader, filename, bucketName, imageName, targetArc
 	}
 	fmt.Fprintf(osStdout, "File uploaded to %s\n", aws.StringValue(&uploadOutput.Location))
 
+	return register(a, bucketName, keyName, imageName, targetArch)
+}
+
+func register(a AwsUploader, bucketName, keyName, imageName, targetArch string) error {
 	if targetArch == "" {
 		targetArch = arch.Current().String()
 	}
@@ -71,3 +84,307 @@ func UploadAndRegister(a AwsUploader, filename, bucketName, imageName, targetArc
 	}
 	return nil
 }
+
+// MultipartUploader is the subset of the S3 API that is needed to
+// upload a file in parts that can be resumed later.
+type MultipartUploader interface {
+	CreateMultipartUpload(input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(input *s3.UploadPartInput) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(input *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(input *s3.AbortMultipartUploadInput) (*s3.AbortMultipartUploadOutput, error)
+}
+
+// ResumableAwsUploader can upload and register an AMI and resume
+// an interrupted upload.
+type ResumableAwsUploader interface {
+	AwsUploader
+	MultipartUploader
+}
+
+type resumableAWS struct {
+	*awscloud.AWS
+	s3 *s3.S3
+}
+
+func (r *resumableAWS) CreateMultipartUpload(input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
+	return r.s3.CreateMultipartUpload(input)
+}
+
+func (r *resumableAWS) UploadPart(input *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	return r.s3.UploadPart(input)
+}
+
+func (r *resumableAWS) CompleteMultipartUpload(input *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error) {
+	return r.s3.CompleteMultipartUpload(input)
+}
+
+func (r *resumableAWS) AbortMultipartUpload(input *s3.AbortMultipartUploadInput) (*s3.AbortMultipartUploadOutput, error) {
+	return r.s3.AbortMultipartUpload(input)
+}
+
+// NewResumableAWS returns a ResumableAwsUploader for the given region,
+// credentials are found the same way as awscloud.NewDefault() does.
+func NewResumableAWS(region string) (ResumableAwsUploader, error) {
+	client, err := awscloud.NewDefault(region)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String(region),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resumableAWS{AWS: client, s3: s3.New(sess)}, nil
+}
+
+// ImageFinder looks up existing AMIs
+type ImageFinder interface {
+	// FindImagesByName returns the IDs of the AMIs of the account
+	// with the given name
+	FindImagesByName(name string) ([]string, error)
+}
+
+type ec2ImageFinder struct {
+	ec2 *ec2.EC2
+}
+
+func (f *ec2ImageFinder) FindImagesByName(name string) ([]string, error) {
+	out, err := f.ec2.DescribeImages(&ec2.DescribeImagesInput{
+		Owners: []*string{aws.String("self")},
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("name"),
+				Values: []*string{aws.String(name)},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot look up AMIs named %q: %w", name, err)
+	}
+	ids := make([]string, 0, len(out.Images))
+	for _, img := range out.Images {
+		ids = append(ids, aws.StringValue(img.ImageId))
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// NewAWSImageFinder returns an ImageFinder for the given region,
+// credentials are found the same way as awscloud.NewDefault() does.
+func NewAWSImageFinder(region string) (ImageFinder, error) {
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String(region),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ec2ImageFinder{ec2: ec2.New(sess)}, nil
+}
+
+// multipartPartSize matches the part size that awscloud uses
+var multipartPartSize int64 = 64 * 1024 * 1024
+
+type uploadPart struct {
+	PartNumber int64  `json:"part_number"`
+	ETag       string `json:"etag"`
+}
+
+// uploadState is written next to the uploaded file so that an
+// interrupted upload can be resumed
+type uploadState struct {
+	Bucket   string `json:"bucket"`
+	Key      string `json:"key"`
+	UploadID string `json:"upload_id"`
+	// sha256 of the content of the uploaded file, used to detect if
+	// the file changed since the upload was started (e.g. it was
+	// replaced by a rebuild, which never has the same content)
+	Digest   string       `json:"sha256"`
+	PartSize int64        `json:"part_size"`
+	Parts    []uploadPart `json:"parts"`
+}
+
+func fileDigest(file *os.File) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(file, 0, math.MaxInt64)); err != nil {
+		return "", fmt.Errorf("cannot checksum upload: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// abortStaleUpload aborts the multipart upload of a stale state so
+// that its parts are not left (and billed) in the bucket
+func abortStaleUpload(a MultipartUploader, state *uploadState) {
+	_, err := a.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(state.Bucket),
+		Key:      aws.String(state.Key),
+		UploadId: aws.String(state.UploadID),
+	})
+	if err != nil {
+		fmt.Fprintf(osStdout, "Cannot abort stale upload %s of %s:%s: %v\n", state.UploadID, state.Bucket, state.Key, err)
+	}
+}
+
+func uploadStatePath(filename string) string {
+	return filename + ".upload-state"
+}
+
+func loadUploadState(path string) (*uploadState, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read upload state: %w", err)
+	}
+	var state uploadState
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, fmt.Errorf("cannot parse upload state %q: %w", path, err)
+	}
+	return &state, nil
+}
+
+func (st *uploadState) save(path string) error {
+	content, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("cannot marshal upload state: %w", err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("cannot write upload state: %w", err)
+	}
+	return nil
+}
+
+func (st *uploadState) hasPart(partNumber int64) bool {
+	for _, p := range st.Parts {
+		if p.PartNumber == partNumber {
+			return true
+		}
+	}
+	return false
+}
+
+func doResumableUpload(a MultipartUploader, file *os.File, bucketName string, pbar *pb.ProgressBar) (*uploadState, *s3.CompleteMultipartUploadOutput, error) {
+	st, err := file.Stat()
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot stat upload: %v", err)
+	}
+	statePath := uploadStatePath(file.Name())
+
+	state, err := loadUploadState(statePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	digest, err := fileDigest(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	if state != nil && (state.Bucket != bucketName || state.Digest != digest || state.PartSize <= 0) {
+		fmt.Fprintf(osStdout, "Ignoring stale upload state %s\n", statePath)
+		abortStaleUpload(a, state)
+		state = nil
+	}
+	if state == nil {
+		keyName := fmt.Sprintf("%s-%s", uuid.New().String(), filepath.Base(file.Name()))
+		out, err := a.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+			Bucket: aws.String(bucketName),
+			Key:    aws.String(keyName),
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot create multipart upload: %w", err)
+		}
+		state = &uploadState{
+			Bucket:   bucketName,
+			Key:      keyName,
+			UploadID: aws.StringValue(out.UploadId),
+			Digest:   digest,
+			PartSize: multipartPartSize,
+		}
+		if err := state.save(statePath); err != nil {
+			return nil, nil, err
+		}
+		fmt.Fprintf(osStdout, "Uploading %s to %s:%s\n", file.Name(), bucketName, state.Key)
+	} else {
+		fmt.Fprintf(osStdout, "Resuming upload of %s to %s:%s (%d parts done)\n", file.Name(), bucketName, state.Key, len(state.Parts))
+	}
+
+	if pbar != nil {
+		pbar.SetTotal(st.Size())
+		pbar.Set(pb.Bytes, true)
+		pbar.SetWriter(osStdout)
+		pbar.Start()
+		defer pbar.Finish()
+	}
+
+	// an empty file is still uploaded as a single (empty) part
+	numParts := max(1, (st.Size()+state.PartSize-1)/state.PartSize)
+	for partNumber := int64(1); partNumber <= numParts; partNumber++ {
+		offset := (partNumber - 1) * state.PartSize
+		partLen := min(state.PartSize, st.Size()-offset)
+		if !state.hasPart(partNumber) {
+			out, err := a.UploadPart(&s3.UploadPartInput{
+				Bucket:     aws.String(state.Bucket),
+				Key:        aws.String(state.Key),
+				UploadId:   aws.String(state.UploadID),
+				PartNumber: aws.Int64(partNumber),
+				Body:       io.NewSectionReader(file, offset, partLen),
+			})
+			if err != nil {
+				return nil, nil, fmt.Errorf("cannot upload part %d (upload can be resumed): %w", partNumber, err)
+			}
+			state.Parts = append(state.Parts, uploadPart{PartNumber: partNumber, ETag: aws.StringValue(out.ETag)})
+			if err := state.save(statePath); err != nil {
+				return nil, nil, err
+			}
+		}
+		if pbar != nil {
+			pbar.Add64(partLen)
+		}
+	}
+
+	sort.Slice(state.Parts, func(i, j int) bool {
+		return state.Parts[i].PartNumber < state.Parts[j].PartNumber
+	})
+	completed := make([]*s3.CompletedPart, 0, len(state.Parts))
+	for _, p := range state.Parts {
+		completed = append(completed, &s3.CompletedPart{
+			PartNumber: aws.Int64(p.PartNumber),
+			ETag:       aws.String(p.ETag),
+		})
+	}
+	out, err := a.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(state.Bucket),
+		Key:             aws.String(state.Key),
+		UploadId:        aws.String(state.UploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot complete multipart upload: %w", err)
+	}
+	if err := os.Remove(statePath); err != nil {
+		return nil, nil, fmt.Errorf("cannot remove upload state: %w", err)
+	}
+
+	return state, out, nil
+}
+
+// UploadAndRegisterResumable works like UploadAndRegister but uploads
+// the file in parts and records the progress in a sidecar file next to
+// the uploaded file. When called again after an interrupted upload only
+// the missing parts are uploaded, this also works if the file was
+// rebuilt with the same content.
+func UploadAndRegisterResumable(a ResumableAwsUploader, filename, bucketName, imageName, targetArch string, pbar *pb.ProgressBar) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("cannot upload: %v", err)
+	}
+	defer file.Close()
+
+	state, uploadOutput, err := doResumableUpload(a, file, bucketName, pbar)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(osStdout, "File uploaded to %s\n", aws.StringValue(uploadOutput.Location))
+
+	return register(a, bucketName, state.Key, imageName, targetArch)
+}
@@ -2,14 +2,18 @@ package uploader_test
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/cheggaaa/pb/v3"
 
@@ -89,3 +93,147 @@ func TestUploadAndRegisterProgressBar(t *testing.T) {
 	assert.Regexp(t, `10.00 MiB / 10.00 MiB \[-+\] 100.00%`, fakeStdout.String())
 	assert.Contains(t, fakeStdout.String(), "Registering AMI ")
 }
+
+type FakeResumableAwsUploader struct {
+	FakeAwsUploader
+
+	createCalled   int
+	completeCalled int
+	uploadedParts  []int64
+	failOnPart     int64
+	uploaded       map[int64][]byte
+	completedParts []*s3.CompletedPart
+	abortedUploads []string
+}
+
+func (f *FakeResumableAwsUploader) CreateMultipartUpload(input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
+	f.createCalled++
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-id")}, nil
+}
+
+func (f *FakeResumableAwsUploader) UploadPart(input *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	partNumber := aws.Int64Value(input.PartNumber)
+	if partNumber == f.failOnPart {
+		return nil, fmt.Errorf("simulated network error")
+	}
+	data, err := io.ReadAll(input.Body)
+	if err != nil {
+		panic(err)
+	}
+	if f.uploaded == nil {
+		f.uploaded = make(map[int64][]byte)
+	}
+	f.uploaded[partNumber] = data
+	f.uploadedParts = append(f.uploadedParts, partNumber)
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf("etag-%d", partNumber))}, nil
+}
+
+func (f *FakeResumableAwsUploader) CompleteMultipartUpload(input *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error) {
+	f.completeCalled++
+	f.completedParts = input.MultipartUpload.Parts
+	return &s3.CompleteMultipartUploadOutput{Location: aws.String("some-location")}, nil
+}
+
+func (f *FakeResumableAwsUploader) AbortMultipartUpload(input *s3.AbortMultipartUploadInput) (*s3.AbortMultipartUploadOutput, error) {
+	f.abortedUploads = append(f.abortedUploads, aws.StringValue(input.UploadId))
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func TestUploadAndRegisterResumableResumesAfterFailure(t *testing.T) {
+	fakeStdout := bytes.NewBuffer(nil)
+	restore := uploader.MockOsStdout(fakeStdout)
+	defer restore()
+	restore = uploader.MockMultipartPartSize(4)
+	defer restore()
+
+	fakeDiskFile := filepath.Join(t.TempDir(), "fake-disk.img")
+	err := os.WriteFile(fakeDiskFile, []byte("0123456789"), 0644)
+	require.Nil(t, err)
+
+	// first attempt fails on the last part
+	fakeUploader := &FakeResumableAwsUploader{failOnPart: 3}
+	err = uploader.UploadAndRegisterResumable(fakeUploader, fakeDiskFile, "bucketName", "imageName", "", nil)
+	assert.ErrorContains(t, err, "cannot upload part 3 (upload can be resumed): simulated network error")
+	assert.Equal(t, []int64{1, 2}, fakeUploader.uploadedParts)
+	assert.Equal(t, 0, fakeUploader.completeCalled)
+	assert.Equal(t, 0, fakeUploader.registerCalled)
+	assert.FileExists(t, uploader.UploadStatePath(fakeDiskFile))
+
+	// second attempt only uploads the missing part
+	fakeUploader.failOnPart = 0
+	err = uploader.UploadAndRegisterResumable(fakeUploader, fakeDiskFile, "bucketName", "imageName", "", nil)
+	require.Nil(t, err)
+	assert.Equal(t, 1, fakeUploader.createCalled)
+	assert.Equal(t, []int64{1, 2, 3}, fakeUploader.uploadedParts)
+	assert.Equal(t, []byte("89"), fakeUploader.uploaded[3])
+	assert.Equal(t, 1, fakeUploader.completeCalled)
+	assert.Equal(t, 1, fakeUploader.registerCalled)
+	require.Len(t, fakeUploader.completedParts, 3)
+	for idx, p := range fakeUploader.completedParts {
+		assert.Equal(t, int64(idx+1), aws.Int64Value(p.PartNumber))
+		assert.Equal(t, fmt.Sprintf("etag-%d", idx+1), aws.StringValue(p.ETag))
+	}
+	assert.NoFileExists(t, uploader.UploadStatePath(fakeDiskFile))
+
+	assert.Contains(t, fakeStdout.String(), "Resuming upload of ")
+	assert.Contains(t, fakeStdout.String(), "Registering AMI ")
+}
+
+func TestUploadAndRegisterResumableIgnoresStaleState(t *testing.T) {
+	fakeStdout := bytes.NewBuffer(nil)
+	restore := uploader.MockOsStdout(fakeStdout)
+	defer restore()
+	restore = uploader.MockMultipartPartSize(4)
+	defer restore()
+
+	fakeDiskFile := filepath.Join(t.TempDir(), "fake-disk.img")
+	err := os.WriteFile(fakeDiskFile, []byte("0123456789"), 0644)
+	require.Nil(t, err)
+
+	fakeUploader := &FakeResumableAwsUploader{failOnPart: 2}
+	err = uploader.UploadAndRegisterResumable(fakeUploader, fakeDiskFile, "bucketName", "imageName", "", nil)
+	assert.ErrorContains(t, err, "simulated network error")
+
+	// the file changed so the upload needs to start from scratch
+	err = os.WriteFile(fakeDiskFile, []byte("abcdefghijklmn"), 0644)
+	require.Nil(t, err)
+	fakeUploader.failOnPart = 0
+	err = uploader.UploadAndRegisterResumable(fakeUploader, fakeDiskFile, "bucketName", "imageName", "", nil)
+	require.Nil(t, err)
+	assert.Equal(t, 2, fakeUploader.createCalled)
+	assert.Equal(t, []int64{1, 1, 2, 3, 4}, fakeUploader.uploadedParts)
+	assert.Contains(t, fakeStdout.String(), "Ignoring stale upload state ")
+	// the parts of the stale upload are not left in the bucket
+	assert.Equal(t, []string{"upload-id"}, fakeUploader.abortedUploads)
+}
+
+func TestUploadAndRegisterResumableResumesSameContent(t *testing.T) {
+	fakeStdout := bytes.NewBuffer(nil)
+	restore := uploader.MockOsStdout(fakeStdout)
+	defer restore()
+	restore = uploader.MockMultipartPartSize(4)
+	defer restore()
+
+	fakeDiskFile := filepath.Join(t.TempDir(), "fake-disk.img")
+	err := os.WriteFile(fakeDiskFile, []byte("0123456789"), 0644)
+	require.Nil(t, err)
+
+	fakeUploader := &FakeResumableAwsUploader{failOnPart: 3}
+	err = uploader.UploadAndRegisterResumable(fakeUploader, fakeDiskFile, "bucketName", "imageName", "", nil)
+	assert.ErrorContains(t, err, "simulated network error")
+
+	// the image is written again (e.g. copied back to the output
+	// directory), with the same content but a new mtime
+	err = os.WriteFile(fakeDiskFile, []byte("0123456789"), 0644)
+	require.Nil(t, err)
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(fakeDiskFile, later, later))
+
+	fakeUploader.failOnPart = 0
+	err = uploader.UploadAndRegisterResumable(fakeUploader, fakeDiskFile, "bucketName", "imageName", "", nil)
+	require.Nil(t, err)
+	assert.Equal(t, 1, fakeUploader.createCalled)
+	assert.Equal(t, []int64{1, 2, 3}, fakeUploader.uploadedParts)
+	assert.Empty(t, fakeUploader.abortedUploads)
+	assert.Contains(t, fakeStdout.String(), "Resuming upload of ")
+}
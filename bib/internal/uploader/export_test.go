@@ -11,3 +11,13 @@ func MockOsStdout(new io.Writer) (restore func()) {
 		osStdout = saved
 	}
 }
+
+func MockMultipartPartSize(new int64) (restore func()) {
+	saved := multipartPartSize
+	multipartPartSize = new
+	return func() {
+		multipartPartSize = saved
+	}
+}
+
+var UploadStatePath = uploadStatePath
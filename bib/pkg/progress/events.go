@@ -0,0 +1,165 @@
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Event is a single newline delimited JSON event that is sent to
+// the event socket (or the progress fd)
+type Event struct {
+	// Type is one of "start", "phase", "progress", "message",
+	// "result" or "stop"
+	Type    string `json:"type"`
+	Message string `json:"message,omitempty"`
+
+	Progress *EventProgress `json:"progress,omitempty"`
+
+	// Only set for "result" events
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// EventProgress is the progress information of a "progress" event
+type EventProgress struct {
+	Level int `json:"level"`
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// ResultReporter is implemented by progress bars that can report
+// the final result of a build
+type ResultReporter interface {
+	SetResult(result interface{}, err error)
+}
+
+type eventProgressBar struct {
+	pb ProgressBar
+
+	mu   sync.Mutex
+	conn io.WriteCloser
+	enc  *json.Encoder
+}
+
+func newEventProgressBar(conn io.WriteCloser, pb ProgressBar) *eventProgressBar {
+	return &eventProgressBar{
+		pb:   pb,
+		conn: conn,
+		enc:  json.NewEncoder(conn),
+	}
+}
+
+// NewEventSocketProgressBar connects to the unix socket at the given
+// path and sends all progress information as JSON lines events to
+// it. All progress information is also forwarded to the given
+// progress bar so that the user facing progress is unchanged.
+func NewEventSocketProgressBar(path string, pb ProgressBar) (ProgressBar, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to event socket: %w", err)
+	}
+	return newEventProgressBar(conn, pb), nil
+}
+
+// NewEventFdProgressBar sends all progress information as JSON lines
+// events to the given (inherited) file descriptor, similar to the
+// osbuild --monitor-fd. The file descriptor is closed when the
+// progress bar is stopped. All progress information is also forwarded
+// to the given progress bar.
+func NewEventFdProgressBar(fd int, pb ProgressBar) (ProgressBar, error) {
+	var st syscall.Stat_t
+	if err := syscall.Fstat(fd, &st); err != nil {
+		return nil, fmt.Errorf("cannot use progress fd %d: %w", fd, err)
+	}
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("progress-fd-%d", fd))
+	return newEventProgressBar(f, pb), nil
+}
+
+func (b *eventProgressBar) send(ev *Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.conn == nil {
+		return
+	}
+	// a consumer that went away should never break the build,
+	// just stop sending events
+	if err := b.enc.Encode(ev); err != nil {
+		logrus.Warnf("cannot send event, disabling events: %v", err)
+		b.conn.Close()
+		b.conn = nil
+	}
+}
+
+func (b *eventProgressBar) wrapped() ProgressBar {
+	return b.pb
+}
+
+func (b *eventProgressBar) SetProgress(level int, msg string, done int, total int) error {
+	b.send(&Event{
+		Type:    "progress",
+		Message: msg,
+		Progress: &EventProgress{
+			Level: level,
+			Done:  done,
+			Total: total,
+		},
+	})
+	return b.pb.SetProgress(level, msg, done, total)
+}
+
+func (b *eventProgressBar) SetPulseMsgf(msg string, args ...interface{}) {
+	b.send(&Event{Type: "phase", Message: fmt.Sprintf(msg, args...)})
+	b.pb.SetPulseMsgf(msg, args...)
+}
+
+func (b *eventProgressBar) SetMessagef(msg string, args ...interface{}) {
+	b.send(&Event{Type: "message", Message: fmt.Sprintf(msg, args...)})
+	b.pb.SetMessagef(msg, args...)
+}
+
+// SetResult sends the final build result (or the error that stopped
+// the build) as an event
+func (b *eventProgressBar) SetResult(result interface{}, err error) {
+	ev := &Event{Type: "result", Result: result}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	b.send(ev)
+	// e.g. for both an event socket and a progress fd
+	if rr, ok := b.pb.(ResultReporter); ok {
+		rr.SetResult(result, err)
+	}
+}
+
+func (b *eventProgressBar) Start() {
+	b.send(&Event{Type: "start"})
+	b.pb.Start()
+}
+
+func (b *eventProgressBar) Stop() {
+	b.pb.Stop()
+
+	b.mu.Lock()
+	conn := b.conn
+	b.mu.Unlock()
+	// Stop() may be called multiple times
+	if conn == nil {
+		return
+	}
+	b.send(&Event{Type: "stop"})
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn != nil {
+		b.conn.Close()
+		b.conn = nil
+	}
+}
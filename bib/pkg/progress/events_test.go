@@ -0,0 +1,202 @@
+package progress_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/bootc-image-builder/bib/pkg/progress"
+)
+
+// fakeEventConsumer listens on a unix socket and collects all events
+// until the connection is closed
+func fakeEventConsumer(t *testing.T) (string, <-chan []progress.Event) {
+	sockPath := filepath.Join(t.TempDir(), "events.sock")
+	l, err := net.Listen("unix", sockPath)
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	eventsCh := make(chan []progress.Event, 1)
+	go func() {
+		var events []progress.Event
+		defer func() { eventsCh <- events }()
+
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			var ev progress.Event
+			if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+				ev = progress.Event{Type: "invalid", Message: scanner.Text()}
+			}
+			events = append(events, ev)
+		}
+	}()
+	return sockPath, eventsCh
+}
+
+func TestEventSocketProgress(t *testing.T) {
+	var buf bytes.Buffer
+	restore := progress.MockOsStderr(&buf)
+	defer restore()
+
+	sockPath, eventsCh := fakeEventConsumer(t)
+
+	debugPbar, err := progress.NewDebugProgressBar()
+	require.NoError(t, err)
+	pbar, err := progress.NewEventSocketProgressBar(sockPath, debugPbar)
+	require.NoError(t, err)
+	assert.IsType(t, &progress.EventProgressBar{}, pbar)
+
+	pbar.Start()
+	pbar.SetPulseMsgf("pulse-%s", "msg")
+	pbar.SetMessagef("some-%s", "message")
+	err = pbar.SetProgress(1, "set-progress-msg", 2, 5)
+	assert.NoError(t, err)
+	pbar.(progress.ResultReporter).SetResult(map[string]string{"key": "value"}, nil)
+	pbar.(progress.ResultReporter).SetResult(nil, fmt.Errorf("some error"))
+	pbar.Stop()
+	// stopping multiple times is fine
+	pbar.Stop()
+
+	events := <-eventsCh
+	assert.Equal(t, []progress.Event{
+		{Type: "start"},
+		{Type: "phase", Message: "pulse-msg"},
+		{Type: "message", Message: "some-message"},
+		{Type: "progress", Message: "set-progress-msg", Progress: &progress.EventProgress{Level: 1, Done: 2, Total: 5}},
+		{Type: "result", Result: map[string]interface{}{"key": "value"}},
+		{Type: "result", Error: "some error"},
+		{Type: "stop"},
+	}, events)
+
+	// the wrapped progress bar still gets everything
+	assert.Equal(t, `Start progressbar
+pulse: pulse-msg
+msg: some-message
+  [2 / 5] set-progress-msg
+Stop progressbar
+Stop progressbar
+`, buf.String())
+}
+
+func TestEventSocketProgressNoConsumer(t *testing.T) {
+	_, err := progress.NewEventSocketProgressBar("/no/such/socket", nil)
+	assert.ErrorContains(t, err, "cannot connect to event socket: dial unix /no/such/socket: connect: no such file or directory")
+}
+
+func TestRunOSBuildWithEventSocket(t *testing.T) {
+	var buf bytes.Buffer
+	restore := progress.MockOsStderr(&buf)
+	defer restore()
+
+	restore = progress.MockOsbuildCmd(makeFakeOsbuild(t, `
+>&3 echo '{"progress": {"name": "pipelines", "done": 1, "total": 3}}'
+echo osbuild-stdout-output
+>&2 echo osbuild-stderr-output
+`))
+	defer restore()
+
+	sockPath, eventsCh := fakeEventConsumer(t)
+	verbosePbar, err := progress.NewVerboseProgressBar()
+	require.NoError(t, err)
+	pbar, err := progress.NewEventSocketProgressBar(sockPath, verbosePbar)
+	require.NoError(t, err)
+
+	err = progress.RunOSBuild(pbar, []byte(`{"fake":"manifest"}`), "", "", nil, nil, nil, nil)
+	assert.NoError(t, err)
+	pbar.Stop()
+
+	events := <-eventsCh
+	assert.Equal(t, []progress.Event{
+		{Type: "progress", Message: "Pipeline ", Progress: &progress.EventProgress{Level: 0, Done: 1, Total: 3}},
+		{Type: "stop"},
+	}, events)
+	// the wrapped verbose progress still shows the osbuild output
+	assert.Contains(t, buf.String(), "osbuild-stdout-output\n")
+	assert.Contains(t, buf.String(), "osbuild-stderr-output\n")
+}
+
+func TestEventSocketProgressStopDisplay(t *testing.T) {
+	var buf bytes.Buffer
+	restore := progress.MockOsStderr(&buf)
+	defer restore()
+
+	sockPath, eventsCh := fakeEventConsumer(t)
+	debugPbar, err := progress.NewDebugProgressBar()
+	require.NoError(t, err)
+	pbar, err := progress.NewEventSocketProgressBar(sockPath, debugPbar)
+	require.NoError(t, err)
+	timingsPbar := progress.NewStageTimingsProgressBar(pbar)
+
+	timingsPbar.Start()
+	progress.StopDisplay(timingsPbar)
+	assert.Equal(t, "Start progressbar\nStop progressbar\n", buf.String())
+	// e.g. the result of the AMI upload is still sent
+	timingsPbar.SetResult(nil, fmt.Errorf("upload error"))
+	timingsPbar.Stop()
+
+	events := <-eventsCh
+	assert.Equal(t, []progress.Event{
+		{Type: "start"},
+		{Type: "result", Error: "upload error"},
+		{Type: "stop"},
+	}, events)
+}
+
+func TestEventFdProgress(t *testing.T) {
+	restore := progress.MockOsStderr(&bytes.Buffer{})
+	defer restore()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	// the progress bar owns (and closes) the fd it is given
+	fd, err := syscall.Dup(int(w.Fd()))
+	require.NoError(t, err)
+	w.Close()
+
+	debugPbar, err := progress.NewDebugProgressBar()
+	require.NoError(t, err)
+	pbar, err := progress.NewEventFdProgressBar(fd, debugPbar)
+	require.NoError(t, err)
+
+	pbar.Start()
+	pbar.SetPulseMsgf("pulse-%s", "msg")
+	err = pbar.SetProgress(0, "set-progress-msg", 1, 3)
+	assert.NoError(t, err)
+	pbar.Stop()
+
+	var events []progress.Event
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var ev progress.Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &ev))
+		events = append(events, ev)
+	}
+	// reading stops at EOF, i.e. the fd was closed by Stop()
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, []progress.Event{
+		{Type: "start"},
+		{Type: "phase", Message: "pulse-msg"},
+		{Type: "progress", Message: "set-progress-msg", Progress: &progress.EventProgress{Level: 0, Done: 1, Total: 3}},
+		{Type: "stop"},
+	}, events)
+}
+
+func TestEventFdProgressBadFd(t *testing.T) {
+	_, err := progress.NewEventFdProgressBar(9999, nil)
+	assert.EqualError(t, err, "cannot use progress fd 9999: bad file descriptor")
+}
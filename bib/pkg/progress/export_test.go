@@ -8,6 +8,8 @@ type (
 	TerminalProgressBar = terminalProgressBar
 	DebugProgressBar    = debugProgressBar
 	VerboseProgressBar  = verboseProgressBar
+
+	EventProgressBar = eventProgressBar
 )
 
 func MockOsStderr(w io.Writer) (restore func()) {
@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cheggaaa/pb/v3"
@@ -316,8 +317,44 @@ func (b *debugProgressBar) SetProgress(subLevel int, msg string, done int, total
 	return nil
 }
 
+// wrappingProgressBar is implemented by progress bars that forward
+// all progress information to another progress bar
+type wrappingProgressBar interface {
+	wrapped() ProgressBar
+}
+
+// userProgressBar returns the (innermost) progress bar that is shown
+// to the user
+func userProgressBar(pb ProgressBar) ProgressBar {
+	for {
+		w, ok := pb.(wrappingProgressBar)
+		if !ok {
+			return pb
+		}
+		pb = w.wrapped()
+	}
+}
+
+// StopDisplay stops only the progress bar that is shown to the user,
+// the events (if any) keep being sent until the progress bar itself
+// is stopped. This is useful when e.g. the AMI upload takes over the
+// terminal with its own progress.
+func StopDisplay(pb ProgressBar) {
+	userProgressBar(pb).Stop()
+}
+
 // XXX: merge variant back into images/pkg/osbuild/osbuild-exec.go
-func RunOSBuild(pb ProgressBar, manifest []byte, store, outputDirectory string, exports, extraEnv []string) error {
+//
+// The output of osbuild is also written to buildLog (if not nil) so
+// that it can be kept, e.g. for a debug bundle of a failed build.
+func RunOSBuild(pb ProgressBar, manifest []byte, store, outputDirectory string, exports, checkpoints, extraEnv []string, buildLog io.Writer) error {
+	if buildLog == nil {
+		buildLog = io.Discard
+	}
+	// the osbuild stdout/stderr and the monitor are written from
+	// different goroutines
+	buildLog = &lockedWriter{w: buildLog}
+
 	// To keep maximum compatibility keep the old behavior to run osbuild
 	// directly and show all messages unless we have a "real" progress bar.
 	//
@@ -326,45 +363,83 @@ func RunOSBuild(pb ProgressBar, manifest []byte, store, outputDirectory string,
 	// checked with them we can remove the runOSBuildNoProgress() and
 	// just run with the new runOSBuildWithProgress() helper.
 	switch pb.(type) {
-	case *terminalProgressBar, *debugProgressBar:
-		return runOSBuildWithProgress(pb, manifest, store, outputDirectory, exports, extraEnv)
+	case *terminalProgressBar, *debugProgressBar, *eventProgressBar, *StageTimingsProgressBar:
+		// the event socket consumer wants the progress details
+		// from osbuild too, the stage timings are taken from them
+		return runOSBuildWithProgress(pb, manifest, store, outputDirectory, exports, checkpoints, extraEnv, buildLog)
 	default:
-		return runOSBuildNoProgress(pb, manifest, store, outputDirectory, exports, extraEnv)
+		return runOSBuildNoProgress(pb, manifest, store, outputDirectory, exports, checkpoints, extraEnv, buildLog)
 	}
 }
 
-func runOSBuildNoProgress(pb ProgressBar, manifest []byte, store, outputDirectory string, exports, extraEnv []string) error {
-	_, err := osbuild.RunOSBuild(manifest, store, outputDirectory, exports, nil, extraEnv, false, os.Stderr)
-	return err
-}
-
 var osbuildCmd = "osbuild"
 
-func runOSBuildWithProgress(pb ProgressBar, manifest []byte, store, outputDirectory string, exports, extraEnv []string) error {
-	rp, wp, err := os.Pipe()
-	if err != nil {
-		return fmt.Errorf("cannot create pipe for osbuild: %w", err)
-	}
-	defer rp.Close()
-	defer wp.Close()
+// lockedWriter serializes the writes to w
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lockedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(p)
+}
 
+// osbuildCommand returns the osbuild command for the given manifest,
+// the monitorArgs are passed before the manifest
+func osbuildCommand(manifest []byte, store, outputDirectory string, exports, checkpoints, extraEnv []string, monitorArgs ...string) *exec.Cmd {
 	cmd := exec.Command(
 		osbuildCmd,
 		"--store", store,
 		"--output-directory", outputDirectory,
-		"--monitor=JSONSeqMonitor",
-		"--monitor-fd=3",
-		"-",
 	)
+	cmd.Args = append(cmd.Args, monitorArgs...)
+	cmd.Args = append(cmd.Args, "-")
 	for _, export := range exports {
 		cmd.Args = append(cmd.Args, "--export", export)
 	}
-
-	var stdio bytes.Buffer
+	for _, checkpoint := range checkpoints {
+		cmd.Args = append(cmd.Args, "--checkpoint", checkpoint)
+	}
 	cmd.Env = append(os.Environ(), extraEnv...)
 	cmd.Stdin = bytes.NewBuffer(manifest)
-	cmd.Stdout = &stdio
-	cmd.Stderr = &stdio
+	return cmd
+}
+
+func runOSBuildNoProgress(pb ProgressBar, manifest []byte, store, outputDirectory string, exports, checkpoints, extraEnv []string, buildLog io.Writer) error {
+	cmd := osbuildCommand(manifest, store, outputDirectory, exports, checkpoints, extraEnv)
+	cmd.Stdout = io.MultiWriter(os.Stdout, buildLog)
+	cmd.Stderr = io.MultiWriter(os.Stderr, buildLog)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running osbuild failed: %v", err)
+	}
+	return nil
+}
+
+func runOSBuildWithProgress(pb ProgressBar, manifest []byte, store, outputDirectory string, exports, checkpoints, extraEnv []string, buildLog io.Writer) error {
+	rp, wp, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("cannot create pipe for osbuild: %w", err)
+	}
+	defer rp.Close()
+	defer wp.Close()
+
+	cmd := osbuildCommand(manifest, store, outputDirectory, exports, checkpoints, extraEnv, "--monitor=JSONSeqMonitor", "--monitor-fd=3")
+
+	var stdio bytes.Buffer
+	var output io.Writer = io.MultiWriter(&stdio, buildLog)
+	switch userProgressBar(pb).(type) {
+	case *terminalProgressBar, *debugProgressBar:
+		// the output is only shown when osbuild fails
+	default:
+		// e.g. a verbose progress bar that is wrapped to send
+		// events, the user still expects the raw osbuild output
+		// just like with runOSBuildNoProgress()
+		output = io.MultiWriter(output, osStderr())
+	}
+	cmd.Stdout = output
+	cmd.Stderr = output
 	cmd.ExtraFiles = []*os.File{wp}
 
 	osbuildStatus := osbuild.NewStatusScanner(rp)
@@ -384,6 +459,9 @@ func runOSBuildWithProgress(pb ProgressBar, manifest []byte, store, outputDirect
 		if st == nil {
 			break
 		}
+		if sr, ok := pb.(statusRecorder); ok {
+			sr.recordStatus(st)
+		}
 		i := 0
 		for p := st.Progress; p != nil; p = p.SubProgress {
 			if err := pb.SetProgress(i, p.Message, p.Done, p.Total); err != nil {
@@ -399,9 +477,11 @@ func runOSBuildWithProgress(pb ProgressBar, manifest []byte, store, outputDirect
 		// keep all messages/traces for better error reporting
 		if st.Message != "" {
 			tracesMsgs = append(tracesMsgs, st.Message)
+			fmt.Fprintln(buildLog, st.Message)
 		}
 		if st.Trace != "" {
 			tracesMsgs = append(tracesMsgs, st.Trace)
+			fmt.Fprintln(buildLog, st.Trace)
 		}
 	}
 
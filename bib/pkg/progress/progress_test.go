@@ -156,7 +156,7 @@ exit 112
 
 	pbar, err := progress.New("debug")
 	assert.NoError(t, err)
-	err = progress.RunOSBuild(pbar, []byte(`{"fake":"manifest"}`), "", "", nil, nil)
+	err = progress.RunOSBuild(pbar, []byte(`{"fake":"manifest"}`), "", "", nil, nil, nil, nil)
 	assert.EqualError(t, err, `error running osbuild: exit status 112
 BuildLog:
 osbuild-stage-message
@@ -166,6 +166,35 @@ osbuild-stderr-output
 `)
 }
 
+func TestRunOSBuildBuildLog(t *testing.T) {
+	restore := progress.MockOsStderr(io.Discard)
+	defer restore()
+
+	for _, typ := range []string{"debug", "verbose"} {
+		// the verbose progress runs osbuild without the monitor
+		restore = progress.MockOsbuildCmd(makeFakeOsbuild(t, `
+case "$*" in *--monitor-fd=3*)
+    >&3 echo '{"message": "osbuild-stage-message"}'
+esac
+echo osbuild-stdout-output
+>&2 echo osbuild-stderr-output
+exit 112
+`))
+		defer restore()
+
+		pbar, err := progress.New(typ)
+		assert.NoError(t, err)
+		var buildLog bytes.Buffer
+		err = progress.RunOSBuild(pbar, []byte(`{"fake":"manifest"}`), "", "", nil, nil, nil, &buildLog)
+		assert.ErrorContains(t, err, "exit status 112")
+		assert.Contains(t, buildLog.String(), "osbuild-stdout-output\n", typ)
+		assert.Contains(t, buildLog.String(), "osbuild-stderr-output\n", typ)
+		if typ == "debug" {
+			assert.Contains(t, buildLog.String(), "osbuild-stage-message\n")
+		}
+	}
+}
+
 func TestRunOSBuildWithProgressIncorrectJSON(t *testing.T) {
 	restore := progress.MockOsbuildCmd(makeFakeOsbuild(t, `echo osbuild-stdout-output
 >&2 echo osbuild-stderr-output
@@ -175,7 +204,22 @@ func TestRunOSBuildWithProgressIncorrectJSON(t *testing.T) {
 
 	pbar, err := progress.New("debug")
 	assert.NoError(t, err)
-	err = progress.RunOSBuild(pbar, []byte(`{"fake":"manifest"}`), "", "", nil, nil)
+	err = progress.RunOSBuild(pbar, []byte(`{"fake":"manifest"}`), "", "", nil, nil, nil, nil)
 	assert.EqualError(t, err, `errors parsing osbuild status:
 cannot scan line "invalid-json": invalid character 'i' looking for beginning of value`)
 }
+
+func TestRunOSBuildWithProgressCheckpoints(t *testing.T) {
+	argsFile := filepath.Join(t.TempDir(), "args")
+	restore := progress.MockOsbuildCmd(makeFakeOsbuild(t, fmt.Sprintf(`echo "$@" > %s`, argsFile)))
+	defer restore()
+
+	pbar, err := progress.New("debug")
+	assert.NoError(t, err)
+	err = progress.RunOSBuild(pbar, []byte(`{"fake":"manifest"}`), "/store", "/output", []string{"qcow2", "image"}, []string{"image"}, nil, nil)
+	assert.NoError(t, err)
+
+	args, err := os.ReadFile(argsFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "--store /store --output-directory /output --monitor=JSONSeqMonitor --monitor-fd=3 - --export qcow2 --export image --checkpoint image\n", string(args))
+}
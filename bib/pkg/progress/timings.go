@@ -0,0 +1,119 @@
+package progress
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+// StageTiming is the start and end time of a single osbuild stage
+type StageTiming struct {
+	Pipeline string
+	Stage    string
+	Start    time.Time
+	End      time.Time
+}
+
+// Duration returns the time the stage took
+func (st StageTiming) Duration() time.Duration {
+	return st.End.Sub(st.Start)
+}
+
+// statusRecorder is implemented by progress bars that want the raw
+// osbuild status (e.g. for the timestamps of the monitor messages)
+type statusRecorder interface {
+	recordStatus(st *osbuild.Status)
+}
+
+// StageTimingsProgressBar records the start and end of each osbuild
+// stage from the timestamps of the osbuild monitor messages. A stage
+// ends when the next stage starts (or when osbuild is done). All
+// progress information is forwarded to the given progress bar.
+type StageTimingsProgressBar struct {
+	pb ProgressBar
+
+	mu      sync.Mutex
+	timings []StageTiming
+	current *StageTiming
+	last    time.Time
+}
+
+// NewStageTimingsProgressBar records the stage timings of the osbuild
+// run and forwards all progress information to the given progress bar
+func NewStageTimingsProgressBar(pb ProgressBar) *StageTimingsProgressBar {
+	return &StageTimingsProgressBar{pb: pb}
+}
+
+func (b *StageTimingsProgressBar) recordStatus(st *osbuild.Status) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.last = st.Timestamp
+	// the progress is "Pipeline NAME" with a "Stage NAME" subprogress
+	if st.Progress == nil || st.Progress.SubProgress == nil {
+		return
+	}
+	pipeline := strings.TrimPrefix(st.Progress.Message, "Pipeline ")
+	stage := strings.TrimPrefix(st.Progress.SubProgress.Message, "Stage ")
+	if stage == "" {
+		return
+	}
+	if b.current != nil && b.current.Pipeline == pipeline && b.current.Stage == stage {
+		return
+	}
+	b.finishCurrent(st.Timestamp)
+	b.current = &StageTiming{Pipeline: pipeline, Stage: stage, Start: st.Timestamp}
+}
+
+func (b *StageTimingsProgressBar) finishCurrent(end time.Time) {
+	if b.current == nil {
+		return
+	}
+	b.current.End = end
+	b.timings = append(b.timings, *b.current)
+	b.current = nil
+}
+
+// Timings returns the recorded stage timings in the order the stages
+// were run, the last stage ends with the last osbuild message
+func (b *StageTimingsProgressBar) Timings() []StageTiming {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.finishCurrent(b.last)
+	return append([]StageTiming(nil), b.timings...)
+}
+
+func (b *StageTimingsProgressBar) wrapped() ProgressBar {
+	return b.pb
+}
+
+func (b *StageTimingsProgressBar) SetProgress(level int, msg string, done int, total int) error {
+	return b.pb.SetProgress(level, msg, done, total)
+}
+
+func (b *StageTimingsProgressBar) SetPulseMsgf(msg string, args ...interface{}) {
+	b.pb.SetPulseMsgf(msg, args...)
+}
+
+func (b *StageTimingsProgressBar) SetMessagef(msg string, args ...interface{}) {
+	b.pb.SetMessagef(msg, args...)
+}
+
+// SetResult forwards the result to the wrapped progress bar (if it
+// reports results)
+func (b *StageTimingsProgressBar) SetResult(result interface{}, err error) {
+	if rr, ok := b.pb.(ResultReporter); ok {
+		rr.SetResult(result, err)
+	}
+}
+
+func (b *StageTimingsProgressBar) Start() {
+	b.pb.Start()
+}
+
+func (b *StageTimingsProgressBar) Stop() {
+	b.pb.Stop()
+}
@@ -0,0 +1,90 @@
+package progress_test
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/bootc-image-builder/bib/pkg/progress"
+)
+
+// fakeMonitorOutput is a synthetic osbuild JSONSeqMonitor stream with
+// two stages in the "build" pipeline and one in the "image" pipeline
+const fakeMonitorOutput = `
+>&3 echo '{"message": "Starting pipeline build", "context": {"origin": "osbuild.monitor", "id": "c1", "pipeline": {"name": "build", "stage": {"name": "org.osbuild.rpm", "id": "s1"}}}, "progress": {"done": 0, "total": 2, "progress": {"done": 0, "total": 2}}, "timestamp": 1700000000.0}'
+>&3 echo '{"message": "installing rpms", "context": {"id": "c1"}, "progress": {"done": 0, "total": 2, "progress": {"done": 0, "total": 2}}, "timestamp": 1700000003.5}'
+>&3 echo '{"message": "Starting stage", "context": {"origin": "osbuild.monitor", "id": "c2", "pipeline": {"name": "build", "stage": {"name": "org.osbuild.selinux", "id": "s2"}}}, "progress": {"done": 0, "total": 2, "progress": {"done": 1, "total": 2}}, "timestamp": 1700000010.0}'
+>&3 echo '{"message": "Starting pipeline image", "context": {"origin": "osbuild.monitor", "id": "c3", "pipeline": {"name": "image", "stage": {"name": "org.osbuild.truncate", "id": "s3"}}}, "progress": {"done": 1, "total": 2, "progress": {"done": 0, "total": 1}}, "timestamp": 1700000012.25}'
+>&3 echo '{"message": "Finished pipeline image", "context": {"origin": "osbuild.monitor", "id": "c4", "pipeline": {"name": "image"}}, "progress": {"done": 2, "total": 2}, "timestamp": 1700000013.0}'
+`
+
+func TestStageTimingsProgressBar(t *testing.T) {
+	restore := progress.MockOsStderr(io.Discard)
+	defer restore()
+	restore = progress.MockOsbuildCmd(makeFakeOsbuild(t, fakeMonitorOutput))
+	defer restore()
+
+	pbar, err := progress.New("debug")
+	require.NoError(t, err)
+	timingsPbar := progress.NewStageTimingsProgressBar(pbar)
+	err = progress.RunOSBuild(timingsPbar, []byte(`{"fake":"manifest"}`), "", "", nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	ts := func(sec float64) time.Time {
+		return time.UnixMilli(int64(sec * 1000))
+	}
+	timings := timingsPbar.Timings()
+	assert.Equal(t, []progress.StageTiming{
+		{Pipeline: "build", Stage: "org.osbuild.rpm", Start: ts(1700000000), End: ts(1700000010)},
+		{Pipeline: "build", Stage: "org.osbuild.selinux", Start: ts(1700000010), End: ts(1700000012.25)},
+		{Pipeline: "image", Stage: "org.osbuild.truncate", Start: ts(1700000012.25), End: ts(1700000013)},
+	}, timings)
+	assert.Equal(t, 10*time.Second, timings[0].Duration())
+	assert.Equal(t, 750*time.Millisecond, timings[2].Duration())
+}
+
+func TestStageTimingsProgressBarForwards(t *testing.T) {
+	var fake fakeResultProgressBar
+	pbar := progress.NewStageTimingsProgressBar(&fake)
+
+	pbar.Start()
+	pbar.SetMessagef("msg %d", 1)
+	assert.NoError(t, pbar.SetProgress(0, "Pipeline build", 1, 2))
+	pbar.SetResult("result", nil)
+	pbar.Stop()
+	assert.Equal(t, []string{"start", "message: msg 1", "progress: 0 Pipeline build 1/2", "result: result", "stop"}, fake.calls)
+	assert.Empty(t, pbar.Timings())
+}
+
+type fakeResultProgressBar struct {
+	calls []string
+}
+
+func (f *fakeResultProgressBar) SetProgress(level int, msg string, done int, total int) error {
+	f.calls = append(f.calls, fmt.Sprintf("progress: %d %s %d/%d", level, msg, done, total))
+	return nil
+}
+
+func (f *fakeResultProgressBar) SetPulseMsgf(msg string, args ...interface{}) {
+	f.calls = append(f.calls, "pulse: "+fmt.Sprintf(msg, args...))
+}
+
+func (f *fakeResultProgressBar) SetMessagef(msg string, args ...interface{}) {
+	f.calls = append(f.calls, "message: "+fmt.Sprintf(msg, args...))
+}
+
+func (f *fakeResultProgressBar) SetResult(result interface{}, err error) {
+	f.calls = append(f.calls, fmt.Sprintf("result: %v", result))
+}
+
+func (f *fakeResultProgressBar) Start() {
+	f.calls = append(f.calls, "start")
+}
+
+func (f *fakeResultProgressBar) Stop() {
+	f.calls = append(f.calls, "stop")
+}
@@ -360,8 +360,10 @@ def build_images(shared_tmpdir, build_container, request, force_aws_upload, gpg_
             },
         },
     }
-    testutil.maybe_create_filesystem_customizations(cfg, tc)
-    testutil.maybe_create_disk_customizations(cfg, tc)
+    # filesystem and disk customizations are only supported for disk images
+    if image_types[0] in DISK_IMAGE_TYPES + CLOUD_BOOT_IMAGE_TYPES:
+        testutil.maybe_create_filesystem_customizations(cfg, tc)
+        testutil.maybe_create_disk_customizations(cfg, tc)
     print(f"config for {output_path} {tc=}: {cfg=}")
 
     config_json_path = output_path / "config.json"
@@ -99,11 +99,21 @@ def find_ovmf():
 
 class QEMU(VM):
     MEM = "2000"
+    # how often and how long to wait for qemu to create the qmp socket,
+    # the number of retries can be set via OSBUILD_TEST_QMP_RETRIES
+    QMP_RETRIES = 30
+    QMP_RETRY_INTERVAL_SEC = 1
 
-    def __init__(self, img, arch="", snapshot=True, cdrom=None):
+    def __init__(self, img, arch="", snapshot=True, cdrom=None, qmp_retries=None, qmp_retry_interval_sec=None):
         super().__init__()
         self._img = pathlib.Path(img)
         self._qmp_socket = self._img.with_suffix(".qemp-socket")
+        if qmp_retries is None:
+            qmp_retries = int(os.environ.get("OSBUILD_TEST_QMP_RETRIES", self.QMP_RETRIES))
+        self._qmp_retries = qmp_retries
+        if qmp_retry_interval_sec is None:
+            qmp_retry_interval_sec = self.QMP_RETRY_INTERVAL_SEC
+        self._qmp_retry_interval_sec = qmp_retry_interval_sec
         self._qemu_p = None
         self._snapshot = snapshot
         self._cdrom = cdrom
@@ -180,17 +190,18 @@ class QEMU(VM):
         else:
             raise ValueError(f"unsupported wait_event {wait_event}")
 
-    def _wait_qmp_socket(self, timeout_sec):
-        for _ in range(timeout_sec):
+    def _wait_qmp_socket(self):
+        for _ in range(self._qmp_retries):
             if os.path.exists(self._qmp_socket):
                 return True
-            time.sleep(1)
+            time.sleep(self._qmp_retry_interval_sec)
+        timeout_sec = self._qmp_retries * self._qmp_retry_interval_sec
         raise TimeoutError(f"no {self._qmp_socket} after {timeout_sec} seconds")
 
     def wait_qmp_event(self, qmp_event):
         # import lazy to avoid requiring it for all operations
         import qmp  # pylint: disable=import-outside-toplevel
-        self._wait_qmp_socket(30)
+        self._wait_qmp_socket()
         mon = qmp.QEMUMonitorProtocol(os.fspath(self._qmp_socket))
         mon.connect()
         while True:
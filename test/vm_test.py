@@ -0,0 +1,27 @@
+import time
+
+import pytest
+from vm import QEMU
+
+
+def test_qemu_wait_qmp_socket_times_out_fast(tmp_path):
+    vm = QEMU(tmp_path / "disk.img", qmp_retries=3, qmp_retry_interval_sec=0.01)
+    start = time.monotonic()
+    with pytest.raises(TimeoutError, match=r"disk.qemp-socket after 0.03 seconds"):
+        vm._wait_qmp_socket()  # pylint: disable=protected-access
+    assert time.monotonic() - start < 1
+
+
+def test_qemu_wait_qmp_socket_found(tmp_path):
+    vm = QEMU(tmp_path / "disk.img", qmp_retries=3, qmp_retry_interval_sec=0.01)
+    (tmp_path / "disk.qemp-socket").touch()
+    assert vm._wait_qmp_socket()  # pylint: disable=protected-access
+
+
+def test_qemu_qmp_retries_from_env(tmp_path, monkeypatch):
+    monkeypatch.setenv("OSBUILD_TEST_QMP_RETRIES", "120")
+    vm = QEMU(tmp_path / "disk.img")
+    assert vm._qmp_retries == 120  # pylint: disable=protected-access
+    monkeypatch.delenv("OSBUILD_TEST_QMP_RETRIES")
+    vm = QEMU(tmp_path / "disk.img")
+    assert vm._qmp_retries == 30  # pylint: disable=protected-access